@@ -0,0 +1,240 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/completion"
+	"github.com/revolyssup/k8sdebug/pkg/config"
+	"github.com/revolyssup/k8sdebug/pkg/output"
+	"github.com/revolyssup/k8sdebug/pkg/portforward"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+// profile is the value of the global --profile flag.
+var profile string
+
+// flagSettings are the flags whose default is taken from the settings when they are not given.
+var flagSettings = map[string]func(s config.Settings) string{
+	"namespace":     func(s config.Settings) string { return s.Namespace },
+	"output":        func(s config.Settings) string { return s.Output },
+	"policy":        func(s config.Settings) string { return s.PortForward.Policy },
+	"hostport":      func(s config.Settings) string { return s.PortForward.HostPort },
+	"containerport": func(s config.Settings) string { return s.PortForward.ContainerPort },
+}
+
+// applySettings resolves the settings and sets the flags of the command that were not given on the command line.
+func applySettings(cmd *cobra.Command) error {
+	if _, err := pkg.LoadConfig(profile); err != nil {
+		return err
+	}
+	for name, value := range flagSettings {
+		if f := cmd.Flags().Lookup(name); f != nil && !f.Changed {
+			if err := f.Value.Set(value(pkg.Settings)); err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// isConfigCommand reports whether cmd is config or one of its subcommands, which must work with an invalid config.
+func isConfigCommand(cmd *cobra.Command) bool {
+	for c := cmd; c != nil; c = c.Parent() {
+		if c.Name() == "config" && c.HasParent() && !c.Parent().HasParent() {
+			return true
+		}
+	}
+	return false
+}
+
+// completeProfiles completes the profiles defined in the user and project config files.
+func completeProfiles(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	paths := []string{pkg.ConfigFilePath}
+	if dir, err := os.Getwd(); err == nil {
+		paths = append(paths, config.FindProject(dir))
+	}
+	var names []string
+	for _, path := range paths {
+		if f, err := config.ReadFile(path); err == nil {
+			for name := range f.Profiles {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return completion.Values(names, toComplete)
+}
+
+func newConfigCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "View, change and validate the settings",
+		Long: `View, change and validate the settings of k8sdebug.
+
+Settings are read from, lowest precedence first:
+  built-in defaults
+  ~/.k8sdebug/config.yaml
+  .k8sdebug.yaml in the working directory or the nearest parent directory, for per-project settings
+  the selected profile, defined in either file
+  K8SDEBUG_LOGS_PATH, K8SDEBUG_NAMESPACE, K8SDEBUG_OUTPUT and K8SDEBUG_POLICY
+  command-line flags
+
+The profile is selected with --profile, or K8SDEBUG_PROFILE, or the profile key of the project file, then of the
+user file. For example:
+
+  logsPath: /tmp/k8sdebug/logs
+  namespace: shop              # default of --namespace
+  output: text                 # default of --output
+  portForward:
+    policy: sticky             # defaults of port-forward --policy, --hostport and --containerport
+    hostPort: "3000"
+    containerPort: "80"
+  redact:                      # applied to the lines printed by the logs commands
+  - name: emails
+    match: '[\w.+-]+@[\w-]+\.[\w.]+'
+    replace: <email>           # default ***, $1 refers to a group
+  retention:                   # policy of logs cleanup when no policy flag is given
+    olderThan: 7d
+    maxSize: 2GiB
+    keepRevisions: 3
+    gone: true
+  profile: staging
+  profiles:
+    staging:
+      namespace: shop-staging
+      logsPath: /tmp/k8sdebug/staging`,
+	}
+	var sources bool
+	viewCmd := &cobra.Command{
+		Use:   "view",
+		Short: "Print the resolved settings",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			loaded, err := pkg.LoadConfig(profile)
+			if err != nil {
+				cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+				return
+			}
+			if output.Structured() {
+				if err := output.Write(os.Stdout, loaded); err != nil {
+					cmd.PrintErrln("Error encoding settings:", err)
+				}
+				return
+			}
+			if sources {
+				for _, f := range loaded.Files {
+					cmd.Println("# file:", f)
+				}
+				if loaded.Profile != "" {
+					cmd.Println("# profile:", loaded.Profile)
+				}
+				for _, e := range loaded.Env {
+					cmd.Println("# env:", e)
+				}
+			}
+			data, err := yaml.Marshal(loaded.Settings)
+			if err != nil {
+				cmd.PrintErrln("Error encoding settings:", err)
+				return
+			}
+			cmd.Print(string(data))
+		},
+	}
+	viewCmd.Flags().BoolVar(&sources, "sources", false, "list the files, profile and environment variables the settings were resolved from")
+	cmd.AddCommand(viewCmd)
+
+	var setProfile string
+	var project bool
+	setCmd := &cobra.Command{
+		Use:   "set <key> <value>",
+		Short: "Set a key in the config file, an empty value removes it",
+		Long: `Set a key in ~/.k8sdebug/config.yaml, or in the project file with --project, or in a profile with --in-profile.
+An empty value removes the key. Keys: ` + strings.Join(config.Keys(), ", ") + `.
+Redaction rules are lists: edit the file to change them.`,
+		Args: cobra.ExactArgs(2),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return completion.Values(config.Keys(), toComplete)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			path := pkg.ConfigFilePath
+			if project {
+				dir, err := os.Getwd()
+				if err != nil {
+					cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+					return
+				}
+				if path = config.FindProject(dir); path == "" {
+					path = filepath.Join(dir, config.ProjectFile)
+				}
+			}
+			if err := config.Set(path, setProfile, args[0], args[1], portforward.Policies()); err != nil {
+				cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+				return
+			}
+			cmd.Println(pkg.ColorLine(fmt.Sprintf("Set %s in %s", args[0], path), pkg.ColorGreen))
+			if _, err := pkg.LoadConfig(profile); err != nil {
+				cmd.Println(pkg.ColorLine(fmt.Sprintf("The settings do not resolve: %v", err), pkg.ColorYellow))
+			}
+		},
+	}
+	setCmd.Flags().StringVar(&setProfile, "in-profile", "", "set the key in this profile")
+	setCmd.Flags().BoolVar(&project, "project", false, "set the key in the nearest .k8sdebug.yaml, created in the working directory if there is none")
+	cmd.AddCommand(setCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "validate [file...]",
+		Short: "Check the config files and the resolved settings",
+		Long:  "Check the given config files, or the user and project config files and the settings they resolve to with the selected profile.",
+		Run: func(cmd *cobra.Command, args []string) {
+			files := args
+			if len(files) == 0 {
+				files = []string{pkg.ConfigFilePath}
+				if dir, err := os.Getwd(); err == nil && config.FindProject(dir) != "" {
+					files = append(files, config.FindProject(dir))
+				}
+			}
+			valid := true
+			for _, path := range files {
+				f, err := config.ReadFile(path)
+				if errors.Is(err, os.ErrNotExist) && len(args) == 0 {
+					continue
+				}
+				if err == nil {
+					if verr := f.Validate(portforward.Policies()); verr != nil {
+						err = fmt.Errorf("%s:\n%w", path, verr)
+					}
+				}
+				if err != nil {
+					valid = false
+					cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+					continue
+				}
+				cmd.Println(pkg.ColorLine(fmt.Sprintf("%s is valid", path), pkg.ColorGreen))
+			}
+			if len(args) == 0 && valid {
+				loaded, err := pkg.LoadConfig(profile)
+				if err == nil {
+					err = loaded.Settings.Validate(portforward.Policies())
+				}
+				if err != nil {
+					valid = false
+					cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+				}
+			}
+			if !valid {
+				os.Exit(1)
+			}
+		},
+	})
+	return cmd
+}
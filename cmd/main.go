@@ -1,13 +1,14 @@
 package main
 
 import (
-	"fmt"
-	"os"
-	"strconv"
-
 	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/completion"
 	"github.com/revolyssup/k8sdebug/pkg/logs"
+	"github.com/revolyssup/k8sdebug/pkg/output"
 	"github.com/revolyssup/k8sdebug/pkg/portforward"
+	"github.com/revolyssup/k8sdebug/pkg/server"
+	"github.com/revolyssup/k8sdebug/pkg/ui"
+	"github.com/revolyssup/k8sdebug/pkg/workspace"
 	"github.com/spf13/cobra"
 )
 
@@ -15,21 +16,29 @@ func main() {
 	rootCmd := cobra.Command{
 		Use:   "k8sdebug",
 		Short: "Debug application in Kubernetes",
-		PersistentPostRun: func(cmd *cobra.Command, args []string) {
-			content := ""
-			content += pkg.LOGS_PATH + "=" + pkg.ConfigData.LogsPath + "\n"
-			pid, err := strconv.Atoi(strconv.Itoa(pkg.ConfigData.LoggerPID))
-			if err != nil {
-				cmd.Println("Error converting LoggerPID to string:", err)
-				return
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := applySettings(cmd); err != nil && !isConfigCommand(cmd) {
+				cmd.SilenceUsage = true
+				return err
+			}
+			if err := output.Validate(); err != nil {
+				return err
 			}
-			content += fmt.Sprintf("%s=%d\n", pkg.LOGGER_PID, pid)
-			if err := os.WriteFile(pkg.ConfigFilePath, []byte(content), 0644); err != nil {
-				cmd.Println("Error writing config file:", err)
+			if output.Structured() {
+				pkg.ColorsEnabled = false
 			}
+			return nil
 		},
 	}
+	rootCmd.PersistentFlags().StringVarP(&output.Format, "output", "o", output.Text, "output format: text, json, yaml or jsonl. Colors are disabled for the machine-readable formats and when stdout is not a terminal")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "profile of the config files to use, defaults to $K8SDEBUG_PROFILE. See config --help")
+	rootCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
+	rootCmd.RegisterFlagCompletionFunc("output", completion.Fixed(output.Text, output.JSON, output.YAML, output.JSONL))
+	rootCmd.AddCommand(newConfigCommand())
 	rootCmd.AddCommand(logs.NewCommand())
 	rootCmd.AddCommand(portforward.NewCommand())
+	rootCmd.AddCommand(server.NewCommand())
+	rootCmd.AddCommand(ui.NewCommand())
+	rootCmd.AddCommand(workspace.NewCommand())
 	rootCmd.Execute()
 }
@@ -0,0 +1,339 @@
+// Package alert evaluates alert rules against the log lines and pod restarts seen by the recorder
+// and sends the alerts to a webhook, desktop notifications or the alerts log of the store.
+package alert
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg/tail"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	EventLine    = "line"
+	EventRestart = "restart"
+
+	NotifyWebhook = "webhook"
+	NotifyDesktop = "desktop"
+	NotifyLog     = "log"
+)
+
+// Rule fires when Threshold lines match Match, or Threshold restarts happen, within Window.
+type Rule struct {
+	Name string `json:"name"`
+	// Event is "line" (default) or "restart".
+	Event string `json:"event,omitempty"`
+	// Match is the regular expression matched against log lines.
+	Match string `json:"match,omitempty"`
+	// Namespace and Owner, e.g. deployment/api, restrict the rule to some pods.
+	Namespace string `json:"namespace,omitempty"`
+	Owner     string `json:"owner,omitempty"`
+	// Threshold defaults to 1, Window to one minute.
+	Threshold int             `json:"threshold,omitempty"`
+	Window    metav1.Duration `json:"window,omitempty"`
+	// Cooldown is the time after an alert during which the rule does not fire again for the same owner. Defaults to Window.
+	Cooldown metav1.Duration `json:"cooldown,omitempty"`
+	// Notify lists where alerts are sent: webhook, desktop and log. Defaults to log.
+	Notify  []string `json:"notify,omitempty"`
+	Webhook string   `json:"webhook,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// Config is the content of the rules file.
+type Config struct {
+	// Webhook is the url used by the rules notifying a webhook without their own.
+	Webhook string `json:"webhook,omitempty"`
+	Rules   []Rule `json:"rules"`
+}
+
+// Load reads and validates a YAML or JSON rules file.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Config
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := c.compile(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &c, nil
+}
+
+func (c *Config) compile() error {
+	for i := range c.Rules {
+		r := &c.Rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		switch r.Event {
+		case "", EventLine:
+			r.Event = EventLine
+			if r.Match == "" {
+				return fmt.Errorf("rule %s: match is required for line rules", r.Name)
+			}
+		case EventRestart:
+		default:
+			return fmt.Errorf("rule %s: unknown event %q, use line or restart", r.Name, r.Event)
+		}
+		if r.Match != "" {
+			var err error
+			if r.re, err = regexp.Compile(r.Match); err != nil {
+				return fmt.Errorf("rule %s: %w", r.Name, err)
+			}
+		}
+		if r.Threshold <= 0 {
+			r.Threshold = 1
+		}
+		if r.Window.Duration <= 0 {
+			r.Window.Duration = time.Minute
+		}
+		if r.Cooldown.Duration <= 0 {
+			r.Cooldown = r.Window
+		}
+		if len(r.Notify) == 0 {
+			r.Notify = []string{NotifyLog}
+		}
+		for _, n := range r.Notify {
+			switch n {
+			case NotifyWebhook:
+				if r.Webhook == "" {
+					r.Webhook = c.Webhook
+				}
+				if r.Webhook == "" {
+					return fmt.Errorf("rule %s: notify webhook needs a webhook url", r.Name)
+				}
+			case NotifyDesktop, NotifyLog:
+			default:
+				return fmt.Errorf("rule %s: unknown notifier %q, use webhook, desktop or log", r.Name, n)
+			}
+		}
+	}
+	return nil
+}
+
+// Pod identifies where a line or restart was seen. Owner is kind/name, e.g. deployment/api.
+type Pod struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"pod"`
+	Owner     string `json:"owner,omitempty"`
+}
+
+// Alert is a fired rule, as sent to webhooks and written to the alerts log.
+type Alert struct {
+	Time      time.Time `json:"time"`
+	Rule      string    `json:"rule"`
+	Event     string    `json:"event"`
+	Namespace string    `json:"namespace"`
+	Pod       string    `json:"pod"`
+	Owner     string    `json:"owner,omitempty"`
+	Count     int       `json:"count"`
+	Window    string    `json:"window"`
+	Message   string    `json:"message"`
+}
+
+func (a Alert) String() string {
+	return fmt.Sprintf("%s: %d %s in %s for %s/%s: %s", a.Rule, a.Count, plural(a.Event, a.Count), a.Window, a.Namespace, a.Pod, a.Message)
+}
+
+func plural(event string, n int) string {
+	name := "matching lines"
+	if event == EventRestart {
+		name = "restarts"
+	}
+	if n == 1 {
+		return strings.TrimSuffix(name, "s")
+	}
+	return name
+}
+
+// Notifier delivers alerts.
+type Notifier interface {
+	Notify(Alert) error
+}
+
+// queueSize is the number of notifications waiting to be delivered before new ones are dropped.
+const queueSize = 100
+
+// notification is an alert waiting to be delivered by one notifier of its rule.
+type notification struct {
+	notifier string
+	rule     Rule
+	alert    Alert
+}
+
+// Engine evaluates the rules. It is safe for concurrent use by the goroutines streaming pod logs.
+// Alerts are delivered in the background, so that a slow notifier never holds up the log streams.
+type Engine struct {
+	rules     []Rule
+	notifiers map[string]func(Rule) Notifier
+	errorLog  func(error)
+	now       func() time.Time
+	queue     chan notification
+	pending   sync.WaitGroup
+
+	mu       sync.Mutex
+	hits     map[string][]time.Time
+	lastFire map[string]time.Time
+	restarts map[string]int32
+}
+
+// NewEngine evaluates the rules of c. notifiers returns the notifier of every notify value of a rule;
+// errors of the notifiers are passed to errorLog.
+func NewEngine(c *Config, notifiers map[string]func(Rule) Notifier, errorLog func(error)) *Engine {
+	e := &Engine{
+		rules:     c.Rules,
+		notifiers: notifiers,
+		errorLog:  errorLog,
+		now:       time.Now,
+		queue:     make(chan notification, queueSize),
+		hits:      make(map[string][]time.Time),
+		lastFire:  make(map[string]time.Time),
+		restarts:  make(map[string]int32),
+	}
+	go e.deliver()
+	return e
+}
+
+// deliver sends the queued notifications one after the other.
+func (e *Engine) deliver() {
+	for n := range e.queue {
+		if err := e.notifiers[n.notifier](n.rule).Notify(n.alert); err != nil && e.errorLog != nil {
+			e.errorLog(fmt.Errorf("%s notification of rule %s: %w", n.notifier, n.rule.Name, err))
+		}
+		e.pending.Done()
+	}
+}
+
+// Wait waits for the queued notifications to be delivered.
+func (e *Engine) Wait() {
+	e.pending.Wait()
+}
+
+func (r *Rule) applies(pod Pod) bool {
+	if r.Namespace != "" && r.Namespace != pod.Namespace {
+		return false
+	}
+	return r.Owner == "" || strings.EqualFold(r.Owner, pod.Owner)
+}
+
+// Line evaluates the line rules against a log line of the pod.
+func (e *Engine) Line(pod Pod, line string) {
+	for i := range e.rules {
+		r := &e.rules[i]
+		if r.Event == EventLine && r.applies(pod) && r.re.MatchString(line) {
+			e.hit(r, pod, line)
+		}
+	}
+}
+
+// Restarts evaluates the restart rules with the total container restarts of the pod. The first call for a pod
+// only records the count, later calls count the restarts since the previous call.
+func (e *Engine) Restarts(pod Pod, restarts int32, reason string) {
+	e.mu.Lock()
+	key := pod.Namespace + "/" + pod.Name
+	previous, known := e.restarts[key]
+	e.restarts[key] = restarts
+	e.mu.Unlock()
+	if !known || restarts <= previous {
+		return
+	}
+	message := fmt.Sprintf("restarted %d times", restarts)
+	if reason != "" {
+		message += ", last reason " + reason
+	}
+	for i := range e.rules {
+		r := &e.rules[i]
+		if r.Event != EventRestart || !r.applies(pod) {
+			continue
+		}
+		if r.re != nil && !r.re.MatchString(reason) {
+			continue
+		}
+		for n := previous; n < restarts; n++ {
+			e.hit(r, pod, message)
+		}
+	}
+}
+
+// hit records a match of the rule and fires it once the threshold is reached within the window.
+// Hits are counted per owner, or per pod for pods without one.
+func (e *Engine) hit(r *Rule, pod Pod, message string) {
+	scope := pod.Owner
+	if scope == "" {
+		scope = pod.Name
+	}
+	key := r.Name + "\x00" + pod.Namespace + "/" + scope
+	now := e.now()
+	e.mu.Lock()
+	hits := append(e.hits[key], now)
+	for len(hits) > 0 && now.Sub(hits[0]) > r.Window.Duration {
+		hits = hits[1:]
+	}
+	e.hits[key] = hits
+	fire := len(hits) >= r.Threshold && now.Sub(e.lastFire[key]) >= r.Cooldown.Duration
+	if fire {
+		e.lastFire[key] = now
+		e.hits[key] = nil
+	}
+	e.mu.Unlock()
+	if !fire {
+		return
+	}
+	a := Alert{Time: now, Rule: r.Name, Event: r.Event, Namespace: pod.Namespace, Pod: pod.Name, Owner: pod.Owner,
+		Count: len(hits), Window: r.Window.String(), Message: message}
+	for _, n := range r.Notify {
+		if _, ok := e.notifiers[n]; !ok {
+			continue
+		}
+		e.pending.Add(1)
+		select {
+		case e.queue <- notification{notifier: n, rule: *r, alert: a}:
+		default:
+			e.pending.Done()
+			if e.errorLog != nil {
+				e.errorLog(fmt.Errorf("%s notification of rule %s dropped, %d notifications are waiting", n, r.Name, queueSize))
+			}
+		}
+	}
+}
+
+// LineWriter splits what is written to it into lines and passes them to fn. A trailing partial line
+// is kept until its end is written.
+type LineWriter struct {
+	fn      func(string)
+	partial []byte
+}
+
+func NewLineWriter(fn func(string)) *LineWriter {
+	return &LineWriter{fn: fn}
+}
+
+func (w *LineWriter) Write(p []byte) (int, error) {
+	data := append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		w.fn(strings.TrimSuffix(string(data[:i]), "\r"))
+		data = data[i+1:]
+	}
+	w.partial = append(w.partial[:0], data...)
+	// Overlong lines are evaluated in pieces instead of growing without bound.
+	if len(w.partial) >= tail.MaxLineSize {
+		w.fn(string(w.partial))
+		w.partial = w.partial[:0]
+	}
+	return len(p), nil
+}
@@ -0,0 +1,143 @@
+package alert_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg/alert"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadRules(t *testing.T, rules string) *alert.Config {
+	path := filepath.Join(t.TempDir(), "alerts.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(rules), 0644))
+	c, err := alert.Load(path)
+	require.NoError(t, err)
+	return c
+}
+
+func TestWebhookAlerts(t *testing.T) {
+	var mu sync.Mutex
+	received := make([]alert.Alert, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a alert.Alert
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&a))
+		mu.Lock()
+		received = append(received, a)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	c := loadRules(t, `
+webhook: `+server.URL+`
+rules:
+- name: refused
+  match: connection refused
+  owner: deployment/api
+  threshold: 2
+  window: 1m
+  notify: [webhook]
+- name: restarts
+  event: restart
+  notify: [webhook]
+`)
+	e := alert.NewEngine(c, alert.Notifiers(filepath.Join(t.TempDir(), alert.LogName)), func(err error) { t.Error(err) })
+	api := alert.Pod{Namespace: "shop", Name: "api-1", Owner: "deployment/api"}
+	w := alert.NewLineWriter(func(line string) { e.Line(api, line) })
+	_, err := w.Write([]byte("dial: connection refused\nok\ndial: connec"))
+	require.NoError(t, err)
+	assert.Empty(t, received, "below the threshold")
+	_, err = w.Write([]byte("tion refused\n"))
+	require.NoError(t, err)
+	e.Line(alert.Pod{Namespace: "shop", Name: "web-1", Owner: "deployment/web"}, "connection refused")
+
+	e.Restarts(api, 3, "")
+	e.Restarts(api, 4, "OOMKilled")
+
+	e.Wait()
+	require.Len(t, received, 2)
+	assert.Equal(t, "refused", received[0].Rule)
+	assert.Equal(t, 2, received[0].Count)
+	assert.Equal(t, "dial: connection refused", received[0].Message)
+	assert.Equal(t, "restarts", received[1].Rule)
+	assert.Contains(t, received[1].Message, "OOMKilled")
+}
+
+func TestSlowNotifier(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	received := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		mu.Lock()
+		received++
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	c := loadRules(t, `
+webhook: `+server.URL+`
+rules:
+- match: "panic:"
+  notify: [webhook]
+`)
+	e := alert.NewEngine(c, alert.Notifiers(filepath.Join(t.TempDir(), alert.LogName)), func(err error) { t.Error(err) })
+	done := make(chan struct{})
+	go func() {
+		for _, pod := range []string{"api-1", "api-2", "api-3"} {
+			e.Line(alert.Pod{Namespace: "shop", Name: pod}, "panic: boom")
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the lines wait for the webhook")
+	}
+	close(release)
+	e.Wait()
+	assert.Equal(t, 3, received)
+}
+
+func TestAlertsLog(t *testing.T) {
+	c := loadRules(t, `
+rules:
+- match: "panic:"
+`)
+	logPath := filepath.Join(t.TempDir(), alert.LogName)
+	e := alert.NewEngine(c, alert.Notifiers(logPath), func(err error) { t.Error(err) })
+	e.Line(alert.Pod{Namespace: "shop", Name: "api-1"}, "panic: boom")
+	e.Line(alert.Pod{Namespace: "shop", Name: "api-1"}, "panic: again")
+	e.Wait()
+
+	f, err := os.Open(logPath)
+	require.NoError(t, err)
+	defer f.Close()
+	alerts, err := alert.ReadLog(f)
+	require.NoError(t, err)
+	require.Len(t, alerts, 1, "the second match is within the cooldown")
+	assert.Equal(t, "rule-1", alerts[0].Rule)
+	assert.Equal(t, "panic: boom", alerts[0].Message)
+}
+
+func TestLoadInvalidRules(t *testing.T) {
+	for _, rules := range []string{
+		"rules:\n- name: a\n",
+		"rules:\n- match: '('\n",
+		"rules:\n- match: x\n  notify: [webhook]\n",
+		"rules:\n- match: x\n  notify: [pager]\n",
+		"rules:\n- match: x\n  window: soon\n",
+	} {
+		path := filepath.Join(t.TempDir(), "alerts.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(rules), 0644))
+		_, err := alert.Load(path)
+		assert.Error(t, err, rules)
+	}
+}
@@ -0,0 +1,97 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg/tail"
+)
+
+// LogName is the name of the alerts log at the root of the store.
+const LogName = "alerts.log"
+
+// Webhook posts every alert as JSON to URL.
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+func (w Webhook) Notify(a Alert) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Post(w.URL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s answered %s", w.URL, resp.Status)
+	}
+	return nil
+}
+
+// Desktop shows alerts as desktop notifications with notify-send.
+type Desktop struct{}
+
+func (Desktop) Notify(a Alert) error {
+	return exec.Command("notify-send", "--urgency=critical", "--app-name=k8sdebug", "k8sdebug: "+a.Rule, a.String()).Run()
+}
+
+// Log appends alerts as JSON lines to a file.
+type Log struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (l *Log) Notify(a Alert) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.OpenFile(l.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// ReadLog returns the alerts of an alerts log in the order they fired. Malformed lines are skipped.
+func ReadLog(r io.Reader) ([]Alert, error) {
+	alerts := make([]Alert, 0)
+	scanner := tail.NewScanner(r)
+	for scanner.Scan() {
+		var a Alert
+		if err := json.Unmarshal(scanner.Bytes(), &a); err == nil {
+			alerts = append(alerts, a)
+		}
+	}
+	return alerts, scanner.Err()
+}
+
+// Notifiers returns the notifiers of the recorder, writing the alerts log to logPath.
+func Notifiers(logPath string) map[string]func(Rule) Notifier {
+	log := &Log{Path: logPath}
+	return map[string]func(Rule) Notifier{
+		NotifyWebhook: func(r Rule) Notifier { return Webhook{URL: r.Webhook} },
+		NotifyDesktop: func(Rule) Notifier { return Desktop{} },
+		NotifyLog:     func(Rule) Notifier { return log },
+	}
+}
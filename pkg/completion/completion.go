@@ -0,0 +1,165 @@
+// Package completion suggests namespaces, owner kinds and names for shell completion, from the recorded store
+// and from the cluster of the current kubeconfig.
+package completion
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Kinds are the values of --type: single pods and the owners the recorder writes metadata for.
+var Kinds = []string{"pod", "replicaset", "deployment"}
+
+// Timeout bounds every request to the cluster so that an unreachable cluster does not hang the shell.
+const Timeout = 2 * time.Second
+
+// Completer lists names from a store and, when Client is set, from the cluster.
+// Errors are ignored: completion suggests whatever it can find.
+type Completer struct {
+	Store  *store.Store
+	Client kubernetes.Interface
+}
+
+// New returns a completer of the store and of the cluster of the current kubeconfig, if there is one.
+func New(s *store.Store) *Completer {
+	c := &Completer{Store: s}
+	kubeconfig := clientcmd.NewDefaultClientConfigLoadingRules().GetDefaultFilename()
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return c
+	}
+	config.Timeout = Timeout
+	if cs, err := kubernetes.NewForConfig(config); err == nil {
+		c.Client = cs
+	}
+	return c
+}
+
+// Namespaces returns the recorded namespaces and the namespaces of the cluster.
+func (c *Completer) Namespaces() []string {
+	names, _ := c.Store.Namespaces()
+	if c.Client != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		if list, err := c.Client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{}); err == nil {
+			for _, ns := range list.Items {
+				names = append(names, ns.Name)
+			}
+		}
+	}
+	return unique(names)
+}
+
+// Kinds returns the known kinds and the kinds of the owners recorded in the namespace.
+func (c *Completer) Kinds(namespace string) []string {
+	kinds := append([]string{}, Kinds...)
+	owners, _ := c.Store.Owners(namespace)
+	for _, o := range owners {
+		kinds = append(kinds, o.Kind)
+	}
+	return unique(kinds)
+}
+
+// Names returns the names of the pods, for the pod kind, or of the owners of the kind in the namespace.
+func (c *Completer) Names(namespace, kind string) []string {
+	if kind == "pod" {
+		return c.Pods(namespace)
+	}
+	var names []string
+	owners, _ := c.Store.Owners(namespace)
+	for _, o := range owners {
+		if o.Kind == kind {
+			names = append(names, o.Name)
+		}
+	}
+	if c.Client != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		switch kind {
+		case "deployment":
+			if list, err := c.Client.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{}); err == nil {
+				for _, d := range list.Items {
+					names = append(names, d.Name)
+				}
+			}
+		case "replicaset":
+			if list, err := c.Client.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{}); err == nil {
+				for _, rs := range list.Items {
+					names = append(names, rs.Name)
+				}
+			}
+		}
+	}
+	return unique(names)
+}
+
+// Pods returns the recorded pods and the pods of the cluster in the namespace.
+func (c *Completer) Pods(namespace string) []string {
+	var names []string
+	pods, _ := c.Store.AllPods(namespace)
+	for _, p := range pods {
+		names = append(names, p.Name)
+	}
+	if c.Client != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		if list, err := c.Client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{}); err == nil {
+			for _, p := range list.Items {
+				names = append(names, p.Name)
+			}
+		}
+	}
+	return unique(names)
+}
+
+// Owners returns the recorded owners of the namespace as kind/name.
+func (c *Completer) Owners(namespace string) []string {
+	var names []string
+	owners, _ := c.Store.Owners(namespace)
+	for _, o := range owners {
+		names = append(names, o.String())
+	}
+	return unique(names)
+}
+
+// Values returns the values starting with toComplete, for a ValidArgsFunction or a flag completion function.
+// Values are never files. After a comma, the last element of a list flag like --owners a,b is completed.
+func Values(values []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	prefix := ""
+	if i := strings.LastIndex(toComplete, ","); i >= 0 {
+		prefix, toComplete = toComplete[:i+1], toComplete[i+1:]
+	}
+	var matches []string
+	for _, v := range values {
+		if strings.HasPrefix(v, toComplete) {
+			matches = append(matches, prefix+v)
+		}
+	}
+	return matches, cobra.ShellCompDirectiveNoFileComp
+}
+
+// Fixed completes a flag or argument with a fixed set of values.
+func Fixed(values ...string) cobra.CompletionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return Values(values, toComplete)
+	}
+}
+
+func unique(names []string) []string {
+	sort.Strings(names)
+	out := names[:0]
+	for i, n := range names {
+		if i == 0 || n != names[i-1] {
+			out = append(out, n)
+		}
+	}
+	return out
+}
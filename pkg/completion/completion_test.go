@@ -0,0 +1,73 @@
+package completion_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/revolyssup/k8sdebug/pkg/completion"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newCompleter(t *testing.T) *completion.Completer {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "shop"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, ".archives"), 0755))
+	files := map[string]string{
+		"deployment.api.metadata":     "2025-01-02 15:00:00 ; api-1 ; api-5d4 ; 1\n",
+		"statefulset.db.metadata":     "2025-01-02 15:00:00 ; db-0\n",
+		"api-1.log":                   "",
+		"db-0.log":                    "",
+		"debug.log":                   "",
+		"replicaset.api-5d4.metadata": "2025-01-02 15:00:00 ; api-1\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(root, "shop", name), []byte(content), 0644))
+	}
+	client := fake.NewSimpleClientset(
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop"}},
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system"}},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "api-2"}},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "api-1"}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web"}},
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "api-6e5"}},
+	)
+	return &completion.Completer{Store: store.New(root), Client: client}
+}
+
+func TestCompleter(t *testing.T) {
+	c := newCompleter(t)
+	assert.Equal(t, []string{"kube-system", "shop"}, c.Namespaces())
+	assert.Equal(t, []string{"deployment", "pod", "replicaset", "statefulset"}, c.Kinds("shop"))
+	assert.Equal(t, []string{"api-1", "api-2", "db-0", "debug"}, c.Pods("shop"))
+	assert.Equal(t, c.Pods("shop"), c.Names("shop", "pod"))
+	assert.Equal(t, []string{"api", "web"}, c.Names("shop", "deployment"))
+	assert.Equal(t, []string{"api-5d4", "api-6e5"}, c.Names("shop", "replicaset"))
+	assert.Equal(t, []string{"db"}, c.Names("shop", "statefulset"), "other kinds are only completed from the store")
+	assert.Equal(t, []string{"deployment/api", "replicaset/api-5d4", "statefulset/db"}, c.Owners("shop"))
+	assert.Empty(t, c.Names("nope", "deployment"))
+
+	c.Client = nil
+	assert.Equal(t, []string{"shop"}, c.Namespaces(), "without a cluster only the store is read")
+	assert.Equal(t, []string{"api-1", "db-0", "debug"}, c.Pods("shop"))
+}
+
+func TestValues(t *testing.T) {
+	values := []string{"deployment/api", "deployment/web", "pod/debug"}
+	matches, directive := completion.Values(values, "dep")
+	assert.Equal(t, []string{"deployment/api", "deployment/web"}, matches)
+	assert.Equal(t, cobra.ShellCompDirectiveNoFileComp, directive)
+
+	matches, _ = completion.Values(values, "deployment/api,p")
+	assert.Equal(t, []string{"deployment/api,pod/debug"}, matches, "the last element of a list is completed")
+
+	matches, _ = completion.Fixed("error", "warn", "info")(nil, nil, "")
+	assert.Equal(t, []string{"error", "warn", "info"}, matches)
+}
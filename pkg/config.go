@@ -1,19 +1,31 @@
 package pkg
 
 import (
-	"bufio"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+
+	"github.com/revolyssup/k8sdebug/pkg/config"
+	"golang.org/x/term"
+	"sigs.k8s.io/yaml"
 )
 
+// ConfigFilePath is the config file of the user, see package config. The other files of k8sdebug are kept next to it.
 var ConfigFilePath string
 
+// StatePath is the file keeping the runtime state: the PID of the recorder and the active workspace.
+var StatePath string
+
+// Settings are the resolved settings, see package config.
+var Settings = config.Default()
+
+// Keys of the .env file of older versions.
 const (
 	LOGGER_PID = "LOGGER_PID"
 	LOGS_PATH  = "LOGS_PATH"
+	WORKSPACE  = "WORKSPACE"
 )
 
 type Color string
@@ -28,13 +40,29 @@ const (
 type Config struct {
 	LogsPath  string
 	LoggerPID int
+	// Workspace is the workspace selected with workspace use, empty for the live store.
+	Workspace string
 }
 
 var ConfigData Config = Config{
-	LogsPath: "/tmp/k8sdebug/logs",
+	LogsPath: Settings.LogsPath,
+}
+
+// ColorsEnabled is false when stdout is not a terminal, NO_COLOR is set or a machine-readable output format was selected.
+var ColorsEnabled = term.IsTerminal(int(os.Stdout.Fd())) && os.Getenv("NO_COLOR") == ""
+
+// Colorize wraps s in the color, or returns it unchanged when colors are disabled.
+func Colorize(s string, color Color) string {
+	if !ColorsEnabled {
+		return s
+	}
+	return string(color) + s + string(ColorReset)
 }
 
 func ColorizeDiff(diff string) string {
+	if !ColorsEnabled {
+		return diff + "\n"
+	}
 	var b strings.Builder
 	lines := strings.Split(diff, "\n")
 
@@ -60,60 +88,118 @@ func ColorLine(s string, color Color) string {
 	var b strings.Builder
 	lines := strings.Split(s, "\n")
 	for _, line := range lines {
-		b.WriteString(string(color))
-		b.WriteString(line)
-		b.WriteString(string(ColorReset) + "\n")
+		b.WriteString(Colorize(line, color) + "\n")
 
 	}
 	return b.String()
 }
 
-func init() {
-	home, err := os.UserHomeDir()
+// LoadConfig resolves the settings of the working directory with the profile, or the profile selected by the
+// environment and the config files if it is empty, and creates the logs directory.
+func LoadConfig(profile string) (*config.Loaded, error) {
+	dir, err := os.Getwd()
 	if err != nil {
-		panic(fmt.Errorf("failed to get home directory: %w", err))
+		return nil, err
 	}
-	ConfigFilePath = filepath.Join(home, ".k8sdebug", ".env")
-	if _, err := os.Stat(ConfigFilePath); os.IsNotExist(err) {
-		if err := os.MkdirAll(filepath.Dir(ConfigFilePath), 0755); err != nil {
-			panic(fmt.Errorf("failed to create config directory: %w", err))
-		}
-		if err := os.WriteFile(ConfigFilePath, []byte(""), 0644); err != nil {
-			panic(fmt.Errorf("failed to create config file: %w", err))
-		}
-	}
-	file, err := os.Open(ConfigFilePath)
+	loaded, err := config.Resolve(ConfigFilePath, dir, profile, os.Getenv)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	defer file.Close()
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" {
-			continue
+	Settings = loaded.Settings
+	ConfigData.LogsPath = Settings.LogsPath
+	if err := os.MkdirAll(ConfigData.LogsPath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	return loaded, nil
+}
+
+// State is the runtime state shared by the k8sdebug processes, kept apart from the user configuration.
+type State struct {
+	LoggerPID int    `json:"loggerPID,omitempty"`
+	Workspace string `json:"workspace,omitempty"`
+}
+
+// UpdateState applies fn to the state in the state file. The file is locked from the read to the write, so the
+// keys fn does not change keep the values other processes wrote. ConfigData is updated with the result.
+func UpdateState(fn func(s *State)) error {
+	return config.Update(StatePath, func(data []byte) ([]byte, error) {
+		var s State
+		if err := yaml.Unmarshal(data, &s); err != nil {
+			return nil, fmt.Errorf("%s: %v", StatePath, err)
 		}
-		vars := strings.Split(line, "=")
-		if len(vars) != 2 {
+		fn(&s)
+		ConfigData.LoggerPID, ConfigData.Workspace = s.LoggerPID, s.Workspace
+		return yaml.Marshal(s)
+	})
+}
+
+// SetLoggerPID records the PID of the running recorder, 0 once it is stopped.
+func SetLoggerPID(pid int) error {
+	return UpdateState(func(s *State) { s.LoggerPID = pid })
+}
+
+// SetWorkspace records the active workspace, empty for the live store.
+func SetWorkspace(name string) error {
+	return UpdateState(func(s *State) { s.Workspace = name })
+}
+
+// migrateEnv moves the settings and state of the .env file of older versions to the config and state files.
+func migrateEnv(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var pid int
+	var workspace string
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
 			continue
 		}
-		key := strings.TrimSpace(vars[0])
-		value := strings.TrimSpace(vars[1])
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
 		switch key {
-		case "LOGS_PATH":
-			ConfigData.LogsPath = value
-		case "LOGGER_PID":
-			pid, err := strconv.Atoi(value)
-			if err != nil {
-				panic(fmt.Errorf("failed to parse LOGGER_PID: %w", err))
+		case LOGS_PATH:
+			if _, err := os.Stat(ConfigFilePath); os.IsNotExist(err) {
+				if err := config.Set(ConfigFilePath, "", "logsPath", value, nil); err != nil {
+					return err
+				}
 			}
-			ConfigData.LoggerPID = pid
-		default:
-			continue
+		case LOGGER_PID:
+			if pid, err = strconv.Atoi(value); err != nil {
+				return fmt.Errorf("failed to parse LOGGER_PID: %w", err)
+			}
+		case WORKSPACE:
+			workspace = value
 		}
 	}
+	if err := UpdateState(func(s *State) { s.LoggerPID, s.Workspace = pid, workspace }); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
 
-	if err := os.MkdirAll(ConfigData.LogsPath, 0755); err != nil {
-		panic(fmt.Errorf("failed to create directory: %w", err))
+func init() {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		panic(fmt.Errorf("failed to get home directory: %w", err))
+	}
+	dir := filepath.Join(home, ".k8sdebug")
+	ConfigFilePath = filepath.Join(dir, "config.yaml")
+	StatePath = filepath.Join(dir, "state.yaml")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		panic(fmt.Errorf("failed to create config directory: %w", err))
+	}
+	if err := migrateEnv(filepath.Join(dir, ".env")); err != nil {
+		panic(fmt.Errorf("failed to migrate %s: %w", filepath.Join(dir, ".env"), err))
+	}
+	// The state file is replaced atomically, it can be read without the lock.
+	if data, err := os.ReadFile(StatePath); err == nil {
+		var s State
+		if err := yaml.Unmarshal(data, &s); err != nil {
+			panic(fmt.Errorf("failed to parse %s: %w", StatePath, err))
+		}
+		ConfigData.LoggerPID, ConfigData.Workspace = s.LoggerPID, s.Workspace
 	}
+	// An invalid config leaves the defaults in place, the root command reports the error.
+	LoadConfig("")
 }
@@ -0,0 +1,308 @@
+// Package config resolves the settings of k8sdebug from the user config file, the project file of the working
+// directory, the selected profile and the environment.
+//
+// Precedence, lowest first: built-in defaults, ~/.k8sdebug/config.yaml, the nearest .k8sdebug.yaml found upward
+// from the working directory, the selected profile, K8SDEBUG_* environment variables and command-line flags.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+
+	"github.com/revolyssup/k8sdebug/pkg/output"
+	"github.com/revolyssup/k8sdebug/pkg/retention"
+	"sigs.k8s.io/yaml"
+)
+
+// ProjectFile is the name of the per-project config file.
+const ProjectFile = ".k8sdebug.yaml"
+
+// Settings are the values a config file, a profile or the environment can set. Empty fields are left to the
+// layers below.
+type Settings struct {
+	// LogsPath is the directory of the live store the recorder writes to.
+	LogsPath string `json:"logsPath,omitempty"`
+	// Namespace is the default of --namespace.
+	Namespace string `json:"namespace,omitempty"`
+	// Output is the default of --output: text, json, yaml or jsonl.
+	Output      string      `json:"output,omitempty"`
+	PortForward PortForward `json:"portForward,omitempty"`
+	// Redact rules are applied to every line printed by the logs commands.
+	Redact    []Redaction `json:"redact,omitempty"`
+	Retention Retention   `json:"retention,omitempty"`
+}
+
+// PortForward holds the defaults of the port-forward flags.
+type PortForward struct {
+	Policy        string `json:"policy,omitempty"`
+	HostPort      string `json:"hostPort,omitempty"`
+	ContainerPort string `json:"containerPort,omitempty"`
+}
+
+// Redaction replaces the matches of a regular expression.
+type Redaction struct {
+	Name  string `json:"name,omitempty"`
+	Match string `json:"match"`
+	// Replace may refer to groups of Match as $1. Defaults to ***.
+	Replace string `json:"replace,omitempty"`
+}
+
+// Retention is the policy applied by logs cleanup when no policy flag is given. See logs cleanup --help.
+// KeepRevisions and Gone are pointers so that a layer can turn them off with 0 and false.
+type Retention struct {
+	OlderThan     string `json:"olderThan,omitempty"`
+	MaxSize       string `json:"maxSize,omitempty"`
+	KeepRevisions *int   `json:"keepRevisions,omitempty"`
+	Gone          *bool  `json:"gone,omitempty"`
+}
+
+// Revisions returns the number of revisions to keep, 0 when unset.
+func (r Retention) Revisions() int {
+	if r.KeepRevisions == nil {
+		return 0
+	}
+	return *r.KeepRevisions
+}
+
+// DeleteGone reports whether gone is set to true.
+func (r Retention) DeleteGone() bool {
+	return r.Gone != nil && *r.Gone
+}
+
+// Empty reports whether no retention rule is enabled.
+func (r Retention) Empty() bool {
+	return r.OlderThan == "" && r.MaxSize == "" && r.Revisions() == 0 && !r.DeleteGone()
+}
+
+// File is the content of a config file: settings, named profiles and the profile selected by default.
+type File struct {
+	Settings
+	Profile  string              `json:"profile,omitempty"`
+	Profiles map[string]Settings `json:"profiles,omitempty"`
+}
+
+// Env maps the environment variables overriding settings to the key they set.
+var Env = map[string]string{
+	"K8SDEBUG_LOGS_PATH": "logsPath",
+	"K8SDEBUG_NAMESPACE": "namespace",
+	"K8SDEBUG_OUTPUT":    "output",
+	"K8SDEBUG_POLICY":    "portForward.policy",
+}
+
+// ProfileEnv selects the profile, unless --profile is given.
+const ProfileEnv = "K8SDEBUG_PROFILE"
+
+// Default returns the built-in settings.
+func Default() Settings {
+	return Settings{
+		LogsPath:    "/tmp/k8sdebug/logs",
+		Namespace:   "default",
+		Output:      output.Text,
+		PortForward: PortForward{Policy: "round-robin", HostPort: "3000", ContainerPort: "80"},
+	}
+}
+
+// Merge returns s overridden by the non-empty fields of o, and by the pointer fields o sets, even to their zero value.
+func (s Settings) Merge(o Settings) Settings {
+	set := func(dst *string, v string) {
+		if v != "" {
+			*dst = v
+		}
+	}
+	set(&s.LogsPath, o.LogsPath)
+	set(&s.Namespace, o.Namespace)
+	set(&s.Output, o.Output)
+	set(&s.PortForward.Policy, o.PortForward.Policy)
+	set(&s.PortForward.HostPort, o.PortForward.HostPort)
+	set(&s.PortForward.ContainerPort, o.PortForward.ContainerPort)
+	if o.Redact != nil {
+		s.Redact = o.Redact
+	}
+	set(&s.Retention.OlderThan, o.Retention.OlderThan)
+	set(&s.Retention.MaxSize, o.Retention.MaxSize)
+	if o.Retention.KeepRevisions != nil {
+		s.Retention.KeepRevisions = o.Retention.KeepRevisions
+	}
+	if o.Retention.Gone != nil {
+		s.Retention.Gone = o.Retention.Gone
+	}
+	return s
+}
+
+// Validate checks the values that are set. policies are the valid port-forward policies, nil skips the check.
+func (s Settings) Validate(policies []string) error {
+	var errs []error
+	switch s.Output {
+	case "", output.Text, output.JSON, output.YAML, output.JSONL:
+	default:
+		errs = append(errs, fmt.Errorf("output: unknown format %q, use one of text, json, yaml or jsonl", s.Output))
+	}
+	if p := s.PortForward.Policy; p != "" && policies != nil && !slices.Contains(policies, p) {
+		errs = append(errs, fmt.Errorf("portForward.policy: unknown policy %q, use one of %v", p, policies))
+	}
+	for i, r := range s.Redact {
+		if r.Match == "" {
+			errs = append(errs, fmt.Errorf("redact[%d]: match is required", i))
+		} else if _, err := regexp.Compile(r.Match); err != nil {
+			errs = append(errs, fmt.Errorf("redact[%d]: %v", i, err))
+		}
+	}
+	if s.Retention.OlderThan != "" {
+		if _, err := retention.ParseAge(s.Retention.OlderThan); err != nil {
+			errs = append(errs, fmt.Errorf("retention.olderThan: %v", err))
+		}
+	}
+	if s.Retention.MaxSize != "" {
+		if _, err := retention.ParseSize(s.Retention.MaxSize); err != nil {
+			errs = append(errs, fmt.Errorf("retention.maxSize: %v", err))
+		}
+	}
+	if s.Retention.Revisions() < 0 {
+		errs = append(errs, errors.New("retention.keepRevisions: must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks the settings of the file and of its profiles.
+func (f *File) Validate(policies []string) error {
+	errs := []error{f.Settings.Validate(policies)}
+	for _, name := range f.profileNames() {
+		if err := f.Profiles[name].Validate(policies); err != nil {
+			errs = append(errs, fmt.Errorf("profile %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f *File) profileNames() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Redactor returns a function applying the redaction rules to a line, nil without rules.
+func (s Settings) Redactor() (func(string) string, error) {
+	if len(s.Redact) == 0 {
+		return nil, nil
+	}
+	res := make([]*regexp.Regexp, len(s.Redact))
+	for i, r := range s.Redact {
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return nil, fmt.Errorf("redact[%d]: %v", i, err)
+		}
+		res[i] = re
+	}
+	return func(line string) string {
+		for i, re := range res {
+			replace := s.Redact[i].Replace
+			if replace == "" {
+				replace = "***"
+			}
+			line = re.ReplaceAllString(line, replace)
+		}
+		return line
+	}, nil
+}
+
+// ReadFile parses a config file. Unknown keys are an error.
+func ReadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f File
+	if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &f, nil
+}
+
+// FindProject returns the nearest project file in dir or its parents, or an empty string.
+func FindProject(dir string) string {
+	for {
+		path := filepath.Join(dir, ProjectFile)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// Loaded is the result of a resolution with what it was resolved from.
+type Loaded struct {
+	Settings Settings `json:"settings"`
+	// Profile is the selected profile, empty if none.
+	Profile string `json:"profile,omitempty"`
+	// Files are the config files read, lowest precedence first.
+	Files []string `json:"files"`
+	// Env are the environment variables that overrode settings.
+	Env []string `json:"env,omitempty"`
+}
+
+// Resolve merges the defaults, the user file at userPath, the project file found from dir, the profile and the
+// environment. profile overrides the profile selected by the environment and the files. Missing files are skipped.
+func Resolve(userPath, dir, profile string, getenv func(string) string) (*Loaded, error) {
+	loaded := &Loaded{Settings: Default(), Files: []string{}}
+	var files []*File
+	for _, path := range []string{userPath, FindProject(dir)} {
+		if path == "" {
+			continue
+		}
+		f, err := ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+		loaded.Files = append(loaded.Files, path)
+		loaded.Settings = loaded.Settings.Merge(f.Settings)
+	}
+	if profile == "" {
+		profile = getenv(ProfileEnv)
+	}
+	for i := len(files) - 1; i >= 0 && profile == ""; i-- {
+		profile = files[i].Profile
+	}
+	if profile != "" {
+		found := false
+		for _, f := range files {
+			if p, ok := f.Profiles[profile]; ok {
+				loaded.Settings = loaded.Settings.Merge(p)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("profile %s is not defined in %v", profile, loaded.Files)
+		}
+		loaded.Profile = profile
+	}
+	names := make([]string, 0, len(Env))
+	for name := range Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if v := getenv(name); v != "" {
+			if err := setKey(&loaded.Settings, Env[name], v); err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+			loaded.Env = append(loaded.Env, name)
+		}
+	}
+	return loaded, nil
+}
@@ -0,0 +1,184 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/revolyssup/k8sdebug/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var policies = []string{"round-robin", "sticky"}
+
+func write(t *testing.T, path, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func env(vars map[string]string) func(string) string {
+	return func(name string) string { return vars[name] }
+}
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	user := filepath.Join(dir, "home", "config.yaml")
+	write(t, user, `
+logsPath: /var/logs
+namespace: shop
+retention:
+  olderThan: 7d
+profile: staging
+profiles:
+  staging:
+    namespace: shop-staging
+  prod:
+    namespace: shop-prod
+    portForward:
+      policy: sticky
+`)
+	project := filepath.Join(dir, "project")
+	write(t, filepath.Join(project, config.ProjectFile), `
+output: json
+profiles:
+  staging:
+    logsPath: /var/staging
+`)
+	workdir := filepath.Join(project, "src", "api")
+	require.NoError(t, os.MkdirAll(workdir, 0755))
+	assert.Equal(t, filepath.Join(project, config.ProjectFile), config.FindProject(workdir))
+
+	loaded, err := config.Resolve(user, workdir, "", env(nil))
+	require.NoError(t, err)
+	assert.Equal(t, "staging", loaded.Profile, "the profile of the user file is selected")
+	assert.Equal(t, []string{user, filepath.Join(project, config.ProjectFile)}, loaded.Files)
+	want := config.Default()
+	want.LogsPath = "/var/staging"
+	want.Namespace = "shop-staging"
+	want.Output = "json"
+	want.Retention.OlderThan = "7d"
+	assert.Equal(t, want, loaded.Settings, "a profile defined in both files merges both definitions")
+
+	loaded, err = config.Resolve(user, workdir, "", env(map[string]string{config.ProfileEnv: "prod", "K8SDEBUG_NAMESPACE": "from-env"}))
+	require.NoError(t, err)
+	assert.Equal(t, "prod", loaded.Profile)
+	assert.Equal(t, "from-env", loaded.Settings.Namespace, "the environment overrides the profile")
+	assert.Equal(t, "sticky", loaded.Settings.PortForward.Policy)
+	assert.Equal(t, "/var/logs", loaded.Settings.LogsPath)
+	assert.Equal(t, []string{"K8SDEBUG_NAMESPACE"}, loaded.Env)
+
+	loaded, err = config.Resolve(user, workdir, "prod", env(map[string]string{config.ProfileEnv: "staging"}))
+	require.NoError(t, err)
+	assert.Equal(t, "prod", loaded.Profile, "the profile argument overrides the environment")
+
+	_, err = config.Resolve(user, workdir, "dev", env(nil))
+	assert.ErrorContains(t, err, "profile dev is not defined")
+
+	loaded, err = config.Resolve(filepath.Join(dir, "missing.yaml"), dir, "", env(nil))
+	require.NoError(t, err)
+	assert.Equal(t, config.Default(), loaded.Settings)
+	assert.Empty(t, loaded.Files)
+
+	write(t, user, "namespace: shop\nnamspace: typo\n")
+	_, err = config.Resolve(user, dir, "", env(nil))
+	assert.ErrorContains(t, err, "namspace", "unknown keys are an error")
+}
+
+func TestResolveRetention(t *testing.T) {
+	dir := t.TempDir()
+	user := filepath.Join(dir, "config.yaml")
+	write(t, user, `
+retention:
+  keepRevisions: 3
+  gone: true
+profiles:
+  keep-all:
+    retention:
+      keepRevisions: 0
+      gone: false
+  more:
+    retention:
+      keepRevisions: 5
+`)
+	loaded, err := config.Resolve(user, dir, "", env(nil))
+	require.NoError(t, err)
+	assert.Equal(t, 3, loaded.Settings.Retention.Revisions())
+	assert.True(t, loaded.Settings.Retention.DeleteGone())
+
+	loaded, err = config.Resolve(user, dir, "keep-all", env(nil))
+	require.NoError(t, err)
+	assert.Equal(t, 0, loaded.Settings.Retention.Revisions(), "a profile can reset keepRevisions")
+	assert.False(t, loaded.Settings.Retention.DeleteGone(), "a profile can turn gone off")
+	assert.True(t, loaded.Settings.Retention.Empty())
+
+	loaded, err = config.Resolve(user, dir, "more", env(nil))
+	require.NoError(t, err)
+	assert.Equal(t, 5, loaded.Settings.Retention.Revisions())
+	assert.True(t, loaded.Settings.Retention.DeleteGone(), "unset fields are left to the layers below")
+}
+
+func TestSet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, config.Set(path, "", "namespace", "shop", policies))
+	require.NoError(t, config.Set(path, "", "retention.keepRevisions", "3", policies))
+	require.NoError(t, config.Set(path, "staging", "portForward.policy", "sticky", policies))
+	require.NoError(t, config.Set(path, "staging", "retention.gone", "true", policies))
+	require.NoError(t, config.Set(path, "", "profile", "staging", policies))
+	f, err := config.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "shop", f.Namespace)
+	assert.Equal(t, 3, f.Retention.Revisions())
+	assert.Equal(t, "staging", f.Profile)
+	assert.Equal(t, "sticky", f.Profiles["staging"].PortForward.Policy)
+	assert.True(t, f.Profiles["staging"].Retention.DeleteGone())
+
+	require.NoError(t, config.Set(path, "", "namespace", "", policies))
+	f, err = config.ReadFile(path)
+	require.NoError(t, err)
+	assert.Empty(t, f.Namespace, "an empty value removes the key")
+
+	assert.ErrorContains(t, config.Set(path, "", "retention.keepRevisions", "many", policies), "not a number")
+	assert.ErrorContains(t, config.Set(path, "", "portForward.policy", "random", policies), "unknown policy")
+	assert.ErrorContains(t, config.Set(path, "", "retention.maxSize", "huge", policies), "retention.maxSize")
+	assert.ErrorContains(t, config.Set(path, "", "colour", "red", policies), "unknown key")
+	assert.ErrorContains(t, config.Set(path, "", "redact", "x", policies), "edit the config file")
+	assert.ErrorContains(t, config.Set(path, "staging", "profile", "prod", policies), "cannot be set in a profile")
+	f, err = config.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 3, f.Retention.Revisions(), "a rejected value leaves the file unchanged")
+}
+
+func TestValidate(t *testing.T) {
+	f := config.File{
+		Settings: config.Settings{Output: "xml", Redact: []config.Redaction{{Match: "("}, {}}},
+		Profiles: map[string]config.Settings{"prod": {Retention: config.Retention{OlderThan: "soon"}}},
+	}
+	err := f.Validate(policies)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "output")
+	assert.ErrorContains(t, err, "redact[0]")
+	assert.ErrorContains(t, err, "redact[1]: match is required")
+	assert.ErrorContains(t, err, "profile prod: retention.olderThan")
+	assert.NoError(t, config.Default().Validate(policies))
+}
+
+func TestRedactor(t *testing.T) {
+	redact, err := config.Settings{}.Redactor()
+	require.NoError(t, err)
+	assert.Nil(t, redact)
+
+	redact, err = config.Settings{Redact: []config.Redaction{
+		{Match: `token=\w+`},
+		{Match: `(\w+)@example\.com`, Replace: "$1@<redacted>"},
+	}}.Redactor()
+	require.NoError(t, err)
+	assert.Equal(t, "login alice@<redacted> *** ok", redact("login alice@example.com token=abc123 ok"))
+}
+
+func TestKeys(t *testing.T) {
+	keys := config.Keys()
+	assert.Contains(t, keys, "portForward.policy")
+	assert.Contains(t, keys, "retention.keepRevisions")
+	assert.NotContains(t, keys, "redact")
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Update replaces the content of the file at path with the result of fn on its current content, nil for a missing
+// file. Concurrent updates from any process are applied one after the other: an exclusive lock on path.lock is held
+// from the read to the write, and the file is replaced atomically so that readers never see a partial write.
+// Nothing is written if fn fails or returns the content unchanged.
+func Update(path string, fn func(data []byte) ([]byte, error)) error {
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	out, err := fn(data)
+	if err != nil {
+		return err
+	}
+	if data != nil && bytes.Equal(out, data) {
+		return nil
+	}
+	return writeAtomic(path, out)
+}
+
+// writeAtomic writes to a temporary file next to path and renames it over path.
+func writeAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
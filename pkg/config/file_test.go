@@ -0,0 +1,56 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/revolyssup/k8sdebug/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.yaml")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, config.Update(path, func(data []byte) ([]byte, error) {
+				n, _ := strconv.Atoi(string(data))
+				return []byte(strconv.Itoa(n + 1)), nil
+			}))
+		}()
+	}
+	wg.Wait()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "20", string(data), "no update is lost")
+
+	before, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, config.Update(path, func(data []byte) ([]byte, error) { return data, nil }))
+	after, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(before, after), "an unchanged file is not rewritten")
+
+	assert.ErrorContains(t, config.Update(path, func(data []byte) ([]byte, error) {
+		return nil, os.ErrInvalid
+	}), "invalid")
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "20", string(data), "a failed update leaves the file unchanged")
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.ElementsMatch(t, []string{"state.yaml", "state.yaml.lock"}, names, "no temporary file is left")
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Keys returns the keys that can be set with Set, as dotted paths like retention.maxSize.
+func Keys() []string {
+	keys := []string{"profile"}
+	var walk func(t reflect.Type, prefix string)
+	walk = func(t reflect.Type, prefix string) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := prefix + jsonName(f)
+			switch kind(f.Type) {
+			case reflect.Struct:
+				walk(f.Type, name+".")
+			case reflect.String, reflect.Int, reflect.Bool:
+				keys = append(keys, name)
+			}
+		}
+	}
+	walk(reflect.TypeOf(Settings{}), "")
+	return keys
+}
+
+// kind is the kind of the values of t, a pointer has the kind of the value it points to.
+func kind(t reflect.Type) reflect.Kind {
+	if t.Kind() == reflect.Pointer {
+		return t.Elem().Kind()
+	}
+	return t.Kind()
+}
+
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	return name
+}
+
+// field returns the field of the settings at key.
+func field(s *Settings, key string) (reflect.Value, error) {
+	v := reflect.ValueOf(s).Elem()
+	for _, part := range strings.Split(key, ".") {
+		if v.Kind() != reflect.Struct {
+			return reflect.Value{}, fmt.Errorf("unknown key %s", key)
+		}
+		found := false
+		for i := 0; i < v.NumField(); i++ {
+			if jsonName(v.Type().Field(i)) == part {
+				v, found = v.Field(i), true
+				break
+			}
+		}
+		if !found {
+			return reflect.Value{}, fmt.Errorf("unknown key %s", key)
+		}
+	}
+	switch kind(v.Type()) {
+	case reflect.String, reflect.Int, reflect.Bool:
+		return v, nil
+	}
+	return reflect.Value{}, fmt.Errorf("%s cannot be set from the command line, edit the config file", key)
+}
+
+// parse converts value to the type of the setting at key.
+func parse(key, value string) (any, error) {
+	v, err := field(&Settings{}, key)
+	if err != nil {
+		return nil, err
+	}
+	switch kind(v.Type()) {
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q is not a number", key, value)
+		}
+		return n, nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q is not true or false", key, value)
+		}
+		return b, nil
+	}
+	return value, nil
+}
+
+func setKey(s *Settings, key, value string) error {
+	parsed, err := parse(key, value)
+	if err != nil {
+		return err
+	}
+	v, _ := field(s, key)
+	set := reflect.ValueOf(parsed)
+	if v.Kind() == reflect.Pointer {
+		ptr := reflect.New(v.Type().Elem())
+		ptr.Elem().Set(set)
+		set = ptr
+	}
+	v.Set(set)
+	return nil
+}
+
+// Set sets key to value in the config file at path, in the named profile if profile is not empty, and creates the
+// file if needed. An empty value removes the key. The other keys are kept as they are in the file at the time of the
+// write, and the file is validated before it is replaced.
+func Set(path, profile, key, value string, policies []string) error {
+	var parsed any = value
+	if key == "profile" {
+		if profile != "" {
+			return errors.New("profile selects a profile, it cannot be set in a profile")
+		}
+	} else if _, err := field(&Settings{}, key); err != nil {
+		return err
+	} else if value != "" {
+		if parsed, err = parse(key, value); err != nil {
+			return err
+		}
+	}
+	parts := strings.Split(key, ".")
+	if profile != "" {
+		parts = append([]string{"profiles", profile}, parts...)
+	}
+	return Update(path, func(data []byte) ([]byte, error) {
+		doc := map[string]any{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if doc == nil {
+			doc = map[string]any{}
+		}
+		target := doc
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := target[part].(map[string]any)
+			if !ok {
+				child = map[string]any{}
+				target[part] = child
+			}
+			target = child
+		}
+		if last := parts[len(parts)-1]; value == "" {
+			delete(target, last)
+		} else {
+			target[last] = parsed
+		}
+		out, err := yaml.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		var f File
+		if err := yaml.UnmarshalStrict(out, &f); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if err := f.Validate(policies); err != nil {
+			return nil, err
+		}
+		return out, nil
+	})
+}
@@ -0,0 +1,298 @@
+// Package crash detects abnormal container terminations and assembles crash bundles: the logs, specs, events and
+// sibling logs around a termination, kept in the store so that nobody has to reconstruct the scene by hand.
+package crash
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/revolyssup/k8sdebug/pkg/tail"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// Termination is an abnormal termination of a container.
+type Termination struct {
+	Container  string
+	ExitCode   int32
+	Reason     string
+	Restarts   int32
+	FinishedAt time.Time
+}
+
+// Tracker remembers the last termination of every container to report each new one once. It is safe for concurrent use.
+type Tracker struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{seen: make(map[string]time.Time)}
+}
+
+// Terminations returns the terminations with a non-zero exit code that happened since the previous call for the pod.
+// The first call for a container only records its last termination.
+func (t *Tracker) Terminations(pod *v1.Pod) []Termination {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var found []Termination
+	statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, c := range statuses {
+		term := c.State.Terminated
+		if last := c.LastTerminationState.Terminated; term == nil || (last != nil && last.FinishedAt.After(term.FinishedAt.Time)) {
+			term = last
+		}
+		key := pod.Namespace + "/" + pod.Name + "/" + c.Name
+		previous, known := t.seen[key]
+		if term == nil {
+			if !known {
+				t.seen[key] = time.Time{}
+			}
+			continue
+		}
+		t.seen[key] = term.FinishedAt.Time
+		if !known || term.ExitCode == 0 || !term.FinishedAt.After(previous) {
+			continue
+		}
+		found = append(found, Termination{Container: c.Name, ExitCode: term.ExitCode, Reason: term.Reason,
+			Restarts: c.RestartCount, FinishedAt: term.FinishedAt.Time})
+	}
+	return found
+}
+
+// Collector assembles crash bundles into the store.
+type Collector struct {
+	Client kubernetes.Interface
+	Store  *store.Store
+	// Lines is the number of lines kept from the end of every log.
+	Lines int
+}
+
+// Collect assembles the bundle of a termination of the pod. owner is the root owner of the pod as kind/name, its
+// recorded pods are the siblings whose log tail is kept. Parts that cannot be collected are listed in the Errors
+// of the bundle; an error is only returned if the bundle could not be written.
+func (c *Collector) Collect(ctx context.Context, pod *v1.Pod, owner string, t Termination) (store.Crash, error) {
+	id := fmt.Sprintf("%s-%s-%s", pod.Name, t.Container, t.FinishedAt.UTC().Format("20060102T150405Z"))
+	crash := store.Crash{ID: id, Namespace: pod.Namespace, Pod: pod.Name, Owner: owner, Container: t.Container,
+		ExitCode: t.ExitCode, Reason: t.Reason, Restarts: t.Restarts, FinishedAt: t.FinishedAt, CreatedAt: time.Now(),
+		Files: make([]string, 0)}
+	dir := filepath.Join(c.Store.CrashesPath(pod.Namespace), id)
+	if _, err := os.Stat(dir); err == nil {
+		return crash, fmt.Errorf("crash bundle %s already exists", id)
+	}
+	// The bundle is assembled in a hidden directory and renamed once complete.
+	tmp := filepath.Join(c.Store.CrashesPath(pod.Namespace), "."+id)
+	if err := os.MkdirAll(tmp, 0755); err != nil {
+		return crash, err
+	}
+	defer os.RemoveAll(tmp)
+	b := &bundle{dir: tmp, crash: &crash}
+
+	if current, err := c.Client.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{}); err == nil {
+		pod = current
+	} else {
+		b.fail("pod", err)
+	}
+	spec := pod.DeepCopy()
+	spec.ManagedFields = nil
+	b.writeYAML("pod.yaml", spec)
+	c.containerLogs(ctx, b, pod)
+	owners := c.owners(ctx, b, pod)
+	c.events(ctx, b, pod, owners)
+	c.siblings(b, pod, owner)
+
+	crash.Path = dir
+	sort.Strings(crash.Files)
+	data, err := json.MarshalIndent(crash, "", "  ")
+	if err != nil {
+		return crash, err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, store.CrashManifest), data, 0644); err != nil {
+		return crash, err
+	}
+	return crash, os.Rename(tmp, dir)
+}
+
+// bundle writes the files of a crash bundle and records them, or the errors, in its manifest.
+type bundle struct {
+	dir   string
+	crash *store.Crash
+}
+
+func (b *bundle) fail(part string, err error) {
+	b.crash.Errors = append(b.crash.Errors, fmt.Sprintf("%s: %v", part, err))
+}
+
+func (b *bundle) write(name string, data []byte) {
+	path := filepath.Join(b.dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		b.fail(name, err)
+		return
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		b.fail(name, err)
+		return
+	}
+	b.crash.Files = append(b.crash.Files, filepath.ToSlash(name))
+}
+
+func (b *bundle) writeYAML(name string, objects ...any) {
+	docs := make([]string, 0, len(objects))
+	for _, o := range objects {
+		data, err := yaml.Marshal(o)
+		if err != nil {
+			b.fail(name, err)
+			return
+		}
+		docs = append(docs, string(data))
+	}
+	b.write(name, []byte(strings.Join(docs, "---\n")))
+}
+
+// containerLogs keeps the last lines of the current and previous instance of every container of the pod.
+func (c *Collector) containerLogs(ctx context.Context, b *bundle, pod *v1.Pod) {
+	lines := int64(c.Lines)
+	containers := append(append([]v1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, container := range containers {
+		for _, previous := range []bool{false, true} {
+			name := filepath.Join("logs", container.Name+".log")
+			if previous {
+				name = filepath.Join("logs", container.Name+".previous.log")
+			}
+			opts := &v1.PodLogOptions{Container: container.Name, Previous: previous, TailLines: &lines}
+			data, err := c.Client.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, opts).DoRaw(ctx)
+			if err != nil {
+				// Containers that never restarted have no previous instance.
+				if !previous {
+					b.fail(name, err)
+				}
+				continue
+			}
+			b.write(name, data)
+		}
+	}
+}
+
+// owners keeps the specs of the owner chain of the pod and returns the kind/name of its members.
+func (c *Collector) owners(ctx context.Context, b *bundle, pod *v1.Pod) []string {
+	objects := make([]any, 0)
+	names := make([]string, 0)
+	ref := metav1.GetControllerOf(pod)
+	for ref != nil {
+		var obj metav1.Object
+		var err error
+		apps, batch := c.Client.AppsV1(), c.Client.BatchV1()
+		switch ref.Kind {
+		case "ReplicaSet":
+			obj, err = apps.ReplicaSets(pod.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		case "Deployment":
+			obj, err = apps.Deployments(pod.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		case "StatefulSet":
+			obj, err = apps.StatefulSets(pod.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		case "DaemonSet":
+			obj, err = apps.DaemonSets(pod.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		case "Job":
+			obj, err = batch.Jobs(pod.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		case "CronJob":
+			obj, err = batch.CronJobs(pod.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		default:
+			err = fmt.Errorf("unsupported owner kind %s", ref.Kind)
+		}
+		if err != nil {
+			b.fail("owner "+ref.Kind+"/"+ref.Name, err)
+			break
+		}
+		obj.SetManagedFields(nil)
+		objects = append(objects, obj)
+		names = append(names, ref.Kind+"/"+ref.Name)
+		ref = metav1.GetControllerOf(obj)
+	}
+	if len(objects) > 0 {
+		b.writeYAML("owner.yaml", objects...)
+	}
+	return names
+}
+
+// events keeps the events of the pod and of its owners, oldest first.
+func (c *Collector) events(ctx context.Context, b *bundle, pod *v1.Pod, owners []string) {
+	list, err := c.Client.CoreV1().Events(pod.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		b.fail("events", err)
+		return
+	}
+	related := map[string]bool{"Pod/" + pod.Name: true}
+	for _, o := range owners {
+		related[o] = true
+	}
+	events := make([]v1.Event, 0)
+	for _, e := range list.Items {
+		if related[e.InvolvedObject.Kind+"/"+e.InvolvedObject.Name] {
+			e.ManagedFields = nil
+			events = append(events, e)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return eventTime(events[i]).Before(eventTime(events[j]))
+	})
+	b.writeYAML("events.yaml", map[string]any{"events": events})
+}
+
+func eventTime(e v1.Event) time.Time {
+	if !e.LastTimestamp.IsZero() {
+		return e.LastTimestamp.Time
+	}
+	if !e.EventTime.IsZero() {
+		return e.EventTime.Time
+	}
+	return e.CreationTimestamp.Time
+}
+
+// siblings keeps the recorded log tail of the other pods of the owner that are still alive.
+func (c *Collector) siblings(b *bundle, pod *v1.Pod, owner string) {
+	if owner == "" {
+		return
+	}
+	pods, err := c.Store.AllPods(pod.Namespace)
+	if err != nil {
+		b.fail("siblings", err)
+		return
+	}
+	for _, p := range pods {
+		if p.Name == pod.Name || p.Owner().String() != owner {
+			continue
+		}
+		if status, err := c.Store.Status(p.Namespace, p.Name); err == nil && status.Deleted {
+			continue
+		}
+		name := filepath.Join("siblings", p.Name+".log")
+		lines, err := lastLines(c.Store, p.LogPath, c.Lines)
+		if err != nil {
+			b.fail(name, err)
+			continue
+		}
+		var data []byte
+		for _, line := range lines {
+			data = append(append(data, line...), '\n')
+		}
+		b.write(name, data)
+	}
+}
+
+func lastLines(s *store.Store, path string, n int) ([]string, error) {
+	f, err := s.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return tail.Last(f, n, nil)
+}
@@ -0,0 +1,111 @@
+package crash_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg/crash"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func controller(kind, name string) []metav1.OwnerReference {
+	yes := true
+	return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: &yes}}
+}
+
+func terminated(exitCode int32, finishedAt time.Time) *v1.ContainerStateTerminated {
+	return &v1.ContainerStateTerminated{ExitCode: exitCode, Reason: "Error", FinishedAt: metav1.NewTime(finishedAt)}
+}
+
+func TestTracker(t *testing.T) {
+	at := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "api-1"}}
+	pod.Status.ContainerStatuses = []v1.ContainerStatus{{Name: "app", LastTerminationState: v1.ContainerState{Terminated: terminated(1, at)}}}
+	tracker := crash.NewTracker()
+	assert.Empty(t, tracker.Terminations(pod), "the first status is a baseline")
+
+	pod.Status.ContainerStatuses[0].RestartCount = 1
+	pod.Status.ContainerStatuses[0].State.Terminated = terminated(137, at.Add(time.Minute))
+	found := tracker.Terminations(pod)
+	require.Len(t, found, 1)
+	assert.Equal(t, crash.Termination{Container: "app", ExitCode: 137, Reason: "Error", Restarts: 1, FinishedAt: at.Add(time.Minute)}, found[0])
+
+	// After the restart the same termination becomes the last termination state.
+	pod.Status.ContainerStatuses[0].State = v1.ContainerState{Running: &v1.ContainerStateRunning{}}
+	pod.Status.ContainerStatuses[0].LastTerminationState.Terminated = terminated(137, at.Add(time.Minute))
+	assert.Empty(t, tracker.Terminations(pod))
+
+	pod.Status.ContainerStatuses[0].LastTerminationState.Terminated = terminated(0, at.Add(2*time.Minute))
+	assert.Empty(t, tracker.Terminations(pod), "successful exits are not crashes")
+}
+
+func TestCollect(t *testing.T) {
+	at := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "shop"), 0755))
+	metadata := "2025-01-02 15:00:00 ; api-1 ; api-5d4 ; 1\n2025-01-02 15:00:01 ; api-2 ; api-5d4 ; 1\n2025-01-02 14:00:00 ; api-0 ; api-5d4 ; 1\n"
+	require.NoError(t, os.WriteFile(filepath.Join(root, "shop", "deployment.api.metadata"), []byte(metadata), 0644))
+	for pod, log := range map[string]string{"api-1": "starting\npanic: boom\n", "api-2": "one\ntwo\nthree\n", "api-0": "gone\n"} {
+		require.NoError(t, os.WriteFile(filepath.Join(root, "shop", pod+".log"), []byte(log), 0644))
+	}
+	s := store.New(root)
+	require.NoError(t, s.WriteStatus("shop", "api-0", store.PodStatus{Deleted: true}))
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "api-1", OwnerReferences: controller("ReplicaSet", "api-5d4")},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "app"}}},
+	}
+	client := fake.NewSimpleClientset(
+		pod,
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "api-5d4", OwnerReferences: controller("Deployment", "api")}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "api"}},
+		&v1.Event{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "e1"}, Reason: "BackOff",
+			InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "api-1"}},
+		&v1.Event{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "e2"}, Reason: "ScalingReplicaSet",
+			InvolvedObject: v1.ObjectReference{Kind: "Deployment", Name: "api"}},
+		&v1.Event{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "e3"}, Reason: "Unrelated",
+			InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "web-1"}},
+	)
+	c := &crash.Collector{Client: client, Store: s, Lines: 2}
+	bundle, err := c.Collect(context.Background(), pod, "deployment/api",
+		crash.Termination{Container: "app", ExitCode: 2, Reason: "Error", Restarts: 3, FinishedAt: at})
+	require.NoError(t, err)
+	assert.Equal(t, "api-1-app-20250102T150405Z", bundle.ID)
+	assert.Equal(t, []string{"events.yaml", "logs/app.log", "logs/app.previous.log", "owner.yaml", "pod.yaml", "siblings/api-2.log"}, bundle.Files)
+	assert.Empty(t, bundle.Errors)
+
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(bundle.Path, name))
+		require.NoError(t, err)
+		return string(data)
+	}
+	assert.Equal(t, "two\nthree\n", read("siblings/api-2.log"))
+	assert.Contains(t, read("owner.yaml"), "name: api-5d4")
+	assert.Contains(t, read("owner.yaml"), "---\n")
+	events := read("events.yaml")
+	assert.Contains(t, events, "BackOff")
+	assert.Contains(t, events, "ScalingReplicaSet")
+	assert.NotContains(t, events, "Unrelated")
+
+	crashes, err := s.Crashes("shop")
+	require.NoError(t, err)
+	require.Len(t, crashes, 1)
+	assert.Equal(t, bundle.ID, crashes[0].ID)
+	assert.Equal(t, int32(2), crashes[0].ExitCode)
+
+	pods, err := s.AllPods("shop")
+	require.NoError(t, err)
+	assert.Len(t, pods, 3, "the crashes directory is not a pod")
+
+	_, err = c.Collect(context.Background(), pod, "deployment/api", crash.Termination{Container: "app", ExitCode: 2, FinishedAt: at})
+	assert.Error(t, err, "a termination is bundled once")
+}
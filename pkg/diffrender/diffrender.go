@@ -0,0 +1,101 @@
+package diffrender
+
+import (
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// Line operations of a hunk line.
+const (
+	OpEqual  = "equal"
+	OpDelete = "delete"
+	OpInsert = "insert"
+)
+
+// Side identifies one pod of a diff.
+type Side struct {
+	Pod       string `json:"pod"`
+	CreatedAt string `json:"createdAt,omitempty"`
+}
+
+// Line is a single line of a hunk. OldLine and NewLine are 1-based and 0 when the line
+// does not exist on that side.
+type Line struct {
+	Op      string `json:"op"`
+	Text    string `json:"text"`
+	OldLine int    `json:"oldLine,omitempty"`
+	NewLine int    `json:"newLine,omitempty"`
+}
+
+type Hunk struct {
+	OldStart int    `json:"oldStart"`
+	OldLines int    `json:"oldLines"`
+	NewStart int    `json:"newStart"`
+	NewLines int    `json:"newLines"`
+	Lines    []Line `json:"lines"`
+}
+
+// Diff is the renderer independent representation of the diff between the logs of two pods.
+type Diff struct {
+	From  Side   `json:"from"`
+	To    Side   `json:"to"`
+	Hunks []Hunk `json:"hunks"`
+}
+
+// Compute diffs the logs a and b, keeping context lines of unchanged text around every change.
+func Compute(from, to Side, a, b string, context int) Diff {
+	d := Diff{From: from, To: to, Hunks: make([]Hunk, 0)}
+	oldLines, newLines := splitLines(a), splitLines(b)
+	m := difflib.NewMatcher(oldLines, newLines)
+	for _, group := range m.GetGroupedOpCodes(context) {
+		if !hasChanges(group) {
+			continue
+		}
+		first, last := group[0], group[len(group)-1]
+		h := Hunk{
+			OldStart: first.I1 + 1,
+			OldLines: last.I2 - first.I1,
+			NewStart: first.J1 + 1,
+			NewLines: last.J2 - first.J1,
+		}
+		for _, op := range group {
+			switch op.Tag {
+			case 'e':
+				for i := 0; i < op.I2-op.I1; i++ {
+					h.Lines = append(h.Lines, Line{Op: OpEqual, Text: oldLines[op.I1+i], OldLine: op.I1 + i + 1, NewLine: op.J1 + i + 1})
+				}
+			default:
+				for i := op.I1; i < op.I2; i++ {
+					h.Lines = append(h.Lines, Line{Op: OpDelete, Text: oldLines[i], OldLine: i + 1})
+				}
+				for j := op.J1; j < op.J2; j++ {
+					h.Lines = append(h.Lines, Line{Op: OpInsert, Text: newLines[j], NewLine: j + 1})
+				}
+			}
+		}
+		d.Hunks = append(d.Hunks, h)
+	}
+	return d
+}
+
+// Empty reports whether the two sides are identical.
+func (d Diff) Empty() bool {
+	return len(d.Hunks) == 0
+}
+
+func hasChanges(group []difflib.OpCode) bool {
+	for _, op := range group {
+		if op.Tag != 'e' {
+			return true
+		}
+	}
+	return false
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
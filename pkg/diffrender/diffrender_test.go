@@ -0,0 +1,102 @@
+package diffrender_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/diffrender"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompute(t *testing.T) {
+	a := "start\nlistening on 80\nok\n"
+	b := "start\nlistening on 8080\nok\n"
+	d := diffrender.Compute(diffrender.Side{Pod: "a"}, diffrender.Side{Pod: "b"}, a, b, 1)
+	require.Len(t, d.Hunks, 1)
+	h := d.Hunks[0]
+	assert.Equal(t, 1, h.OldStart)
+	assert.Equal(t, 3, h.OldLines)
+	assert.Equal(t, []diffrender.Line{
+		{Op: diffrender.OpEqual, Text: "start", OldLine: 1, NewLine: 1},
+		{Op: diffrender.OpDelete, Text: "listening on 80", OldLine: 2},
+		{Op: diffrender.OpInsert, Text: "listening on 8080", NewLine: 2},
+		{Op: diffrender.OpEqual, Text: "ok", OldLine: 3, NewLine: 3},
+	}, h.Lines)
+
+	assert.True(t, diffrender.Compute(diffrender.Side{}, diffrender.Side{}, a, a, 3).Empty())
+}
+
+func TestSideBySide(t *testing.T) {
+	pkg.ColorsEnabled = false
+	long := strings.Repeat("a", 50)
+	for _, tc := range []struct {
+		name  string
+		width int
+		a, b  string
+		rows  []string
+	}{
+		{
+			name:  "fits the width",
+			width: 40,
+			a:     "start\nlistening on 80\n",
+			b:     "start\nlistening on 8080\n",
+			rows: []string{
+				"    1 start        │     1 start       ",
+				"    2 listening o… │     2 listening o…",
+			},
+		},
+		{
+			name:  "truncates long lines",
+			width: 40,
+			a:     long + "\n",
+			b:     "short\n",
+			rows: []string{
+				"    1 aaaaaaaaaaa… │     1 short       ",
+			},
+		},
+		{
+			name:  "keeps a minimum column",
+			width: 20,
+			a:     "x\ttab\n",
+			b:     "ünïcödé line\n",
+			rows: []string{
+				"    1 x    tab   │     1 ünïcödé l…",
+			},
+		},
+		{
+			name:  "pads the missing side",
+			width: 40,
+			a:     "one\n",
+			b:     "one\ntwo\n",
+			rows: []string{
+				"    1 one          │     1 one         ",
+				"                   │     2 two         ",
+			},
+		},
+	} {
+		var out bytes.Buffer
+		diffrender.SideBySide(&out, diffrender.Compute(diffrender.Side{Pod: "a"}, diffrender.Side{Pod: "b"}, tc.a, tc.b, 3), tc.width)
+		lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+		require.Greater(t, len(lines), 1, tc.name)
+		assert.True(t, strings.HasPrefix(lines[1], "@@ "), tc.name)
+		rows := lines[2:]
+		assert.Equal(t, tc.rows, rows, tc.name)
+		// Narrower terminals still get columns of 10 runes, 35 runes per row.
+		for _, row := range rows {
+			assert.LessOrEqual(t, utf8.RuneCountInString(row), max(tc.width, 35), tc.name)
+		}
+	}
+}
+
+func TestHTMLEscapesLines(t *testing.T) {
+	d := diffrender.Compute(diffrender.Side{Pod: "<b>a</b>"}, diffrender.Side{Pod: "b"}, "ok\n", "<script>alert(1)</script>\n", 3)
+	var out bytes.Buffer
+	require.NoError(t, diffrender.HTML(&out, "report", []diffrender.Diff{d}))
+	assert.NotContains(t, out.String(), "<script>")
+	assert.NotContains(t, out.String(), "<b>a</b>")
+	assert.Contains(t, out.String(), "&lt;script&gt;alert(1)&lt;/script&gt;")
+}
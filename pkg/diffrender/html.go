@@ -0,0 +1,65 @@
+package diffrender
+
+import (
+	"encoding/json"
+	"html/template"
+	"io"
+	"time"
+)
+
+// JSON writes the diffs as an indented JSON array.
+func JSON(w io.Writer, diffs []Diff) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(diffs)
+}
+
+type htmlReport struct {
+	Title     string
+	Generated string
+	Diffs     []Diff
+}
+
+// HTML writes a self-contained HTML report of the diffs, with styles inlined so that it can be
+// attached to a ticket as a single file.
+func HTML(w io.Writer, title string, diffs []Diff) error {
+	return htmlTemplate.Execute(w, htmlReport{
+		Title:     title,
+		Generated: time.Now().Format(time.RFC1123),
+		Diffs:     diffs,
+	})
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.4em; }
+h2 { font-size: 1.1em; margin-top: 2em; }
+.meta { color: #666; font-size: 0.9em; }
+table { border-collapse: collapse; width: 100%; font-family: monospace; font-size: 0.85em; }
+td { padding: 0 0.5em; white-space: pre-wrap; word-break: break-all; vertical-align: top; }
+td.num { color: #999; text-align: right; width: 4em; user-select: none; }
+tr.hunk td { background: #eef; color: #557; }
+tr.delete td.text { background: #fdd; }
+tr.insert td.text { background: #dfd; }
+.same { color: #080; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="meta">Generated {{.Generated}} by k8sdebug</p>
+{{range .Diffs}}
+<h2>{{.From.Pod}} <span class="meta">({{.From.CreatedAt}})</span> &rarr; {{.To.Pod}} <span class="meta">({{.To.CreatedAt}})</span></h2>
+{{if not .Hunks}}<p class="same">No diff found between {{.From.Pod}} and {{.To.Pod}}</p>{{else}}
+<table>
+{{range .Hunks}}<tr class="hunk"><td class="num"></td><td class="num"></td><td>@@ -{{.OldStart}},{{.OldLines}} +{{.NewStart}},{{.NewLines}} @@</td></tr>
+{{range .Lines}}<tr class="{{.Op}}"><td class="num">{{if .OldLine}}{{.OldLine}}{{end}}</td><td class="num">{{if .NewLine}}{{.NewLine}}{{end}}</td><td class="text">{{if eq .Op "delete"}}-{{else if eq .Op "insert"}}+{{else}} {{end}}{{.Text}}</td></tr>
+{{end}}{{end}}</table>{{end}}
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,95 @@
+package diffrender
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/revolyssup/k8sdebug/pkg"
+)
+
+const lineNumberWidth = 5
+
+// SideBySide writes the diff as two columns, old pod on the left and new pod on the right,
+// fitting the given terminal width. Lines longer than a column are truncated.
+func SideBySide(w io.Writer, d Diff, width int) {
+	// Every row is "<num> <text> │ <num> <text>".
+	col := (width-3)/2 - lineNumberWidth - 1
+	if col < 10 {
+		col = 10
+	}
+	fmt.Fprint(w, pkg.ColorLine(fmt.Sprintf("%s │ %s",
+		pad(fmt.Sprintf("%s (%s)", d.From.Pod, d.From.CreatedAt), col+lineNumberWidth+1),
+		fmt.Sprintf("%s (%s)", d.To.Pod, d.To.CreatedAt)), pkg.ColorYellow))
+	if d.Empty() {
+		fmt.Fprintln(w, "No diff found between ", d.From.Pod, " and ", d.To.Pod)
+		return
+	}
+	for _, h := range d.Hunks {
+		fmt.Fprintf(w, "@@ -%d,%d +%d,%d @@\n", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+		var deleted, inserted []Line
+		flush := func() {
+			for i := 0; i < len(deleted) || i < len(inserted); i++ {
+				var left, right *Line
+				if i < len(deleted) {
+					left = &deleted[i]
+				}
+				if i < len(inserted) {
+					right = &inserted[i]
+				}
+				writeRow(w, left, right, col)
+			}
+			deleted, inserted = nil, nil
+		}
+		for _, l := range h.Lines {
+			switch l.Op {
+			case OpDelete:
+				if len(inserted) > 0 {
+					flush()
+				}
+				deleted = append(deleted, l)
+			case OpInsert:
+				inserted = append(inserted, l)
+			default:
+				flush()
+				l := l
+				writeRow(w, &l, &l, col)
+			}
+		}
+		flush()
+	}
+}
+
+func writeRow(w io.Writer, left, right *Line, col int) {
+	fmt.Fprintf(w, "%s │ %s\n", cell(left, col, true), cell(right, col, false))
+}
+
+func cell(l *Line, col int, old bool) string {
+	if l == nil {
+		return strings.Repeat(" ", lineNumberWidth+1+col)
+	}
+	num := l.NewLine
+	if old {
+		num = l.OldLine
+	}
+	text := pad(l.Text, col)
+	switch l.Op {
+	case OpDelete:
+		text = pkg.Colorize(text, pkg.ColorRed)
+	case OpInsert:
+		text = pkg.Colorize(text, pkg.ColorGreen)
+	}
+	return fmt.Sprintf("%*d %s", lineNumberWidth, num, text)
+}
+
+// pad truncates or right pads s to exactly n runes.
+func pad(s string, n int) string {
+	s = strings.ReplaceAll(s, "\t", "    ")
+	count := utf8.RuneCountInString(s)
+	if count > n {
+		runes := []rune(s)
+		return string(runes[:n-1]) + "…"
+	}
+	return s + strings.Repeat(" ", n-count)
+}
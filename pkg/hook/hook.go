@@ -0,0 +1,268 @@
+// Package hook runs user commands on pod lifecycle events seen by the recorder and keeps their output next to the logs.
+package hook
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	OnPodAdded = "pod-added"
+	OnRestart  = "restart"
+	OnExit     = "exit"
+	OnLogMatch = "log-match"
+)
+
+// Hook runs Command with sh -c when its event happens to a pod in its scope.
+type Hook struct {
+	Name string `json:"name"`
+	// Event is pod-added, restart, exit (a container terminated with a non-zero exit code) or log-match.
+	Event string `json:"event"`
+	// Match is the regular expression matched against log lines for log-match, and against the
+	// termination reason, e.g. OOMKilled, for restart and exit.
+	Match string `json:"match,omitempty"`
+	// Namespace and Owner, e.g. deployment/api, restrict the hook to some pods.
+	Namespace string `json:"namespace,omitempty"`
+	Owner     string `json:"owner,omitempty"`
+	Command   string `json:"command"`
+	// Timeout defaults to one minute.
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+	// Cooldown is the time after a run during which the hook does not run again for the same pod. Defaults to 30s.
+	Cooldown metav1.Duration `json:"cooldown,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// Config is the content of the hooks file.
+type Config struct {
+	Hooks []Hook `json:"hooks"`
+}
+
+// Load reads and validates a YAML or JSON hooks file.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Config
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for i := range c.Hooks {
+		h := &c.Hooks[i]
+		if h.Name == "" {
+			h.Name = fmt.Sprintf("hook-%d", i+1)
+		}
+		switch h.Event {
+		case OnPodAdded, OnRestart, OnExit:
+		case OnLogMatch:
+			if h.Match == "" {
+				return nil, fmt.Errorf("%s: hook %s: match is required for log-match hooks", path, h.Name)
+			}
+		default:
+			return nil, fmt.Errorf("%s: hook %s: unknown event %q, use pod-added, restart, exit or log-match", path, h.Name, h.Event)
+		}
+		if h.Command == "" {
+			return nil, fmt.Errorf("%s: hook %s: command is required", path, h.Name)
+		}
+		if h.Match != "" {
+			if h.re, err = regexp.Compile(h.Match); err != nil {
+				return nil, fmt.Errorf("%s: hook %s: %w", path, h.Name, err)
+			}
+		}
+		if h.Timeout.Duration <= 0 {
+			h.Timeout.Duration = time.Minute
+		}
+		if h.Cooldown.Duration <= 0 {
+			h.Cooldown.Duration = 30 * time.Second
+		}
+	}
+	return &c, nil
+}
+
+// Pod identifies the pod of an event. Owner is kind/name, e.g. deployment/api.
+type Pod struct {
+	Namespace string
+	Name      string
+	Owner     string
+}
+
+// Container is the state of a container of a pod, with its last termination if it terminated.
+type Container struct {
+	Name       string
+	Restarts   int32
+	ExitCode   int32
+	Reason     string
+	FinishedAt time.Time
+}
+
+// Event is what a hook runs for. It is passed to the command as K8SDEBUG_* environment variables.
+type Event struct {
+	Type      string
+	Pod       Pod
+	Container string
+	Restarts  int32
+	ExitCode  int32
+	Reason    string
+	Line      string
+}
+
+func (e Event) env(root string) []string {
+	return []string{
+		"K8SDEBUG_EVENT=" + e.Type,
+		"K8SDEBUG_NAMESPACE=" + e.Pod.Namespace,
+		"K8SDEBUG_POD=" + e.Pod.Name,
+		"K8SDEBUG_OWNER=" + e.Pod.Owner,
+		"K8SDEBUG_CONTAINER=" + e.Container,
+		"K8SDEBUG_RESTARTS=" + strconv.Itoa(int(e.Restarts)),
+		"K8SDEBUG_EXIT_CODE=" + strconv.Itoa(int(e.ExitCode)),
+		"K8SDEBUG_REASON=" + e.Reason,
+		"K8SDEBUG_LINE=" + e.Line,
+		"K8SDEBUG_LOG=" + store.New(root).LogPath(e.Pod.Namespace, e.Pod.Name),
+		"K8SDEBUG_LOGS_PATH=" + root,
+	}
+}
+
+// Runner runs the hooks for the events of the recorder. It is safe for concurrent use.
+type Runner struct {
+	hooks    []Hook
+	root     string
+	errorLog func(error)
+
+	mu         sync.Mutex
+	lastRun    map[string]time.Time
+	containers map[string]Container
+	wg         sync.WaitGroup
+}
+
+// NewRunner runs the hooks of c and writes their output under the store at root.
+func NewRunner(c *Config, root string, errorLog func(error)) *Runner {
+	return &Runner{
+		hooks:      c.Hooks,
+		root:       root,
+		errorLog:   errorLog,
+		lastRun:    make(map[string]time.Time),
+		containers: make(map[string]Container),
+	}
+}
+
+func (h *Hook) applies(pod Pod) bool {
+	if h.Namespace != "" && h.Namespace != pod.Namespace {
+		return false
+	}
+	return h.Owner == "" || strings.EqualFold(h.Owner, pod.Owner)
+}
+
+// PodAdded runs the pod-added hooks.
+func (r *Runner) PodAdded(pod Pod) {
+	r.fire(Event{Type: OnPodAdded, Pod: pod}, "")
+}
+
+// Line runs the log-match hooks matching a log line of the pod.
+func (r *Runner) Line(pod Pod, line string) {
+	r.fire(Event{Type: OnLogMatch, Pod: pod, Line: line}, line)
+}
+
+// Containers compares the containers of the pod with the previous call and runs the restart hooks for
+// containers that restarted and the exit hooks for new terminations with a non-zero exit code.
+// The first call for a container only records its state.
+func (r *Runner) Containers(pod Pod, containers []Container) {
+	for _, c := range containers {
+		key := pod.Namespace + "/" + pod.Name + "/" + c.Name
+		r.mu.Lock()
+		previous, known := r.containers[key]
+		r.containers[key] = c
+		r.mu.Unlock()
+		if !known {
+			continue
+		}
+		e := Event{Pod: pod, Container: c.Name, Restarts: c.Restarts, ExitCode: c.ExitCode, Reason: c.Reason}
+		if c.Restarts > previous.Restarts {
+			e.Type = OnRestart
+			r.fire(e, c.Reason)
+		}
+		if c.ExitCode != 0 && !c.FinishedAt.IsZero() && !c.FinishedAt.Equal(previous.FinishedAt) {
+			e.Type = OnExit
+			r.fire(e, c.Reason)
+		}
+	}
+}
+
+// fire starts the hooks of the event in the background. subject is matched against the Match of the hooks.
+func (r *Runner) fire(e Event, subject string) {
+	for i := range r.hooks {
+		h := &r.hooks[i]
+		if h.Event != e.Type || !h.applies(e.Pod) || (h.re != nil && !h.re.MatchString(subject)) {
+			continue
+		}
+		key := h.Name + "/" + e.Pod.Namespace + "/" + e.Pod.Name
+		now := time.Now()
+		r.mu.Lock()
+		if last, ok := r.lastRun[key]; ok && now.Sub(last) < h.Cooldown.Duration {
+			r.mu.Unlock()
+			continue
+		}
+		r.lastRun[key] = now
+		r.mu.Unlock()
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			if err := r.run(h, e, now); err != nil && r.errorLog != nil {
+				r.errorLog(fmt.Errorf("hook %s for pod %s: %w", h.Name, e.Pod.Name, err))
+			}
+		}()
+	}
+}
+
+// Wait waits for the running hooks to finish.
+func (r *Runner) Wait() {
+	r.wg.Wait()
+}
+
+// run runs the hook and writes its command, environment, output and exit status to a file of the hooks directory of the pod.
+func (r *Runner) run(h *Hook, e Event, at time.Time) error {
+	dir := store.New(r.root).HooksPath(e.Pod.Namespace, e.Pod.Name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(filepath.Join(dir, fmt.Sprintf("%s-%s.out", at.UTC().Format("20060102T150405.000Z"), h.Name)))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	env := e.env(r.root)
+	fmt.Fprintf(out, "# hook %s on %s at %s\n# command: %s\n", h.Name, e.Type, at.Format(time.RFC3339), h.Command)
+	for _, v := range env {
+		fmt.Fprintf(out, "# %s\n", v)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), h.Timeout.Duration)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", h.Command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.WaitDelay = time.Second
+	start := time.Now()
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %s", h.Timeout.Duration)
+	}
+	status := "exit 0"
+	if err != nil {
+		status = err.Error()
+	}
+	fmt.Fprintf(out, "# %s after %s\n", status, time.Since(start).Round(time.Millisecond))
+	return err
+}
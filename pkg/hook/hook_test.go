@@ -0,0 +1,122 @@
+package hook_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg/hook"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadHooks(t *testing.T, hooks string) *hook.Config {
+	path := filepath.Join(t.TempDir(), "hooks.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(hooks), 0644))
+	c, err := hook.Load(path)
+	require.NoError(t, err)
+	return c
+}
+
+// outputs returns the content of the hook outputs kept for the pod.
+func outputs(t *testing.T, root, namespace, pod string) []string {
+	entries, err := os.ReadDir(store.New(root).HooksPath(namespace, pod))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	require.NoError(t, err)
+	out := make([]string, 0, len(entries))
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(store.New(root).HooksPath(namespace, pod), e.Name()))
+		require.NoError(t, err)
+		out = append(out, string(data))
+	}
+	return out
+}
+
+func TestHooks(t *testing.T) {
+	root := t.TempDir()
+	c := loadHooks(t, `
+hooks:
+- name: added
+  event: pod-added
+  namespace: shop
+  command: echo added $K8SDEBUG_POD of $K8SDEBUG_OWNER
+- name: oom
+  event: restart
+  match: OOMKilled
+  command: echo restarted $K8SDEBUG_CONTAINER $K8SDEBUG_RESTARTS $K8SDEBUG_REASON
+- name: crash
+  event: exit
+  command: echo exited $K8SDEBUG_EXIT_CODE; exit 3
+- name: panic
+  event: log-match
+  match: "panic:"
+  command: echo "matched $K8SDEBUG_LINE"
+`)
+	r := hook.NewRunner(c, root, func(err error) {})
+	api := hook.Pod{Namespace: "shop", Name: "api-1", Owner: "deployment/api"}
+
+	r.PodAdded(api)
+	r.PodAdded(hook.Pod{Namespace: "default", Name: "web-1"})
+	r.Line(api, "all good")
+	r.Line(api, "panic: nil map")
+	r.Line(api, "panic: again, within the cooldown")
+
+	r.Containers(api, []hook.Container{{Name: "app", Restarts: 1, ExitCode: 137, Reason: "OOMKilled", FinishedAt: time.Unix(100, 0)}})
+	r.Containers(api, []hook.Container{{Name: "app", Restarts: 2, ExitCode: 137, Reason: "OOMKilled", FinishedAt: time.Unix(200, 0)}})
+	r.Wait()
+
+	out := outputs(t, root, "shop", "api-1")
+	require.Len(t, out, 4, "the first container status is only a baseline and the second panic is within the cooldown")
+	joined := ""
+	for _, o := range out {
+		joined += o
+	}
+	assert.Contains(t, joined, "added api-1 of deployment/api")
+	assert.Contains(t, joined, "matched panic: nil map")
+	assert.Contains(t, joined, "restarted app 2 OOMKilled")
+	assert.Contains(t, joined, "exited 137\n# exit status 3")
+	assert.NotContains(t, joined, "again")
+	assert.Empty(t, outputs(t, root, "default", "web-1"), "outside the namespace of the hook")
+}
+
+func TestHookTimeout(t *testing.T) {
+	root := t.TempDir()
+	c := loadHooks(t, `
+hooks:
+- name: slow
+  event: pod-added
+  timeout: 100ms
+  command: sleep 5
+`)
+	var errs []error
+	r := hook.NewRunner(c, root, func(err error) { errs = append(errs, err) })
+	start := time.Now()
+	r.PodAdded(hook.Pod{Namespace: "shop", Name: "api-1"})
+	r.Wait()
+	assert.Less(t, time.Since(start), 3*time.Second)
+	require.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "timed out after 100ms")
+	out := outputs(t, root, "shop", "api-1")
+	require.Len(t, out, 1)
+	assert.Contains(t, out[0], "# timed out after 100ms")
+}
+
+func TestLoadErrors(t *testing.T) {
+	for name, hooks := range map[string]string{
+		"unknown event": "hooks:\n- event: deleted\n  command: \"true\"\n",
+		"no match":      "hooks:\n- event: log-match\n  command: \"true\"\n",
+		"no command":    "hooks:\n- event: restart\n",
+		"bad regexp":    "hooks:\n- event: exit\n  match: \"(\"\n  command: \"true\"\n",
+		"bad timeout":   "hooks:\n- event: exit\n  timeout: soon\n  command: \"true\"\n",
+		"unknown field": "hooks:\n- event: exit\n  cmd: true\n",
+	} {
+		path := filepath.Join(t.TempDir(), "hooks.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(hooks), 0644))
+		_, err := hook.Load(path)
+		assert.Error(t, err, name)
+	}
+}
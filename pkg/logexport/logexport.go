@@ -0,0 +1,211 @@
+// Package logexport converts recorded logs into OpenTelemetry (OTLP/JSON) and Loki push payloads.
+package logexport
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg/structured"
+)
+
+const (
+	FormatOTLP = "otlp-json"
+	FormatLoki = "loki"
+)
+
+// Stream identifies the pod a batch of entries was logged by.
+type Stream struct {
+	Namespace string
+	Pod       string
+	OwnerKind string
+	OwnerName string
+	// Container is empty when the pod has several containers, their lines are not told apart in the store.
+	Container string
+}
+
+type Entry struct {
+	Time time.Time
+	Line string
+}
+
+// Encode returns the payload of the entries of one stream in the format.
+func Encode(format string, s Stream, entries []Entry) (any, error) {
+	switch format {
+	case FormatOTLP:
+		return OTLP(s, entries), nil
+	case FormatLoki:
+		return Loki(s, entries), nil
+	}
+	return nil, fmt.Errorf("unknown export format %s, use %s or %s", format, FormatOTLP, FormatLoki)
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpRecord struct {
+	TimeUnixNano         string          `json:"timeUnixNano"`
+	ObservedTimeUnixNano string          `json:"observedTimeUnixNano"`
+	SeverityNumber       int             `json:"severityNumber,omitempty"`
+	SeverityText         string          `json:"severityText,omitempty"`
+	Body                 otlpValue       `json:"body"`
+	Attributes           []otlpAttribute `json:"attributes,omitempty"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpScope    `json:"scope"`
+	LogRecords []otlpRecord `json:"logRecords"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpResourceLogs struct {
+	Resource  otlpResource    `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+// OTLPPayload is the body of an OTLP/HTTP JSON logs export request.
+type OTLPPayload struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+// OTLP converts the entries into OpenTelemetry log records. The pod, owner, container and namespace
+// are resource attributes named after the Kubernetes semantic conventions.
+func OTLP(s Stream, entries []Entry) OTLPPayload {
+	attrs := []otlpAttribute{
+		{Key: "k8s.namespace.name", Value: otlpValue{s.Namespace}},
+		{Key: "k8s.pod.name", Value: otlpValue{s.Pod}},
+	}
+	if s.OwnerKind != "" && s.OwnerKind != "pod" {
+		attrs = append(attrs,
+			otlpAttribute{Key: "k8s." + strings.ToLower(s.OwnerKind) + ".name", Value: otlpValue{s.OwnerName}},
+			otlpAttribute{Key: "k8sdebug.owner", Value: otlpValue{s.OwnerKind + "/" + s.OwnerName}})
+	}
+	if s.Container != "" {
+		attrs = append(attrs, otlpAttribute{Key: "k8s.container.name", Value: otlpValue{s.Container}})
+	}
+	observed := strconv.FormatInt(time.Now().UnixNano(), 10)
+	records := make([]otlpRecord, 0, len(entries))
+	for _, e := range entries {
+		number, text := severity(e.Line)
+		records = append(records, otlpRecord{
+			TimeUnixNano:         strconv.FormatInt(e.Time.UnixNano(), 10),
+			ObservedTimeUnixNano: observed,
+			SeverityNumber:       number,
+			SeverityText:         text,
+			Body:                 otlpValue{e.Line},
+		})
+	}
+	return OTLPPayload{ResourceLogs: []otlpResourceLogs{{
+		Resource:  otlpResource{Attributes: attrs},
+		ScopeLogs: []otlpScopeLogs{{Scope: otlpScope{Name: "k8sdebug"}, LogRecords: records}},
+	}}}
+}
+
+// severity maps the level of a line to the OpenTelemetry severity number and text.
+func severity(line string) (int, string) {
+	level := strings.ToLower(structured.Parse(line).Level())
+	switch {
+	case level == "trace":
+		return 1, "TRACE"
+	case level == "debug":
+		return 5, "DEBUG"
+	case level == "info":
+		return 9, "INFO"
+	case level == "warn" || level == "warning":
+		return 13, "WARN"
+	case level == "error":
+		return 17, "ERROR"
+	case level == "fatal" || level == "panic":
+		return 21, "FATAL"
+	}
+	switch structured.Severity(line) {
+	case structured.SeverityError:
+		return 17, "ERROR"
+	case structured.SeverityWarn:
+		return 13, "WARN"
+	}
+	return 0, ""
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// LokiPayload is the body of a Loki push API request.
+type LokiPayload struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+// Loki converts the entries into a Loki push payload with pod, owner, container and namespace labels.
+func Loki(s Stream, entries []Entry) LokiPayload {
+	labels := map[string]string{"namespace": s.Namespace, "pod": s.Pod, "job": "k8sdebug"}
+	if s.OwnerKind != "" && s.OwnerKind != "pod" {
+		labels["owner_kind"] = s.OwnerKind
+		labels["owner_name"] = s.OwnerName
+	}
+	if s.Container != "" {
+		labels["container"] = s.Container
+	}
+	values := make([][2]string, 0, len(entries))
+	for _, e := range entries {
+		values = append(values, [2]string{strconv.FormatInt(e.Time.UnixNano(), 10), e.Line})
+	}
+	return LokiPayload{Streams: []lokiStream{{Stream: labels, Values: values}}}
+}
+
+// PushURL adds the default API path of the format to endpoints given without a path,
+// e.g. http://localhost:4318 for a collector or http://localhost:3100 for Loki.
+func PushURL(format, endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid push url %s, expected e.g. http://localhost:3100", endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/logs"
+		if format == FormatLoki {
+			u.Path = "/loki/api/v1/push"
+		}
+	}
+	return u.String(), nil
+}
+
+// Push sends the payload as JSON. Responses other than 2xx are returned as errors.
+func Push(client *http.Client, pushURL string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(pushURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("push to %s failed with %s: %s", pushURL, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
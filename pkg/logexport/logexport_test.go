@@ -0,0 +1,81 @@
+package logexport_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg/logexport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	stream  = logexport.Stream{Namespace: "shop", Pod: "api-7d9f-aaaaa", OwnerKind: "deployment", OwnerName: "api", Container: "app"}
+	entries = []logexport.Entry{
+		{Time: time.Unix(1700000000, 5), Line: `{"level":"error","msg":"boom"}`},
+		{Time: time.Unix(1700000001, 0), Line: "plain line"},
+	}
+)
+
+func TestOTLP(t *testing.T) {
+	data, err := json.Marshal(logexport.OTLP(stream, entries))
+	require.NoError(t, err)
+	var payload struct {
+		ResourceLogs []struct {
+			Resource struct {
+				Attributes []struct {
+					Key   string
+					Value struct{ StringValue string }
+				}
+			}
+			ScopeLogs []struct {
+				LogRecords []struct {
+					TimeUnixNano   string
+					SeverityNumber int
+					Body           struct{ StringValue string }
+				}
+			}
+		}
+	}
+	require.NoError(t, json.Unmarshal(data, &payload))
+	attrs := make(map[string]string)
+	for _, a := range payload.ResourceLogs[0].Resource.Attributes {
+		attrs[a.Key] = a.Value.StringValue
+	}
+	assert.Equal(t, "shop", attrs["k8s.namespace.name"])
+	assert.Equal(t, "api-7d9f-aaaaa", attrs["k8s.pod.name"])
+	assert.Equal(t, "api", attrs["k8s.deployment.name"])
+	assert.Equal(t, "app", attrs["k8s.container.name"])
+	records := payload.ResourceLogs[0].ScopeLogs[0].LogRecords
+	require.Len(t, records, 2)
+	assert.Equal(t, "1700000000000000005", records[0].TimeUnixNano)
+	assert.Equal(t, 17, records[0].SeverityNumber)
+	assert.Equal(t, 0, records[1].SeverityNumber)
+	assert.Equal(t, "plain line", records[1].Body.StringValue)
+}
+
+func TestLokiPush(t *testing.T) {
+	var received logexport.LokiPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/loki/api/v1/push", r.URL.Path)
+		body, _ := io.ReadAll(r.Body)
+		assert.NoError(t, json.Unmarshal(body, &received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	url, err := logexport.PushURL(logexport.FormatLoki, server.URL)
+	require.NoError(t, err)
+	require.NoError(t, logexport.Push(server.Client(), url, logexport.Loki(stream, entries)))
+	data, err := json.Marshal(received)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"streams":[{"stream":{"job":"k8sdebug","namespace":"shop","pod":"api-7d9f-aaaaa","owner_kind":"deployment","owner_name":"api","container":"app"},
+		"values":[["1700000000000000005","{\"level\":\"error\",\"msg\":\"boom\"}"],["1700000001000000000","plain line"]]}]}`, string(data))
+
+	_, err = logexport.PushURL(logexport.FormatOTLP, "localhost:4318")
+	assert.Error(t, err)
+}
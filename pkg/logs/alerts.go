@@ -0,0 +1,98 @@
+package logs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/alert"
+	"github.com/revolyssup/k8sdebug/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+func newAlertsCommand() *cobra.Command {
+	var since string
+	var rules []string
+	var last int
+	cmd := &cobra.Command{
+		Use:   "alerts",
+		Short: "Show the alerts fired by the recorder",
+		Long: `Show the alerts fired by the recorder, oldest first.
+
+The recorder evaluates the rules of ~/.k8sdebug/alerts.yaml (or logs record run --alerts <file>) against every
+line it records and every container restart it sees. For example:
+
+  webhook: http://localhost:9000/hooks/k8sdebug   # default url of the webhook notifier
+  rules:
+  - name: panics
+    match: "panic:"
+    notify: [log, desktop]
+  - name: db-down
+    match: connection refused
+    owner: deployment/api      # only pods of this owner, namespace: restricts to a namespace
+    threshold: 5               # fire at 5 matches within the window
+    window: 2m
+    cooldown: 10m              # do not fire again for the same owner within 10m
+    notify: [webhook, log]
+  - name: restarts
+    event: restart             # match is then matched against the reason, e.g. OOMKilled
+    notify: [log]
+
+Notifiers: webhook posts the alert as JSON, desktop calls notify-send, log appends to the alerts log read by this
+command. Rules without notify use log. Hits are counted per owner, or per pod for pods without an owner.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			from, err := parseTimeFlag(since)
+			if err != nil {
+				cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+				return
+			}
+			file, err := logStore().Open(filepath.Join(logStore().Root, alert.LogName))
+			if os.IsNotExist(err) {
+				cmd.Println("No alerts fired.")
+				return
+			}
+			if err != nil {
+				cmd.Println(pkg.ColorLine(fmt.Sprintf("could not read the alerts: %v", err), pkg.ColorRed))
+				return
+			}
+			defer file.Close()
+			alerts, err := alert.ReadLog(file)
+			if err != nil {
+				cmd.Println(pkg.ColorLine(fmt.Sprintf("could not read the alerts: %v", err), pkg.ColorRed))
+				return
+			}
+			alerts = slices.DeleteFunc(alerts, func(a alert.Alert) bool {
+				return (from != nil && a.Time.Before(*from)) || (len(rules) > 0 && !slices.Contains(rules, a.Rule))
+			})
+			if last > 0 && len(alerts) > last {
+				alerts = alerts[len(alerts)-last:]
+			}
+			if output.Structured() {
+				if err := output.Write(os.Stdout, alerts); err != nil {
+					cmd.PrintErrln("Error encoding alerts:", err)
+				}
+				return
+			}
+			if len(alerts) == 0 {
+				cmd.Println("No alerts fired.")
+				return
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "TIME\tRULE\tNAMESPACE\tPOD\tCOUNT\tMESSAGE")
+			for _, a := range alerts {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d/%s\t%s\n", formatSeen(a.Time), a.Rule, a.Namespace, a.Pod, a.Count, a.Window, truncate(a.Message, 100))
+			}
+			w.Flush()
+		},
+	}
+	cmd.Flags().StringVar(&since, "since", "", `only show alerts fired after this time, e.g. 2h or "2025-01-02 15:04:05"`)
+	cmd.Flags().StringSliceVar(&rules, "rule", nil, "only show alerts of these rules")
+	cmd.RegisterFlagCompletionFunc("rule", completeRules)
+	cmd.Flags().IntVar(&last, "last", 0, "only show the last N alerts")
+	addArchiveFlag(cmd)
+	return cmd
+}
@@ -0,0 +1,460 @@
+package logs
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	manifestName    = "manifest.json"
+	manifestVersion = 1
+	// importsDir keeps the manifests of the archives imported into a store. Dot directories are not namespaces.
+	importsDir = ".imports"
+)
+
+// exportFilter selects the pods written to an archive. Empty fields select everything.
+type exportFilter struct {
+	Namespaces []string   `json:"namespaces,omitempty"`
+	Owners     []string   `json:"owners,omitempty"`
+	Pods       []string   `json:"pods,omitempty"`
+	Since      *time.Time `json:"since,omitempty"`
+	Until      *time.Time `json:"until,omitempty"`
+}
+
+// match reports whether the pod is selected. A pod is in the time range if it was created
+// before Until and its log was written to after Since.
+func (f exportFilter) match(pod store.Pod, lastWrite time.Time) bool {
+	if len(f.Owners) > 0 && !slices.Contains(f.Owners, pod.Owner().String()) {
+		return false
+	}
+	if len(f.Pods) > 0 && !slices.Contains(f.Pods, pod.Name) {
+		return false
+	}
+	if f.Since != nil && lastWrite.Before(*f.Since) {
+		return false
+	}
+	if created := pod.Created(); f.Until != nil && !created.IsZero() && created.After(*f.Until) {
+		return false
+	}
+	return true
+}
+
+// archiveManifest describes an exported archive. It is written as manifest.json at the root of the archive.
+type archiveManifest struct {
+	Version         int            `json:"version"`
+	K8sdebugVersion string         `json:"k8sdebugVersion"`
+	Cluster         string         `json:"cluster,omitempty"`
+	CreatedAt       time.Time      `json:"createdAt"`
+	From            *time.Time     `json:"from,omitempty"`
+	To              *time.Time     `json:"to,omitempty"`
+	Filter          exportFilter   `json:"filter"`
+	Pods            []manifestPod  `json:"pods"`
+	Files           []manifestFile `json:"files"`
+}
+
+type manifestPod struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Owner     string `json:"owner"`
+	CreatedAt string `json:"createdAt,omitempty"`
+	Revision  int    `json:"revision,omitempty"`
+	Bytes     int64  `json:"bytes"`
+}
+
+type manifestFile struct {
+	Path   string `json:"path"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+// archiveWriter writes files to a tar.gz archive and records their checksums in the manifest.
+// Every file is compressed as its own gzip member, so --archive can decompress one file without
+// going through the ones before it.
+type archiveWriter struct {
+	out      io.Writer
+	gzw      *gzip.Writer
+	tw       *tar.Writer
+	manifest *archiveManifest
+}
+
+func (a *archiveWriter) add(name string, size int64, modTime time.Time, r io.Reader) error {
+	if err := a.tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: size, ModTime: modTime, Typeflag: tar.TypeReg}); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+	sum := sha256.New()
+	// The size is fixed by the header, logs still being recorded are cut at the size they had when listed.
+	if _, err := io.CopyN(io.MultiWriter(a.tw, sum), r, size); err != nil {
+		return fmt.Errorf("failed to copy file contents: %w", err)
+	}
+	a.manifest.Files = append(a.manifest.Files, manifestFile{Path: name, Bytes: size, SHA256: hex.EncodeToString(sum.Sum(nil))})
+	if err := a.tw.Flush(); err != nil {
+		return err
+	}
+	if err := a.gzw.Close(); err != nil {
+		return err
+	}
+	a.gzw.Reset(a.out)
+	return nil
+}
+
+func (a *archiveWriter) addFile(name, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return a.add(name, info.Size(), info.ModTime(), f)
+}
+
+// partialFile is written next to its destination and renamed over it once complete, so that a failed
+// export leaves neither a truncated file nor a changed destination behind.
+type partialFile struct {
+	*os.File
+	dest string
+	done bool
+}
+
+func createPartial(dest string) (*partialFile, error) {
+	f, err := os.Create(dest + ".tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create destination file: %w", err)
+	}
+	return &partialFile{File: f, dest: dest}, nil
+}
+
+// commit closes the file and moves it to its destination.
+func (f *partialFile) commit() error {
+	f.done = true
+	if err := f.File.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), f.dest)
+}
+
+// discard closes and removes the file unless it was committed.
+func (f *partialFile) discard() {
+	if f.done {
+		return
+	}
+	f.File.Close()
+	os.Remove(f.Name())
+}
+
+// writeArchive exports the pods selected by the filter with their owner metadata, status and a manifest.
+func writeArchive(s *store.Store, dest string, filter exportFilter) (*archiveManifest, error) {
+	file, err := createPartial(dest)
+	if err != nil {
+		return nil, err
+	}
+	defer file.discard()
+	gzw := gzip.NewWriter(file)
+	tw := tar.NewWriter(gzw)
+	manifest := &archiveManifest{
+		Version:         manifestVersion,
+		K8sdebugVersion: pkg.BuildVersion(),
+		Cluster:         currentCluster(),
+		CreatedAt:       time.Now().UTC(),
+		Filter:          filter,
+		Pods:            make([]manifestPod, 0),
+		Files:           make([]manifestFile, 0),
+	}
+	a := &archiveWriter{out: file, gzw: gzw, tw: tw, manifest: manifest}
+	namespaces, err := s.Namespaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, ns := range namespaces {
+		if len(filter.Namespaces) > 0 && !slices.Contains(filter.Namespaces, ns) {
+			continue
+		}
+		if err := a.addNamespace(s, ns, filter); err != nil {
+			return nil, err
+		}
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: manifestName, Mode: 0644, Size: int64(len(data)), ModTime: manifest.CreatedAt, Typeflag: tar.TypeReg}); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gzw.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, file.commit()
+}
+
+func (a *archiveWriter) addNamespace(s *store.Store, ns string, filter exportFilter) error {
+	pods, err := s.AllPods(ns)
+	if err != nil {
+		return err
+	}
+	selected := make(map[store.Owner][]string)
+	for _, pod := range pods {
+		info, err := os.Stat(pod.LogPath)
+		if err != nil || !filter.match(pod, info.ModTime()) {
+			continue
+		}
+		if err := a.addFile(path.Join(ns, filepath.Base(pod.LogPath)), pod.LogPath); err != nil {
+			return err
+		}
+		if _, err := os.Stat(s.StatusPath(ns, pod.Name)); err == nil {
+			if err := a.addFile(path.Join(ns, pod.Name+".status"), s.StatusPath(ns, pod.Name)); err != nil {
+				return err
+			}
+		}
+		a.manifest.Pods = append(a.manifest.Pods, manifestPod{Namespace: ns, Name: pod.Name, Owner: pod.Owner().String(),
+			CreatedAt: pod.CreatedAt, Revision: pod.Revision, Bytes: info.Size()})
+		a.manifest.widen(pod.Created(), info.ModTime())
+		if pod.OwnerKind != "pod" {
+			selected[pod.Owner()] = append(selected[pod.Owner()], pod.Name)
+		}
+	}
+	owners := make([]store.Owner, 0, len(selected))
+	for o := range selected {
+		owners = append(owners, o)
+	}
+	sort.Slice(owners, func(i, j int) bool { return owners[i].String() < owners[j].String() })
+	for _, o := range owners {
+		metadata, err := filterMetadata(s.MetadataPath(ns, o.Kind, o.Name), selected[o])
+		if err != nil {
+			return err
+		}
+		name := path.Join(ns, filepath.Base(s.MetadataPath(ns, o.Kind, o.Name)))
+		if err := a.add(name, int64(len(metadata)), time.Now(), bytes.NewReader(metadata)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// widen extends the time range of the manifest to the lifetime of a pod.
+func (m *archiveManifest) widen(created, lastWrite time.Time) {
+	if created.IsZero() {
+		created = lastWrite
+	}
+	if m.From == nil || created.Before(*m.From) {
+		from := created.UTC()
+		m.From = &from
+	}
+	if m.To == nil || lastWrite.After(*m.To) {
+		to := lastWrite.UTC()
+		m.To = &to
+	}
+}
+
+// filterMetadata keeps the lines of the metadata file of the given pods, unchanged.
+func filterMetadata(file string, pods []string) ([]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var b bytes.Buffer
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ";")
+		if len(fields) >= 2 && slices.Contains(pods, strings.TrimSpace(fields[1])) {
+			b.WriteString(scanner.Text() + "\n")
+		}
+	}
+	return b.Bytes(), scanner.Err()
+}
+
+// currentCluster returns the cluster of the current kubeconfig context, or "" without a kubeconfig.
+func currentCluster() string {
+	config, err := clientcmd.NewDefaultClientConfigLoadingRules().Load()
+	if err != nil {
+		return ""
+	}
+	if ctx, ok := config.Contexts[config.CurrentContext]; ok {
+		return ctx.Cluster
+	}
+	return ""
+}
+
+// scannedArchive is the content of an archive read before anything is extracted.
+type scannedArchive struct {
+	manifest     *archiveManifest
+	manifestData []byte
+	// sums maps the path of every regular file to its sha256.
+	sums map[string]string
+}
+
+func scanArchive(source string) (*scannedArchive, error) {
+	file, err := os.Open(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer file.Close()
+	gzr, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+	defer gzr.Close()
+	scanned := &scannedArchive{sums: make(map[string]string)}
+	tr := tar.NewReader(gzr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tar read error: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(header.Name)
+		if name == ".." || strings.HasPrefix(name, "../") || path.IsAbs(name) {
+			return nil, fmt.Errorf("illegal file path: %s", header.Name)
+		}
+		if name == manifestName {
+			if scanned.manifestData, err = io.ReadAll(tr); err != nil {
+				return nil, err
+			}
+			scanned.manifest = &archiveManifest{}
+			if err := json.Unmarshal(scanned.manifestData, scanned.manifest); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", manifestName, err)
+			}
+			continue
+		}
+		sum := sha256.New()
+		if _, err := io.Copy(sum, tr); err != nil {
+			return nil, fmt.Errorf("tar read error: %w", err)
+		}
+		scanned.sums[name] = hex.EncodeToString(sum.Sum(nil))
+	}
+	return scanned, nil
+}
+
+// verify compares the files of the archive with the checksums of its manifest.
+func (a *scannedArchive) verify() []string {
+	if a.manifest == nil {
+		return []string{"the archive has no " + manifestName}
+	}
+	problems := make([]string, 0)
+	listed := make(map[string]bool)
+	for _, f := range a.manifest.Files {
+		listed[f.Path] = true
+		sum, ok := a.sums[f.Path]
+		switch {
+		case !ok:
+			problems = append(problems, "missing file "+f.Path)
+		case sum != f.SHA256:
+			problems = append(problems, "checksum mismatch for "+f.Path)
+		}
+	}
+	for name := range a.sums {
+		if !listed[name] {
+			problems = append(problems, "file not in the manifest "+name)
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// conflicts splits the files of the archive into files identical to the ones already in dest, which are
+// skipped, and files that would overwrite different content. Metadata files never conflict, they are merged.
+func (a *scannedArchive) conflicts(dest string) (identical map[string]bool, conflicting []string) {
+	identical = make(map[string]bool)
+	for name, sum := range a.sums {
+		existing, err := fileSHA256(filepath.Join(dest, filepath.FromSlash(name)))
+		if err != nil {
+			continue
+		}
+		if existing == sum {
+			identical[name] = true
+		} else if !strings.HasSuffix(name, ".metadata") {
+			conflicting = append(conflicting, name)
+		}
+	}
+	sort.Strings(conflicting)
+	return identical, conflicting
+}
+
+// mergeMetadata adds the metadata lines of r missing from the file, keeping the lines in chronological order.
+func mergeMetadata(file string, r io.Reader) error {
+	existing, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	incoming, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimRight(string(existing), "\n"), "\n")
+	for _, line := range strings.Split(strings.TrimRight(string(incoming), "\n"), "\n") {
+		if line != "" && !slices.Contains(lines, line) {
+			lines = append(lines, line)
+		}
+	}
+	// Lines start with the creation time of the pod.
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i] < lines[j] })
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func fileSHA256(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	sum := sha256.New()
+	if _, err := io.Copy(sum, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// parseTimeFlag parses --since and --until: a duration before now like 2h, RFC 3339 or "2006-01-02 15:04:05" in local time.
+func parseTimeFlag(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		t := time.Now().Add(-d)
+		return &t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.ParseInLocation(store.TimeFormat, value, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time %q, use a duration like 2h, RFC 3339 or %q", value, store.TimeFormat)
+	}
+	return &t, nil
+}
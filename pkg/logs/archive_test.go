@@ -0,0 +1,271 @@
+package logs
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg/logexport"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(data)
+}
+
+// newArchiveStore records api-1 (revision 1, last written two days ago) and api-2 (revision 2) of deployment/api,
+// a standalone pod and a pod of another namespace.
+func newArchiveStore(t *testing.T) *store.Store {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"shop/deployment.api.metadata": "2025-01-01 10:00:00 ; api-1 ; api-5d4 ; 1\n2025-01-02 10:00:00 ; api-2 ; api-6e5 ; 2\n",
+		"shop/api-1.log":               "one\n",
+		"shop/api-2.log":               "two\n",
+		"shop/api-2.status":            `{"phase":"Running"}`,
+		"shop/debug.log":               "debug\n",
+		"other/db-0.log":               "db\n",
+	})
+	old := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(root, "shop", "api-1.log"), old, old))
+	return store.New(root)
+}
+
+// useLogStore makes the commands read the recorded logs from s, as if it had been opened with --archive.
+func useLogStore(t *testing.T, s *store.Store) {
+	path, previous := archivePath, archiveStore
+	t.Cleanup(func() { archivePath, archiveStore = path, previous })
+	archivePath, archiveStore = s.Root, s
+}
+
+// rewriteArchive copies the archive at src to dst, passing the content of every file through fn.
+// A nil result drops the file.
+func rewriteArchive(t *testing.T, src, dst string, fn func(name string, data []byte) []byte) {
+	in, err := os.Open(src)
+	require.NoError(t, err)
+	defer in.Close()
+	gzr, err := gzip.NewReader(in)
+	require.NoError(t, err)
+	out, err := os.Create(dst)
+	require.NoError(t, err)
+	defer out.Close()
+	gzw := gzip.NewWriter(out)
+	tw := tar.NewWriter(gzw)
+	tr := tar.NewReader(gzr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		if data = fn(header.Name, data); data == nil {
+			continue
+		}
+		header.Size = int64(len(data))
+		require.NoError(t, tw.WriteHeader(header))
+		_, err = tw.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+}
+
+func TestExportFilter(t *testing.T) {
+	s := newArchiveStore(t)
+	since := time.Now().Add(-time.Hour)
+	for _, tc := range []struct {
+		name   string
+		filter exportFilter
+		pods   []string
+	}{
+		{"everything", exportFilter{}, []string{"db-0", "api-1", "api-2", "debug"}},
+		{"namespace", exportFilter{Namespaces: []string{"other"}}, []string{"db-0"}},
+		{"owner", exportFilter{Owners: []string{"deployment/api"}}, []string{"api-1", "api-2"}},
+		{"pods", exportFilter{Pods: []string{"debug", "db-0"}}, []string{"db-0", "debug"}},
+		{"since", exportFilter{Owners: []string{"deployment/api"}, Since: &since}, []string{"api-2"}},
+	} {
+		manifest, err := writeArchive(s, filepath.Join(t.TempDir(), "capture.tgz"), tc.filter)
+		require.NoError(t, err, tc.name)
+		names := make([]string, 0, len(manifest.Pods))
+		for _, p := range manifest.Pods {
+			names = append(names, p.Name)
+		}
+		assert.ElementsMatch(t, tc.pods, names, tc.name)
+
+		// The payload formats export the same pods.
+		var out bytes.Buffer
+		exporter, err := newLogsExporter(logexport.FormatLoki, "", 10)
+		require.NoError(t, err)
+		exporter.out = &out
+		require.NoError(t, exporter.export(s, tc.filter), tc.name)
+		assert.Equal(t, len(tc.pods), exporter.pods, tc.name)
+		for _, pod := range tc.pods {
+			assert.Contains(t, out.String(), `"pod":"`+pod+`"`, tc.name)
+		}
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	s := newArchiveStore(t)
+	since := time.Now().Add(-time.Hour)
+	source := filepath.Join(t.TempDir(), "capture.tgz")
+	manifest, err := writeArchive(s, source, exportFilter{Owners: []string{"deployment/api"}, Since: &since})
+	require.NoError(t, err)
+	require.Len(t, manifest.Pods, 1)
+	assert.Equal(t, manifestPod{Namespace: "shop", Name: "api-2", Owner: "deployment/api", CreatedAt: "2025-01-02 10:00:00", Revision: 2, Bytes: 4}, manifest.Pods[0])
+
+	archive, err := scanArchive(source)
+	require.NoError(t, err)
+	assert.Empty(t, archive.verify())
+	assert.ElementsMatch(t, []string{"shop/api-2.log", "shop/api-2.status", "shop/deployment.api.metadata"}, keys(archive.sums))
+
+	dest := t.TempDir()
+	identical, conflicting := archive.conflicts(dest)
+	assert.Empty(t, identical)
+	assert.Empty(t, conflicting)
+	written, err := extractTar(source, dest, identical)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, keys(archive.sums), written)
+	assert.Equal(t, "two\n", readFile(t, filepath.Join(dest, "shop", "api-2.log")))
+	assert.Equal(t, "2025-01-02 10:00:00 ; api-2 ; api-6e5 ; 2\n", readFile(t, filepath.Join(dest, "shop", "deployment.api.metadata")),
+		"only the lines of the exported pods are kept")
+	assert.NoFileExists(t, filepath.Join(dest, manifestName))
+
+	// Importing the same archive again finds only identical files.
+	identical, conflicting = archive.conflicts(dest)
+	assert.Len(t, identical, 3)
+	assert.Empty(t, conflicting)
+}
+
+func TestArchiveVerify(t *testing.T) {
+	s := newArchiveStore(t)
+	source := filepath.Join(t.TempDir(), "capture.tgz")
+	_, err := writeArchive(s, source, exportFilter{Namespaces: []string{"shop"}})
+	require.NoError(t, err)
+
+	tampered := filepath.Join(t.TempDir(), "tampered.tgz")
+	rewriteArchive(t, source, tampered, func(name string, data []byte) []byte {
+		switch name {
+		case "shop/api-1.log":
+			return []byte("changed\n")
+		case "shop/debug.log":
+			return nil
+		}
+		return data
+	})
+	archive, err := scanArchive(tampered)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"checksum mismatch for shop/api-1.log", "missing file shop/debug.log"}, archive.verify())
+
+	bare := filepath.Join(t.TempDir(), "bare.tgz")
+	rewriteArchive(t, source, bare, func(name string, data []byte) []byte {
+		if name == manifestName {
+			return nil
+		}
+		return data
+	})
+	archive, err = scanArchive(bare)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"the archive has no manifest.json"}, archive.verify())
+}
+
+func TestArchiveConflictsAndMerge(t *testing.T) {
+	s := newArchiveStore(t)
+	source := filepath.Join(t.TempDir(), "capture.tgz")
+	_, err := writeArchive(s, source, exportFilter{Pods: []string{"api-2"}})
+	require.NoError(t, err)
+	archive, err := scanArchive(source)
+	require.NoError(t, err)
+
+	dest := t.TempDir()
+	writeFiles(t, dest, map[string]string{
+		"shop/deployment.api.metadata": "2025-01-03 10:00:00 ; api-3 ; api-7f6 ; 3\n2025-01-01 10:00:00 ; api-1 ; api-5d4 ; 1\n",
+		"shop/api-2.log":               "different\n",
+		"shop/api-2.status":            `{"phase":"Running"}`,
+	})
+	identical, conflicting := archive.conflicts(dest)
+	assert.Equal(t, []string{"shop/api-2.log"}, conflicting, "metadata files never conflict")
+	assert.Equal(t, map[string]bool{"shop/api-2.status": true}, identical)
+
+	written, err := extractTar(source, dest, identical)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"shop/api-2.log", "shop/deployment.api.metadata"}, written)
+	assert.Equal(t, "two\n", readFile(t, filepath.Join(dest, "shop", "api-2.log")))
+	merged := "2025-01-01 10:00:00 ; api-1 ; api-5d4 ; 1\n" +
+		"2025-01-02 10:00:00 ; api-2 ; api-6e5 ; 2\n" +
+		"2025-01-03 10:00:00 ; api-3 ; api-7f6 ; 3\n"
+	assert.Equal(t, merged, readFile(t, filepath.Join(dest, "shop", "deployment.api.metadata")))
+
+	_, err = extractTar(source, dest, nil)
+	require.NoError(t, err)
+	assert.Equal(t, merged, readFile(t, filepath.Join(dest, "shop", "deployment.api.metadata")), "merged lines are not duplicated")
+}
+
+func TestExtractTarFailure(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "broken.tgz")
+	out, err := os.Create(source)
+	require.NoError(t, err)
+	gzw := gzip.NewWriter(out)
+	tw := tar.NewWriter(gzw)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "shop/api-1.log", Mode: 0644, Size: 4, Typeflag: tar.TypeReg}))
+	_, err = tw.Write([]byte("one\n"))
+	require.NoError(t, err)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "shop/link.log", Linkname: "/etc/passwd", Typeflag: tar.TypeSymlink}))
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+	require.NoError(t, out.Close())
+
+	dest := t.TempDir()
+	written, err := extractTar(source, dest, nil)
+	assert.ErrorContains(t, err, "unsupported file type")
+	assert.Equal(t, []string{"shop/api-1.log"}, written, "the files written before the error are reported")
+	assert.NoFileExists(t, filepath.Join(dest, "shop", "link.log"))
+}
+
+func TestWriteArchiveFailure(t *testing.T) {
+	s := newArchiveStore(t)
+	// A status that cannot be read fails the export after api-2.log was written.
+	require.NoError(t, os.Remove(s.StatusPath("shop", "api-2")))
+	require.NoError(t, os.Mkdir(s.StatusPath("shop", "api-2"), 0755))
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "capture.tgz")
+	require.NoError(t, os.WriteFile(dest, []byte("previous"), 0644))
+
+	_, err := writeArchive(s, dest, exportFilter{Pods: []string{"api-2"}})
+	require.Error(t, err)
+	assert.Equal(t, "previous", readFile(t, dest), "the destination is only replaced by a complete archive")
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "the partial archive is removed")
+
+	_, err = writeArchive(newArchiveStore(t), dest, exportFilter{})
+	require.NoError(t, err)
+	_, err = scanArchive(dest)
+	assert.NoError(t, err)
+}
+
+func keys(m map[string]string) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
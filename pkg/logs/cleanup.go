@@ -1,35 +1,261 @@
 package logs
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"text/tabwriter"
+	"time"
 
 	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/completion"
+	"github.com/revolyssup/k8sdebug/pkg/output"
+	"github.com/revolyssup/k8sdebug/pkg/retention"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/revolyssup/k8sdebug/pkg/workspace"
 	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
+// cleanedPod is a pod removed, or that would be removed with --dry-run, by a retention policy.
+type cleanedPod struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Owner     string `json:"owner"`
+	Bytes     int64  `json:"bytes"`
+	Reason    string `json:"reason"`
+}
+
+type cleanupResult struct {
+	DryRun bool         `json:"dryRun"`
+	Pods   []cleanedPod `json:"pods"`
+	Bytes  int64        `json:"bytes"`
+}
+
 func newCleanupCommand() *cobra.Command {
-	var hardClean bool
+	var hardClean, dryRun, allNamespaces, archiveCache bool
+	var olderThan, maxSize string
+	var policy retention.Policy
 	cmd := &cobra.Command{
 		Use:   "cleanup",
 		Short: "Cleanup logs of a pod",
+		Long: `Without a retention policy, delete the logs of the namespace. With --hard, delete the whole store of the active
+workspace instead: every namespace with its logs, metadata, statuses and crash bundles. For a workspace other than
+default this empties the workspace, "workspace rm" removes it.
+
+With a retention policy only the selected pods are deleted, together with their status, hook output, crash bundles
+and their lines in the owner metadata, so that no dangling entries are left. Their sizes count towards --max-size.
+A pod is deleted if any of the rules selects it:
+  --older-than      the log was last written longer ago than this, e.g. 7d or 36h
+  --max-size        the logs are larger than this, e.g. 500MB: terminated pods are evicted oldest first. Running pods are kept
+  --owner           the pod belongs to this owner, e.g. deployment/api. Can be repeated
+  --gone            the pod no longer exists in the cluster. Without access to the cluster, the status kept by the recorder is used
+  --keep-revisions  the pod belongs to a deployment revision older than the last N
+
+Without policy flags and without --hard, the retention policy of the settings is used, see config --help.
+The policy applies to the namespace given with -n, or to the whole store with -A.
+With --dry-run nothing is deleted and the pods that would be deleted are listed with the space that would be freed.
+
+With --archive-cache only the indexes cached for the archives opened with --archive are deleted. At most 32
+are kept, the least recently opened ones are evicted first.`,
 		Run: func(cmd *cobra.Command, args []string) {
-			cmd.Println("Cleaning up logs...")
-			if hardClean {
-				if err := os.RemoveAll(pkg.ConfigData.LogsPath); err != nil {
-					cmd.Println("Error cleaning up logs:", err)
+			if archiveCache {
+				if err := store.ClearArchiveCache(archiveCacheDir()); err != nil {
+					cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
 					return
 				}
-			} else {
-				if err := os.RemoveAll(filepath.Join(pkg.ConfigData.LogsPath, namespace)); err != nil {
-					cmd.Println("Error cleaning up logs:", err)
+				cmd.Println("Archive indexes cleaned up successfully.")
+				return
+			}
+			if r := pkg.Settings.Retention; !hardClean && !r.Empty() && !cmd.Flags().Changed("older-than") && !cmd.Flags().Changed("max-size") &&
+				!cmd.Flags().Changed("owner") && !cmd.Flags().Changed("gone") && !cmd.Flags().Changed("keep-revisions") {
+				olderThan, maxSize = r.OlderThan, r.MaxSize
+				policy.KeepRevisions, policy.Gone = r.Revisions(), r.DeleteGone()
+			}
+			var err error
+			if olderThan != "" {
+				if policy.OlderThan, err = retention.ParseAge(olderThan); err != nil {
+					cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+					return
+				}
+			}
+			if maxSize != "" {
+				if policy.MaxBytes, err = retention.ParseSize(maxSize); err != nil {
+					cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
 					return
 				}
 			}
+			if policy.OlderThan > 0 || policy.MaxBytes > 0 || len(policy.Owners) > 0 || policy.Gone || policy.KeepRevisions > 0 {
+				cleanupByPolicy(cmd, policy, allNamespaces, dryRun)
+				return
+			}
+			dir := filepath.Join(logStore().Root, namespace)
+			if hardClean {
+				dir = logStore().Root
+			}
+			if dryRun {
+				cmd.Printf("Would remove %s (%s)\n", dir, humanBytes(dirSize(dir)))
+				return
+			}
+			if hardClean {
+				cmd.Printf("Cleaning up the store of workspace %s at %s...\n", workspace.Active(), dir)
+			} else {
+				cmd.Println("Cleaning up logs...")
+			}
+			if err := os.RemoveAll(dir); err != nil {
+				cmd.Println("Error cleaning up logs:", err)
+				return
+			}
 			cmd.Println("Logs cleaned up successfully.")
 		},
 	}
 
-	cmd.Flags().BoolVar(&hardClean, "hard", false, "Whether to hard clean the logs and delete everything")
+	cmd.Flags().BoolVar(&hardClean, "hard", false, "delete the whole store of the active workspace, all namespaces included")
+	cmd.Flags().BoolVar(&archiveCache, "archive-cache", false, "delete the indexes cached for the archives opened with --archive")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "print what would be deleted and the space freed without deleting anything")
+	cmd.Flags().BoolVarP(&allNamespaces, "all-namespaces", "A", false, "apply the retention policy to every recorded namespace")
+	cmd.Flags().StringVar(&olderThan, "older-than", "", "delete pods whose log was last written longer ago than this, e.g. 7d or 36h")
+	cmd.Flags().StringVar(&maxSize, "max-size", "", "evict terminated pods, oldest first, until the logs fit in this size, e.g. 500MB or 2GiB")
+	cmd.Flags().StringSliceVar(&policy.Owners, "owner", nil, "delete the pods of this owner, e.g. deployment/api")
+	cmd.RegisterFlagCompletionFunc("owner", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		c, ok := completer()
+		if !ok {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return completion.Values(c.Owners(namespace), toComplete)
+	})
+	cmd.Flags().BoolVar(&policy.Gone, "gone", false, "delete pods that no longer exist in the cluster")
+	cmd.Flags().IntVar(&policy.KeepRevisions, "keep-revisions", 0, "keep only the pods of the last N revisions of every deployment")
 	return cmd
 }
+
+// cleanupByPolicy deletes the pods selected by the retention policy, or only lists them with dryRun.
+func cleanupByPolicy(cmd *cobra.Command, policy retention.Policy, allNamespaces, dryRun bool) {
+	s := logStore()
+	namespaces := []string{namespace}
+	if allNamespaces {
+		var err error
+		if namespaces, err = s.Namespaces(); err != nil {
+			cmd.Println(pkg.ColorLine(fmt.Sprintf("could not read the log store: %v", err), pkg.ColorRed))
+			return
+		}
+	}
+	candidates := make([]retention.Candidate, 0)
+	for _, ns := range namespaces {
+		pods, err := s.AllPods(ns)
+		if err != nil {
+			cmd.Println("No logs found for namespace:", ns)
+			continue
+		}
+		var existing map[string]bool
+		if policy.Gone {
+			if existing, err = clusterPods(ns); err != nil {
+				cmd.PrintErrln(pkg.ColorLine(fmt.Sprintf("could not list the pods of %s in the cluster, using the recorded status: %v", ns, err), pkg.ColorYellow))
+			}
+		}
+		for _, pod := range pods {
+			candidates = append(candidates, retentionCandidate(s, pod, existing))
+		}
+	}
+	removals := retention.Plan(candidates, policy, time.Now())
+	result := cleanupResult{DryRun: dryRun, Pods: make([]cleanedPod, 0, len(removals))}
+	pods := make([]store.Pod, 0, len(removals))
+	for _, r := range removals {
+		result.Pods = append(result.Pods, cleanedPod{Namespace: r.Pod.Namespace, Pod: r.Pod.Name, Owner: r.Pod.Owner().String(), Bytes: r.Bytes, Reason: r.Reason})
+		result.Bytes += r.Bytes
+		pods = append(pods, r.Pod)
+	}
+	if !dryRun {
+		if err := s.RemovePods(pods); err != nil {
+			cmd.Println(pkg.ColorLine(fmt.Sprintf("Error cleaning up logs: %v", err), pkg.ColorRed))
+			return
+		}
+	}
+	if output.Structured() {
+		if err := output.Write(os.Stdout, result); err != nil {
+			cmd.PrintErrln("Error encoding cleanup:", err)
+		}
+		return
+	}
+	if len(result.Pods) == 0 {
+		cmd.Println("No pods matched the retention policy.")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tPOD\tOWNER\tSIZE\tREASON")
+	for _, p := range result.Pods {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", p.Namespace, p.Pod, p.Owner, humanBytes(p.Bytes), p.Reason)
+	}
+	w.Flush()
+	if dryRun {
+		cmd.Println(pkg.ColorLine(fmt.Sprintf("Would delete %d pods and free %s", len(result.Pods), humanBytes(result.Bytes)), pkg.ColorYellow))
+		return
+	}
+	cmd.Println(pkg.ColorLine(fmt.Sprintf("Deleted %d pods and freed %s", len(result.Pods), humanBytes(result.Bytes)), pkg.ColorGreen))
+}
+
+// retentionCandidate describes a recorded pod for the retention policy. existing holds the pods of the
+// cluster, or is nil to rely on the status kept by the recorder.
+func retentionCandidate(s *store.Store, pod store.Pod, existing map[string]bool) retention.Candidate {
+	c := retention.Candidate{Pod: pod, Terminated: true}
+	if info, err := s.Stat(pod.LogPath); err == nil {
+		c.Bytes = info.Size()
+		c.LastWrite = info.ModTime()
+	}
+	if info, err := s.Stat(s.StatusPath(pod.Namespace, pod.Name)); err == nil {
+		c.Bytes += info.Size()
+	}
+	// The hook output and the crash bundles are deleted with the pod.
+	c.Bytes += dirSize(s.HooksPath(pod.Namespace, pod.Name))
+	crashes, _ := s.PodCrashPaths(pod.Namespace, pod.Name)
+	for _, dir := range crashes {
+		c.Bytes += dirSize(dir)
+	}
+	if status, err := s.Status(pod.Namespace, pod.Name); err == nil {
+		c.Terminated = status.Deleted || status.Phase == "Succeeded" || status.Phase == "Failed"
+		c.Gone = status.Deleted
+	}
+	if existing != nil {
+		c.Gone = !existing[pod.Name]
+	}
+	return c
+}
+
+// clusterPods returns the names of the pods of the namespace in the cluster of the current kubeconfig.
+func clusterPods(ns string) (map[string]bool, error) {
+	kubeconfig := clientcmd.NewDefaultClientConfigLoadingRules().GetDefaultFilename()
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	cs, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	list, err := cs.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]bool, len(list.Items))
+	for _, pod := range list.Items {
+		existing[pod.Name] = true
+	}
+	return existing, nil
+}
+
+// dirSize returns the total size of the files under dir.
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
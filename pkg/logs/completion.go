@@ -0,0 +1,108 @@
+package logs
+
+import (
+	"path/filepath"
+
+	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/alert"
+	"github.com/revolyssup/k8sdebug/pkg/completion"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+// completer suggests names from the store the logs commands read and from the cluster. It returns false
+// when the archive given with --archive cannot be opened, and then nothing is suggested.
+func completer() (*completion.Completer, bool) {
+	s, err := openLogStore()
+	if err != nil {
+		return nil, false
+	}
+	return completion.New(s), true
+}
+
+// completeName completes the name of the pod, or of the owner of kind --type, taken as first argument.
+func completeName(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	c, ok := completer()
+	if len(args) > 0 || !ok {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completion.Values(c.Names(namespace, typ), toComplete)
+}
+
+// completeOwnerPods completes the pods recorded for the owner given as first argument, or any pod with --type pod.
+func completeOwnerPods(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	c, ok := completer()
+	if !ok {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	if len(args) == 0 || typ == "pod" {
+		return completion.Values(c.Pods(namespace), toComplete)
+	}
+	pods, _ := logStore().Pods(namespace, typ, args[0])
+	names := make([]string, 0, len(pods))
+	for _, p := range pods {
+		names = append(names, p.Name)
+	}
+	return completion.Values(names, toComplete)
+}
+
+// completeCrashes completes the pods with crash bundles and the bundle ids of the namespace.
+func completeCrashes(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	s, err := openLogStore()
+	if len(args) > 0 || err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	crashes, _ := s.Crashes(namespace)
+	var names []string
+	for _, c := range crashes {
+		names = append(names, c.Pod, c.ID)
+	}
+	return completion.Values(names, toComplete)
+}
+
+// completeRules completes the rule names of the default alert rules file.
+func completeRules(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	c, err := alert.Load(filepath.Join(filepath.Dir(pkg.ConfigFilePath), "alerts.yaml"))
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var names []string
+	for _, r := range c.Rules {
+		names = append(names, r.Name)
+	}
+	return completion.Values(names, toComplete)
+}
+
+// completeRecorded completes a list flag with the names found by names in every recorded namespace.
+func completeRecorded(names func(s *store.Store, namespace string) []string) cobra.CompletionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		s, err := openLogStore()
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		namespaces, _ := s.Namespaces()
+		var all []string
+		for _, ns := range namespaces {
+			all = append(all, names(s, ns)...)
+		}
+		return completion.Values(all, toComplete)
+	}
+}
+
+// registerCompletions completes the persistent flags shared by the logs commands.
+func registerCompletions(cmd *cobra.Command) {
+	cmd.RegisterFlagCompletionFunc("namespace", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		c, ok := completer()
+		if !ok {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return completion.Values(c.Namespaces(), toComplete)
+	})
+	cmd.RegisterFlagCompletionFunc("type", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		c, ok := completer()
+		if !ok {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return completion.Values(c.Kinds(namespace), toComplete)
+	})
+}
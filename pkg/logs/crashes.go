@@ -0,0 +1,130 @@
+package logs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/output"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+func newCrashesCommand() *cobra.Command {
+	var since string
+	var last int
+	var allNamespaces bool
+	cmd := &cobra.Command{
+		Use:   "crashes [pod|bundle]",
+		Short: "List the crash bundles assembled by the recorder",
+		Long: `List the crash bundles assembled by the recorder, oldest first, or show the content of one bundle.
+
+When a container of a recorded pod terminates with a non-zero exit code, the recorder assembles a bundle in
+<namespace>/crashes/<pod>-<container>-<time>/ with:
+  logs/<container>.log           the last lines of every container (logs record run --crash-lines, default 200)
+  logs/<container>.previous.log  the last lines of the previous instance of the containers that restarted
+  pod.yaml                       the pod spec and its final status
+  owner.yaml                     the specs of the owners of the pod, e.g. its ReplicaSet and Deployment
+  events.yaml                    the events of the pod and of its owners
+  siblings/<pod>.log             the recorded log tail of the other live pods of the owner at the time of the crash
+  bundle.json                    the termination and the parts that could not be collected
+
+With a pod name only its bundles are listed. With a bundle id the files of the bundle are listed.`,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeCrashes,
+		Run: func(cmd *cobra.Command, args []string) {
+			from, err := parseTimeFlag(since)
+			if err != nil {
+				cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+				return
+			}
+			s := logStore()
+			namespaces := []string{namespace}
+			if allNamespaces {
+				if namespaces, err = s.Namespaces(); err != nil {
+					cmd.Println(pkg.ColorLine(fmt.Sprintf("could not read the log store: %v", err), pkg.ColorRed))
+					return
+				}
+			}
+			crashes := make([]store.Crash, 0)
+			for _, ns := range namespaces {
+				found, err := s.Crashes(ns)
+				if err != nil {
+					cmd.Println(pkg.ColorLine(fmt.Sprintf("could not read the crash bundles of %s: %v", ns, err), pkg.ColorRed))
+					return
+				}
+				crashes = append(crashes, found...)
+			}
+			if len(args) == 1 {
+				if i := slices.IndexFunc(crashes, func(c store.Crash) bool { return c.ID == args[0] }); i >= 0 {
+					printCrash(cmd, s, crashes[i])
+					return
+				}
+				crashes = slices.DeleteFunc(crashes, func(c store.Crash) bool { return c.Pod != args[0] })
+			}
+			crashes = slices.DeleteFunc(crashes, func(c store.Crash) bool {
+				return from != nil && c.FinishedAt.Before(*from)
+			})
+			slices.SortStableFunc(crashes, func(a, b store.Crash) int { return a.FinishedAt.Compare(b.FinishedAt) })
+			if last > 0 && len(crashes) > last {
+				crashes = crashes[len(crashes)-last:]
+			}
+			if output.Structured() {
+				if err := output.Write(os.Stdout, crashes); err != nil {
+					cmd.PrintErrln("Error encoding crashes:", err)
+				}
+				return
+			}
+			if len(crashes) == 0 {
+				cmd.Println("No crash bundles recorded.")
+				return
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "TIME\tNAMESPACE\tPOD\tCONTAINER\tEXIT\tREASON\tRESTARTS\tBUNDLE")
+			for _, c := range crashes {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%d\t%s\n", formatSeen(c.FinishedAt), c.Namespace, c.Pod, c.Container, c.ExitCode, c.Reason, c.Restarts, c.ID)
+			}
+			w.Flush()
+		},
+	}
+	cmd.Flags().StringVar(&since, "since", "", `only list crashes after this time, e.g. 2h or "2025-01-02 15:04:05"`)
+	cmd.Flags().IntVar(&last, "last", 0, "only list the last N crashes")
+	cmd.Flags().BoolVarP(&allNamespaces, "all-namespaces", "A", false, "list the crashes of every recorded namespace")
+	addArchiveFlag(cmd)
+	return cmd
+}
+
+// printCrash describes a bundle and lists its files with their size.
+func printCrash(cmd *cobra.Command, s *store.Store, c store.Crash) {
+	if output.Structured() {
+		if err := output.Write(os.Stdout, c); err != nil {
+			cmd.PrintErrln("Error encoding crash:", err)
+		}
+		return
+	}
+	cmd.Printf("Pod %s/%s", c.Namespace, c.Pod)
+	if c.Owner != "" {
+		cmd.Printf(" of %s", c.Owner)
+	}
+	cmd.Printf(": container %s exited with %d", c.Container, c.ExitCode)
+	if c.Reason != "" {
+		cmd.Printf(" (%s)", c.Reason)
+	}
+	cmd.Printf(" at %s after %d restarts\n", formatSeen(c.FinishedAt), c.Restarts)
+	cmd.Println("Bundle:", c.Path)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, name := range c.Files {
+		size := "-"
+		if info, err := s.Stat(filepath.Join(c.Path, filepath.FromSlash(name))); err == nil {
+			size = humanBytes(info.Size())
+		}
+		fmt.Fprintf(w, "  %s\t%s\n", name, size)
+	}
+	w.Flush()
+	for _, e := range c.Errors {
+		cmd.Println(pkg.ColorLine("Not collected: "+e, pkg.ColorYellow))
+	}
+}
@@ -1,116 +1,397 @@
 package logs
 
 import (
-	"bufio"
 	"fmt"
 	"os"
-	"path/filepath"
-	"strings"
+	"strconv"
 
 	"github.com/pmezard/go-difflib/difflib"
 	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/completion"
+	"github.com/revolyssup/k8sdebug/pkg/diffrender"
+	"github.com/revolyssup/k8sdebug/pkg/output"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/revolyssup/k8sdebug/pkg/workspace"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
+var (
+	diffFrom     string
+	diffTo       string
+	diffBaseline bool
+	diffRevision string
+	diffFormat   string
+	diffWidth    int
+
+	diffFromWorkspace string
+	diffToWorkspace   string
+)
+
+const (
+	diffFormatUnified    = "unified"
+	diffFormatSideBySide = "side-by-side"
+	diffFormatJSON       = "json"
+	diffFormatHTML       = "html"
+)
+
+// podPair is a pair of pods whose logs are diffed, A being the older side.
+type podPair struct {
+	A store.Pod
+	B store.Pod
+}
+
 func newDiffCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "diff",
 		Short: "diff logs of a pod",
-		Args:  cobra.ExactArgs(1),
+		Long: `Diff logs of the pods created under an owner.
+
+By default consecutive pods are diffed (1st vs 2nd, 2nd vs 3rd, ...). The pairing can be changed with:
+  --from/--to   diff two pods, given by name or by chronological index (starting at 1)
+  --baseline    diff every pod against the first (oldest) pod
+  --revision    diff the pods of a ReplicaSet revision against the previous revision ("latest" for the newest one)
+
+With --from-workspace/--to-workspace the pods recorded in one workspace are diffed against the pods of the same
+owner in another workspace, e.g. a staging capture against a dev capture. Either side defaults to the active
+workspace. The pods of both sides are paired in creation order, --from and --to pick a single pod on each side.
+
+With --fields only the selected fields of JSON and logfmt lines are compared.`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeName,
 		Run: func(cmd *cobra.Command, args []string) {
 			name := args[0]
-			totalPods := 0
-			podNames := make([]string, 0)
-			logPaths := make([]string, 0)
-			timeStamps := make([]string, 0)
-			switch typ {
-			case "pod":
-				path := filepath.Join(pkg.ConfigData.LogsPath, namespace, fmt.Sprintf("%s.log", name))
-				logs, err := os.ReadFile(path)
-				if err != nil {
-					cmd.Println("No logs found for pod:", name)
+			if err := setupLineTransform(false); err != nil {
+				cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+				return
+			}
+			// A multi-line event is compared as a single line so that a changed frame marks the whole stack trace.
+			eventSeparator = " ⏎ "
+			var pairs []podPair
+			var err error
+			if diffFromWorkspace != "" || diffToWorkspace != "" {
+				if archivePath != "" {
+					cmd.Println(pkg.ColorLine("--archive cannot be combined with --from-workspace and --to-workspace, import the archive into a workspace instead", pkg.ColorRed))
 					return
 				}
-				cmd.Println(pkg.ColorLine("Logs from pod ", pkg.ColorYellow), name, ":", "\n", string(logs))
-
-			case "deployment":
-				path := filepath.Join(pkg.ConfigData.LogsPath, namespace, fmt.Sprintf("deployment.%s.metadata", name))
-				f, err := os.Open(path)
-				if err != nil {
-					cmd.Println("No logs found for deployment:", name)
+				if pairs, err = workspacePairs(name); err != nil {
+					cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
 					return
 				}
-				buf := bufio.NewScanner(f)
-				buf.Split(bufio.ScanLines)
-				for buf.Scan() {
-					if !latestFirst && totalPods >= maxPods {
-						break
-					}
-					line := buf.Text()
-					if line == "" {
-						continue
-					}
-					ele := strings.Split(line, ";")
-					if len(ele) < 2 {
-						continue
-					}
-					podName := strings.TrimSpace(ele[1])
-					logPath := filepath.Join(pkg.ConfigData.LogsPath, namespace, fmt.Sprintf("%s.log", podName))
-					podNames = append(podNames, podName)
-					logPaths = append(logPaths, logPath)
-					timeStamps = append(timeStamps, ele[0])
-					totalPods++
+			} else if typ == "pod" {
+				if output.Structured() {
+					writeShownPods(cmd, []store.Pod{{Name: name, Namespace: namespace, OwnerKind: "pod", OwnerName: name, LogPath: logStore().LogPath(namespace, name)}})
+					return
 				}
-
-			case "replicaset":
-				path := filepath.Join(pkg.ConfigData.LogsPath, namespace, fmt.Sprintf("replicaset.%s.metadata", name))
-				f, err := os.Open(path)
-				if err != nil {
-					cmd.Println("No logs found for replicaset:", name)
+				printPodFile(cmd, name)
+				return
+			} else {
+				pods, ok := loadOwnerPods(cmd, name)
+				if !ok {
+					return
+				}
+				if pairs, err = diffPairs(pods); err != nil {
+					cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
 					return
 				}
-				buf := bufio.NewScanner(f)
-				buf.Split(bufio.ScanLines)
-				for buf.Scan() {
-					if !latestFirst && totalPods >= maxPods {
-						break
-					}
-					line := buf.Text()
-					if line == "" {
-						continue
-					}
-					ele := strings.Split(line, ";")
-					if len(ele) < 2 {
-						continue
-					}
-					// timestamp := strings.TrimSpace(ele[0])
-					podName := strings.TrimSpace(ele[1])
-					logPath := filepath.Join(pkg.ConfigData.LogsPath, namespace, fmt.Sprintf("%s.log", podName))
-					podNames = append(podNames, podName)
-					logPaths = append(logPaths, logPath)
-					timeStamps = append(timeStamps, ele[0])
-					totalPods++
+			}
+			if output.Structured() {
+				if err := output.Write(os.Stdout, computeDiffs(cmd, pairs)); err != nil {
+					cmd.PrintErrln("Error encoding diff:", err)
 				}
+				return
+			}
+			switch diffFormat {
+			case diffFormatUnified:
+				printPodDiffs(pairs)
+			case diffFormatSideBySide, diffFormatJSON, diffFormatHTML:
+				renderPodDiffs(cmd, name, pairs)
+			default:
+				cmd.Println(pkg.ColorLine(fmt.Sprintf("unknown diff format %s", diffFormat), pkg.ColorRed))
 			}
-			printPodDiffs(getPodLogs(podNames, logPaths, timeStamps))
 		},
 	}
 	cmd.Flags().BoolVar(&onlyName, "only-names", false, "display only names")
+	cmd.Flags().StringVar(&diffFrom, "from", "", "pod name or chronological index of the old side of the diff. Defaults to the oldest pod")
+	cmd.Flags().StringVar(&diffTo, "to", "", "pod name or chronological index of the new side of the diff. Defaults to the latest pod")
+	cmd.Flags().BoolVar(&diffBaseline, "baseline", false, "diff every pod against the oldest pod")
+	cmd.Flags().StringVar(&diffFromWorkspace, "from-workspace", "", "workspace of the old side of the diff. Defaults to the active workspace")
+	cmd.Flags().StringVar(&diffToWorkspace, "to-workspace", "", "workspace of the new side of the diff. Defaults to the active workspace")
+	cmd.Flags().StringVar(&diffRevision, "revision", "", "diff pods of this ReplicaSet revision against the previous revision")
+	cmd.Flags().StringVar(&diffFormat, "format", diffFormatUnified, `how to render the diff.
+unified: colored unified diff.
+side-by-side: old and new pod in two columns fitting the terminal width.
+json: machine-readable hunks with line numbers, pods and timestamps.
+html: self-contained HTML report.
+`)
+	cmd.RegisterFlagCompletionFunc("from", completeOwnerPods)
+	cmd.RegisterFlagCompletionFunc("to", completeOwnerPods)
+	cmd.RegisterFlagCompletionFunc("from-workspace", workspace.CompleteNames)
+	cmd.RegisterFlagCompletionFunc("to-workspace", workspace.CompleteNames)
+	cmd.RegisterFlagCompletionFunc("format", completion.Fixed(diffFormatUnified, diffFormatSideBySide, diffFormatJSON, diffFormatHTML))
+	cmd.Flags().IntVar(&diffWidth, "width", 0, "width used by the side-by-side format. Defaults to the terminal width")
+	addArchiveFlag(cmd)
 	return cmd
 }
 
-func printPodDiffs(podNames []string, logSlice []string, timestamps []string) {
-	for i := 0; i < len(podNames)-1; i++ {
-		j := i + 1
-		fmt.Println("Diff between ", podNames[i], " and ", podNames[j], ":")
+// diffPairs decides which pods are diffed against each other based on the pairing flags.
+func diffPairs(pods []store.Pod) ([]podPair, error) {
+	pairs := make([]podPair, 0)
+	if len(pods) == 0 {
+		return pairs, nil
+	}
+	switch {
+	case diffFrom != "" || diffTo != "":
+		from, to := pods[0], pods[len(pods)-1]
+		var err error
+		if diffFrom != "" {
+			if from, err = resolvePod(pods, diffFrom); err != nil {
+				return nil, err
+			}
+		}
+		if diffTo != "" {
+			if to, err = resolvePod(pods, diffTo); err != nil {
+				return nil, err
+			}
+		}
+		pairs = append(pairs, podPair{A: from, B: to})
+	case diffRevision != "":
+		return revisionPairs(pods, diffRevision)
+	case diffBaseline:
+		for _, pod := range selectPods(pods) {
+			if pod.Name == pods[0].Name {
+				continue
+			}
+			pairs = append(pairs, podPair{A: pods[0], B: pod})
+		}
+	default:
+		selected := selectPods(pods)
+		for i := 0; i < len(selected)-1; i++ {
+			pairs = append(pairs, podPair{A: selected[i], B: selected[i+1]})
+		}
+	}
+	return pairs, nil
+}
+
+// resolvePod finds a pod by name or by its 1-based chronological index.
+func resolvePod(pods []store.Pod, ref string) (store.Pod, error) {
+	for _, pod := range pods {
+		if pod.Name == ref {
+			return pod, nil
+		}
+	}
+	i, err := strconv.Atoi(ref)
+	if err != nil {
+		return store.Pod{}, fmt.Errorf("no pod named %s found", ref)
+	}
+	if i < 1 || i > len(pods) {
+		return store.Pod{}, fmt.Errorf("pod index %d out of range, %d pods recorded", i, len(pods))
+	}
+	return pods[i-1], nil
+}
+
+// revisionPairs pairs the pods of revision rev with the pods of the revision before it in creation order.
+// If one revision has more pods, the last pod of the other revision is reused.
+func revisionPairs(pods []store.Pod, rev string) ([]podPair, error) {
+	revisions := store.Revisions(pods)
+	if len(revisions) == 0 {
+		return nil, fmt.Errorf("no revisions recorded")
+	}
+	target := revisions[len(revisions)-1]
+	if rev != "latest" {
+		var err error
+		if target, err = strconv.Atoi(rev); err != nil {
+			return nil, fmt.Errorf("invalid revision %s", rev)
+		}
+	}
+	prev := 0
+	for _, r := range revisions {
+		if r < target {
+			prev = r
+		}
+	}
+	if prev == 0 {
+		return nil, fmt.Errorf("no revision recorded before revision %d", target)
+	}
+	newPods := podsOfRevision(pods, target)
+	oldPods := podsOfRevision(pods, prev)
+	if len(newPods) == 0 {
+		return nil, fmt.Errorf("no pods recorded for revision %d", target)
+	}
+	return pairInOrder(oldPods, newPods), nil
+}
+
+// pairInOrder pairs old and new pods in creation order, reusing the last pod of the shorter side.
+func pairInOrder(oldPods, newPods []store.Pod) []podPair {
+	pairs := make([]podPair, 0)
+	for i := 0; i < len(newPods) || i < len(oldPods); i++ {
+		pairs = append(pairs, podPair{
+			A: oldPods[min(i, len(oldPods)-1)],
+			B: newPods[min(i, len(newPods)-1)],
+		})
+	}
+	return pairs
+}
+
+// workspacePairs pairs the pods of the owner in --from-workspace with its pods in --to-workspace.
+func workspacePairs(name string) ([]podPair, error) {
+	oldPods, err := workspacePods(diffFromWorkspace, name, diffFrom)
+	if err != nil {
+		return nil, err
+	}
+	newPods, err := workspacePods(diffToWorkspace, name, diffTo)
+	if err != nil {
+		return nil, err
+	}
+	return pairInOrder(oldPods, newPods), nil
+}
+
+// workspacePods loads the pods of the owner from a workspace, narrowed to ref if given. The pod names are
+// prefixed with the workspace so that both sides can be told apart.
+func workspacePods(ws, name, ref string) ([]store.Pod, error) {
+	if ws == "" {
+		ws = workspace.Active()
+	}
+	s, err := workspace.Open(ws)
+	if err != nil {
+		return nil, err
+	}
+	var pods []store.Pod
+	if typ == "pod" {
+		if _, err := s.Stat(s.LogPath(namespace, name)); err == nil {
+			pods = []store.Pod{{Name: name, Namespace: namespace, OwnerKind: "pod", OwnerName: name, LogPath: s.LogPath(namespace, name)}}
+		}
+	} else {
+		pods, _ = s.Pods(namespace, typ, name)
+	}
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("no logs found for %s %s in workspace %s", typ, name, ws)
+	}
+	if ref != "" {
+		pod, err := resolvePod(pods, ref)
+		if err != nil {
+			return nil, fmt.Errorf("workspace %s: %w", ws, err)
+		}
+		pods = []store.Pod{pod}
+	} else {
+		pods = selectPods(pods)
+	}
+	for i := range pods {
+		pods[i].Name = ws + ":" + pods[i].Name
+	}
+	return pods, nil
+}
+
+func podsOfRevision(pods []store.Pod, rev int) []store.Pod {
+	filtered := make([]store.Pod, 0)
+	for _, pod := range pods {
+		if pod.Revision == rev {
+			filtered = append(filtered, pod)
+		}
+	}
+	return filtered
+}
+
+// cachedLogReader returns a function reading pod logs that reads every pod at most once.
+func cachedLogReader() func(store.Pod) (string, error) {
+	logCache := make(map[string]string)
+	return func(pod store.Pod) (string, error) {
+		if logs, ok := logCache[pod.LogPath]; ok {
+			return logs, nil
+		}
+		logs, err := readPodLogs(pod)
+		if err != nil {
+			return "", err
+		}
+		logCache[pod.LogPath] = logs
+		return logs, nil
+	}
+}
+
+// computeDiffs diffs the logs of every pair. With --only-names the diffs have no hunks.
+func computeDiffs(cmd *cobra.Command, pairs []podPair) []diffrender.Diff {
+	readLogs := cachedLogReader()
+	diffs := make([]diffrender.Diff, 0, len(pairs))
+	for _, pair := range pairs {
+		from := diffrender.Side{Pod: pair.A.Name, CreatedAt: pair.A.CreatedAt}
+		to := diffrender.Side{Pod: pair.B.Name, CreatedAt: pair.B.CreatedAt}
+		if onlyName {
+			diffs = append(diffs, diffrender.Diff{From: from, To: to, Hunks: make([]diffrender.Hunk, 0)})
+			continue
+		}
+		a, err := readLogs(pair.A)
+		if err != nil {
+			cmd.PrintErrln("file not found for pod:", pair.A.Name)
+			continue
+		}
+		b, err := readLogs(pair.B)
+		if err != nil {
+			cmd.PrintErrln("file not found for pod:", pair.B.Name)
+			continue
+		}
+		diffs = append(diffs, diffrender.Compute(from, to, a, b, 3))
+	}
+	return diffs
+}
+
+// renderPodDiffs renders the diffs with one of the diffrender formats.
+func renderPodDiffs(cmd *cobra.Command, name string, pairs []podPair) {
+	diffs := computeDiffs(cmd, pairs)
+	out := cmd.OutOrStdout()
+	var err error
+	switch diffFormat {
+	case diffFormatSideBySide:
+		width := diffWidth
+		if width <= 0 {
+			width = terminalWidth()
+		}
+		for _, d := range diffs {
+			diffrender.SideBySide(out, d, width)
+			fmt.Fprintln(out, "--------------------------------------------------")
+		}
+	case diffFormatJSON:
+		err = diffrender.JSON(out, diffs)
+	case diffFormatHTML:
+		err = diffrender.HTML(out, fmt.Sprintf("k8sdebug log diff of %s %s/%s", typ, namespace, name), diffs)
+	}
+	if err != nil {
+		cmd.PrintErrln("Error rendering diff:", err)
+	}
+}
+
+// terminalWidth returns the width of the terminal attached to stdout, falling back to $COLUMNS and then 120.
+func terminalWidth() int {
+	if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && width > 0 {
+		return width
+	}
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+	return 120
+}
+
+func printPodDiffs(pairs []podPair) {
+	readLogs := cachedLogReader()
+	for _, pair := range pairs {
+		fmt.Printf("Diff between %s (%s) and %s (%s):\n", pair.A.Name, pair.A.CreatedAt, pair.B.Name, pair.B.CreatedAt)
 		if onlyName {
 			continue
 		}
+		a, err := readLogs(pair.A)
+		if err != nil {
+			fmt.Println("file not found for pod:", pair.A.Name)
+			continue
+		}
+		b, err := readLogs(pair.B)
+		if err != nil {
+			fmt.Println("file not found for pod:", pair.B.Name)
+			continue
+		}
 		diff := difflib.UnifiedDiff{
-			A:        difflib.SplitLines(logSlice[i]),
-			B:        difflib.SplitLines(logSlice[j]),
-			FromFile: podNames[i],
-			ToFile:   podNames[j],
+			A:        difflib.SplitLines(a),
+			B:        difflib.SplitLines(b),
+			FromFile: pair.A.Name,
+			ToFile:   pair.B.Name,
 			Context:  3,
 		}
 		result, err := difflib.GetUnifiedDiffString(diff)
@@ -119,7 +400,7 @@ func printPodDiffs(podNames []string, logSlice []string, timestamps []string) {
 			return
 		}
 		if result == "" {
-			fmt.Println("No diff found between ", podNames[i], " and ", podNames[j])
+			fmt.Println("No diff found between ", pair.A.Name, " and ", pair.B.Name)
 			continue
 		}
 		fmt.Println(pkg.ColorizeDiff(result), "\n--------------------------------------------------")
@@ -0,0 +1,158 @@
+package logs
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/multiline"
+	"github.com/revolyssup/k8sdebug/pkg/output"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/revolyssup/k8sdebug/pkg/structured"
+	"github.com/spf13/cobra"
+)
+
+// errorGroup is a distinct error of an owner, all occurrences share the same stack signature.
+type errorGroup struct {
+	Owner     store.Owner     `json:"owner"`
+	Signature string          `json:"signature"`
+	Kind      multiline.Kind  `json:"kind"`
+	Header    string          `json:"error"`
+	Count     int             `json:"count"`
+	Pods      []string        `json:"pods"`
+	FirstSeen time.Time       `json:"firstSeen"`
+	LastSeen  time.Time       `json:"lastSeen"`
+	Sample    multiline.Event `json:"sample"`
+}
+
+func (g *errorGroup) seen(pod string, at time.Time) {
+	g.Count++
+	if len(g.Pods) == 0 || g.Pods[len(g.Pods)-1] != pod {
+		g.Pods = append(g.Pods, pod)
+	}
+	if g.FirstSeen.IsZero() || at.Before(g.FirstSeen) {
+		g.FirstSeen = at
+	}
+	if at.After(g.LastSeen) {
+		g.LastSeen = at
+	}
+}
+
+func newErrorsCommand() *cobra.Command {
+	var showStack bool
+	cmd := &cobra.Command{
+		Use:   "errors [name]",
+		Short: "List distinct errors and panics per owner, deduplicated by stack signature",
+		Long: `List distinct errors, panics, exceptions and tracebacks of an owner, or of every owner in the namespace if no name is given.
+Multi-line stack traces are grouped into one event and deduplicated by their signature: the normalized error message and the top frames.
+First and last seen times come from the timestamps in the log lines, or the pod creation time for lines without one.`,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeName,
+		Run: func(cmd *cobra.Command, args []string) {
+			var pods []store.Pod
+			if len(args) == 1 {
+				var ok bool
+				if pods, ok = loadOwnerPods(cmd, args[0]); !ok {
+					return
+				}
+			} else {
+				var err error
+				if pods, err = logStore().AllPods(namespace); err != nil {
+					cmd.Println("No logs found for namespace:", namespace)
+					return
+				}
+			}
+			groups := collectErrors(pods)
+			if output.Structured() {
+				if err := output.Write(os.Stdout, groups); err != nil {
+					cmd.PrintErrln("Error encoding errors:", err)
+				}
+				return
+			}
+			printErrorGroups(groups, showStack)
+		},
+	}
+	cmd.Flags().BoolVar(&showStack, "stack", false, "print the full stack trace of one occurrence of every error")
+	return cmd
+}
+
+// collectErrors scans the pods for multi-line stack traces and error lines and groups them by owner and signature.
+func collectErrors(pods []store.Pod) []*errorGroup {
+	bySignature := make(map[string]*errorGroup)
+	groups := make([]*errorGroup, 0)
+	for _, pod := range pods {
+		file, err := logStore().Open(pod.LogPath)
+		if err != nil {
+			continue
+		}
+		scanner := multiline.NewScanner(file)
+		for scanner.Scan() {
+			e := scanner.Event()
+			if e.Kind == multiline.KindLine && !structured.IsError(e.Lines[0]) {
+				continue
+			}
+			key := pod.Owner().String() + "/" + e.Signature()
+			g, ok := bySignature[key]
+			if !ok {
+				g = &errorGroup{Owner: pod.Owner(), Signature: e.Signature(), Kind: e.Kind, Header: e.Header(), Sample: e}
+				bySignature[key] = g
+				groups = append(groups, g)
+			}
+			at, ok := structured.Timestamp(e.Lines[0])
+			if !ok {
+				at = pod.Created()
+			}
+			g.seen(pod.Name, at)
+		}
+		file.Close()
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Owner != groups[j].Owner {
+			return groups[i].Owner.String() < groups[j].Owner.String()
+		}
+		return groups[i].Count > groups[j].Count
+	})
+	return groups
+}
+
+func printErrorGroups(groups []*errorGroup, showStack bool) {
+	if len(groups) == 0 {
+		fmt.Println(pkg.ColorLine("No errors found.", pkg.ColorGreen))
+		return
+	}
+	for i := 0; i < len(groups); {
+		owner := groups[i].Owner
+		fmt.Print(pkg.ColorLine(fmt.Sprintf("Errors of %s", owner), pkg.ColorYellow))
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
+		fmt.Fprintln(w, "Signature\tKind\tCount\tPods\tFirst Seen\tLast Seen\tError")
+		for ; i < len(groups) && groups[i].Owner == owner; i++ {
+			g := groups[i]
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n", g.Signature, g.Kind, g.Count, strings.Join(g.Pods, ","),
+				formatSeen(g.FirstSeen), formatSeen(g.LastSeen), truncate(g.Header, 100))
+			if showStack {
+				w.Flush()
+				fmt.Println(pkg.ColorLine(g.Sample.Text(), pkg.ColorRed))
+			}
+		}
+		w.Flush()
+		fmt.Println()
+	}
+}
+
+func formatSeen(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(store.TimeFormat)
+}
+
+func truncate(s string, n int) string {
+	if len([]rune(s)) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
@@ -0,0 +1,44 @@
+package logs
+
+import (
+	"io"
+	"strings"
+
+	"github.com/revolyssup/k8sdebug/pkg/multiline"
+)
+
+var multilineEvents bool
+
+// eventSeparator joins the lines of an event read by readEvents. diff sets it to a single line
+// separator so that an event is compared as a whole.
+var eventSeparator = "\n"
+
+// readEvents groups the lines of r into multi-line events such as panics and stack traces and returns
+// the first n events, or the last n if last is set. Only n events are held in memory.
+// lineTransform decides on the first line of every event whether the event is kept.
+func readEvents(r io.Reader, n int, last bool) ([]string, error) {
+	events := make([]string, 0)
+	if n <= 0 {
+		return events, nil
+	}
+	scanner := multiline.NewScanner(r)
+	for scanner.Scan() {
+		e := scanner.Event()
+		lines := append([]string{}, e.Lines...)
+		if lineTransform != nil {
+			first, ok := lineTransform(lines[0])
+			if !ok {
+				continue
+			}
+			lines[0] = first
+		}
+		if len(events) == n {
+			if !last {
+				break
+			}
+			events = append(events[:0], events[1:]...)
+		}
+		events = append(events, strings.Join(lines, eventSeparator))
+	}
+	return events, scanner.Err()
+}
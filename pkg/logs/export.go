@@ -0,0 +1,131 @@
+package logs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg/logexport"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/revolyssup/k8sdebug/pkg/structured"
+	"github.com/revolyssup/k8sdebug/pkg/tail"
+)
+
+// logsExporter writes the payloads of a store export to out and pushes them to pushURL, each may be unset.
+type logsExporter struct {
+	format    string
+	out       io.Writer
+	pushURL   string
+	batchSize int
+	client    *http.Client
+	lines     int
+	pods      int
+}
+
+// export converts the recorded pods selected by the filter, one payload per --batch-size lines of a pod.
+func (e *logsExporter) export(s *store.Store, filter exportFilter) error {
+	namespaces, err := s.Namespaces()
+	if err != nil {
+		return err
+	}
+	for _, ns := range namespaces {
+		if len(filter.Namespaces) > 0 && !slices.Contains(filter.Namespaces, ns) {
+			continue
+		}
+		pods, err := s.AllPods(ns)
+		if err != nil {
+			return err
+		}
+		for _, pod := range pods {
+			info, err := s.Stat(pod.LogPath)
+			if err != nil || !filter.match(pod, info.ModTime()) {
+				continue
+			}
+			if err := e.exportPod(s, pod); err != nil {
+				return fmt.Errorf("exporting pod %s/%s: %w", ns, pod.Name, err)
+			}
+			e.pods++
+		}
+	}
+	return nil
+}
+
+func (e *logsExporter) exportPod(s *store.Store, pod store.Pod) error {
+	file, err := s.Open(pod.LogPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	stream := logexport.Stream{Namespace: pod.Namespace, Pod: pod.Name, OwnerKind: pod.OwnerKind, OwnerName: pod.OwnerName}
+	if status, err := s.Status(pod.Namespace, pod.Name); err == nil && len(status.Containers) == 1 {
+		stream.Container = status.Containers[0].Name
+	}
+	// Lines without a timestamp get the one of the previous line, starting at the pod creation.
+	last := pod.Created()
+	if last.IsZero() {
+		if info, err := file.Stat(); err == nil {
+			last = info.ModTime()
+		}
+	}
+	batch := make([]logexport.Entry, 0, e.batchSize)
+	scanner := tail.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if t, ok := structured.Timestamp(line); ok {
+			last = t
+		}
+		batch = append(batch, logexport.Entry{Time: last, Line: line})
+		if len(batch) == e.batchSize {
+			if err := e.flush(stream, batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	return e.flush(stream, batch)
+}
+
+func (e *logsExporter) flush(stream logexport.Stream, batch []logexport.Entry) error {
+	payload, err := logexport.Encode(e.format, stream, batch)
+	if err != nil {
+		return err
+	}
+	if e.out != nil {
+		if err := json.NewEncoder(e.out).Encode(payload); err != nil {
+			return err
+		}
+	}
+	if e.pushURL != "" {
+		if err := logexport.Push(e.client, e.pushURL, payload); err != nil {
+			return err
+		}
+	}
+	e.lines += len(batch)
+	return nil
+}
+
+func newLogsExporter(format, pushURL string, batchSize int) (*logsExporter, error) {
+	e := &logsExporter{format: format, batchSize: batchSize, client: &http.Client{Timeout: 30 * time.Second}}
+	if format != logexport.FormatOTLP && format != logexport.FormatLoki {
+		return nil, fmt.Errorf("unknown payload format %s, use %s or %s", format, logexport.FormatOTLP, logexport.FormatLoki)
+	}
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("--batch-size must be positive")
+	}
+	if pushURL != "" {
+		var err error
+		if e.pushURL, err = logexport.PushURL(format, pushURL); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
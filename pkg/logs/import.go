@@ -5,75 +5,241 @@ import (
 	"compress/gzip"
 	"fmt"
 	"io"
-	"log"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/completion"
+	"github.com/revolyssup/k8sdebug/pkg/logexport"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/revolyssup/k8sdebug/pkg/workspace"
 	"github.com/spf13/cobra"
 )
 
 func newImportCmd() *cobra.Command {
+	var workspaceName string
+	var verify, overwrite bool
 	var importCmd = &cobra.Command{
 		Use:   "import",
-		Short: "Import logs from a tar archive",
+		Short: "Import logs from a tar archive into a workspace",
+		Long: `Import logs from a tar archive into a named workspace, by default named after the archive.
+Files identical to the ones already in the workspace are skipped. Files that would overwrite different content
+are reported and nothing is imported, unless --overwrite is given.
+With --verify every file is checked against the checksums of the manifest.json of the archive before anything is written.`,
 		Run: func(cmd *cobra.Command, args []string) {
 			source, _ := cmd.Flags().GetString("source")
 			dest, _ := cmd.Flags().GetString("dest")
+			if dest == "" {
+				if workspaceName == "" {
+					workspaceName = strings.TrimSuffix(strings.TrimSuffix(filepath.Base(source), ".gz"), ".tar")
+					workspaceName = strings.TrimSuffix(workspaceName, ".tgz")
+				}
+				var err error
+				if dest, err = workspace.Dir(workspaceName); err != nil {
+					cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+					return
+				}
+			}
+			archive, err := scanArchive(source)
+			if err != nil {
+				cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+				return
+			}
+			if verify {
+				if problems := archive.verify(); len(problems) > 0 {
+					cmd.Println(pkg.ColorLine("Verification failed, nothing was imported:\n  "+strings.Join(problems, "\n  "), pkg.ColorRed))
+					return
+				}
+				cmd.Println(pkg.ColorLine(fmt.Sprintf("Verified %d files against %s", len(archive.sums), manifestName), pkg.ColorGreen))
+			}
+			identical, conflicting := archive.conflicts(dest)
+			if len(conflicting) > 0 && !overwrite {
+				cmd.Println(pkg.ColorLine(fmt.Sprintf("%d files conflict with different content in %s, nothing was imported:\n  %s\nUse another --workspace or --overwrite.",
+					len(conflicting), dest, strings.Join(conflicting, "\n  ")), pkg.ColorRed))
+				return
+			}
 
 			// Create destination directory if it doesn't exist
 			if err := os.MkdirAll(dest, 0755); err != nil {
-				log.Fatal(err)
+				cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+				return
 			}
 
-			// Implement your tar extraction logic here
-			if err := extractTar(source, dest); err != nil {
-				log.Fatal(err)
+			written, err := extractTar(source, dest, identical)
+			if err != nil {
+				msg := fmt.Sprintf("Import into %s failed: %v", dest, err)
+				if len(written) > 0 {
+					msg += fmt.Sprintf("\n%d files were written before the error:\n  %s", len(written), strings.Join(written, "\n  "))
+				} else {
+					msg += "\nNo file was written."
+				}
+				cmd.Println(pkg.ColorLine(msg, pkg.ColorRed))
+				return
 			}
-			fmt.Println("Successfully imported logs to:", dest)
+			if archive.manifest != nil {
+				if err := saveImportManifest(dest, source, archive.manifestData); err != nil {
+					cmd.Println(pkg.ColorLine(fmt.Sprintf("could not keep the manifest: %v", err), pkg.ColorYellow))
+				}
+			}
+			fmt.Printf("Successfully imported %d files to: %s (%d identical files skipped)\n", len(written), dest, len(identical))
 		},
 	}
 	// Import command flags
 	importCmd.Flags().StringP("source", "s", "", "Source tar file to import (required)")
-	importCmd.Flags().StringP("dest", "d", "/tmp/k8sdebug/logs", "Destination directory for extraction")
+	importCmd.Flags().StringP("dest", "d", "", "Destination directory for extraction, instead of a workspace")
+	importCmd.Flags().StringVarP(&workspaceName, "workspace", "w", "", "workspace to import into. Defaults to the name of the archive")
+	importCmd.MarkFlagFilename("source", "gz")
+	importCmd.MarkFlagDirname("dest")
+	importCmd.RegisterFlagCompletionFunc("workspace", workspace.CompleteNames)
+	importCmd.Flags().BoolVar(&verify, "verify", false, "check the files against the checksums of the manifest before importing")
+	importCmd.Flags().BoolVar(&overwrite, "overwrite", false, "overwrite files that already exist with different content")
 	importCmd.MarkFlagRequired("source")
 	return importCmd
 }
 
+// saveImportManifest keeps the manifest of an imported archive in the .imports directory of the store.
+func saveImportManifest(dest, source string, data []byte) error {
+	dir := filepath.Join(dest, importsDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.json", time.Now().UTC().Format("20060102T150405Z"), filepath.Base(source))
+	return os.WriteFile(filepath.Join(dir, name), data, 0644)
+}
+
 func newExportCmd() *cobra.Command {
+	var format, push, since, until string
+	var batchSize int
+	var filter exportFilter
 	var exportCmd = &cobra.Command{
 		Use:   "export",
-		Short: "Export logs to a tar archive",
+		Short: "Export logs to a tar archive, or as OpenTelemetry or Loki payloads",
+		Long: `Export the recorded logs.
+
+tar (default): a tar.gz archive that can be imported again, with a manifest.json describing the cluster, time range,
+               k8sdebug version, pods and the checksum of every file.
+otlp-json:     OTLP/HTTP JSON log export requests, with namespace, pod, owner and container as resource attributes.
+loki:          Loki push API payloads, with namespace, pod, owner and container as stream labels.
+
+With every format, --namespaces, --owners, --pods, --since and --until select the pods to export.
+
+The otlp-json and loki payloads are written one per line to --dest, or stdout if no --dest is given, and are
+sent to a running collector or Loki with --push, e.g. --push http://localhost:4318 or --push http://localhost:3100.
+Every payload holds at most --batch-size lines of a single pod.`,
 		Run: func(cmd *cobra.Command, args []string) {
 			source, _ := cmd.Flags().GetString("source")
 			dest, _ := cmd.Flags().GetString("dest")
+			if source == "" {
+				source = logStore().Root
+			}
+			var err error
+			var exporter *logsExporter
 
-			// Implement your tar creation logic here
-			if err := createTar(source, dest); err != nil {
-				log.Fatal(err)
+			switch format {
+			case "tar", logexport.FormatOTLP, logexport.FormatLoki:
+			default:
+				cmd.Println(pkg.ColorLine(fmt.Sprintf("unknown export format %s, use tar, %s or %s", format, logexport.FormatOTLP, logexport.FormatLoki), pkg.ColorRed))
+				return
 			}
-			fmt.Println("Successfully exported logs to:", dest)
+			filter.Since, err = parseTimeFlag(since)
+			if err == nil {
+				filter.Until, err = parseTimeFlag(until)
+			}
+			if err != nil {
+				cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+				return
+			}
+			if format == "tar" {
+				if dest == "" {
+					cmd.Println(pkg.ColorLine("--dest is required for the tar format", pkg.ColorRed))
+					return
+				}
+				manifest, err := writeArchive(store.New(source), dest, filter)
+				if err != nil {
+					cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+					return
+				}
+				fmt.Printf("Successfully exported %d pods to: %s\n", len(manifest.Pods), dest)
+				return
+			}
+			exporter, err = newLogsExporter(format, push, batchSize)
+			if err != nil {
+				cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+				return
+			}
+			var out *partialFile
+			if dest != "" {
+				if out, err = createPartial(dest); err != nil {
+					cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+					return
+				}
+				defer out.discard()
+				exporter.out = out
+			} else if push == "" {
+				exporter.out = os.Stdout
+			}
+			if err := exporter.export(store.New(source), filter); err != nil {
+				cmd.Println(pkg.ColorLine(fmt.Sprintf("Export failed after %d lines of %d pods: %v", exporter.lines, exporter.pods, err), pkg.ColorRed))
+				return
+			}
+			if out != nil {
+				if err := out.commit(); err != nil {
+					cmd.Println(pkg.ColorLine(fmt.Sprintf("failed to write %s: %v", dest, err), pkg.ColorRed))
+					return
+				}
+			}
+			cmd.Printf("Exported %d lines of %d pods as %s\n", exporter.lines, exporter.pods, format)
 		},
 	}
 	// Export command flags
-	exportCmd.Flags().StringP("source", "s", "/tmp/k8sdebug/logs", "Source directory to export")
-	exportCmd.Flags().StringP("dest", "d", "", "Destination tar file path (required)")
-	exportCmd.MarkFlagRequired("dest")
+	exportCmd.Flags().StringP("source", "s", "", "Source directory to export. Defaults to the store of the active workspace")
+	exportCmd.Flags().StringP("dest", "d", "", "Destination file path, required for the tar format")
+	exportCmd.Flags().StringVar(&format, "format", "tar", "export format: tar, otlp-json or loki")
+	exportCmd.Flags().StringVar(&push, "push", "", "push the otlp-json or loki payloads to this OTLP/HTTP collector or Loki url")
+	exportCmd.Flags().StringSliceVar(&filter.Namespaces, "namespaces", nil, "only export these namespaces")
+	exportCmd.Flags().StringSliceVar(&filter.Owners, "owners", nil, "only export pods of these owners, e.g. deployment/api")
+	exportCmd.Flags().StringSliceVar(&filter.Pods, "pods", nil, "only export these pods")
+	exportCmd.MarkFlagDirname("source")
+	exportCmd.RegisterFlagCompletionFunc("format", completion.Fixed("tar", "otlp-json", "loki"))
+	exportCmd.RegisterFlagCompletionFunc("namespaces", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		namespaces, _ := logStore().Namespaces()
+		return completion.Values(namespaces, toComplete)
+	})
+	exportCmd.RegisterFlagCompletionFunc("owners", completeRecorded(func(s *store.Store, ns string) []string {
+		c := completion.Completer{Store: s}
+		return c.Owners(ns)
+	}))
+	exportCmd.RegisterFlagCompletionFunc("pods", completeRecorded(func(s *store.Store, ns string) []string {
+		pods, _ := s.AllPods(ns)
+		names := make([]string, 0, len(pods))
+		for _, p := range pods {
+			names = append(names, p.Name)
+		}
+		return names
+	}))
+	exportCmd.Flags().StringVar(&since, "since", "", `only export pods that logged after this time, e.g. 2h or "2025-01-02 15:04:05"`)
+	exportCmd.Flags().StringVar(&until, "until", "", "only export pods created before this time")
+	exportCmd.Flags().IntVar(&batchSize, "batch-size", 1000, "maximum number of lines per otlp-json or loki payload")
 	return exportCmd
 }
 
-func extractTar(source string, dest string) error {
+// extractTar extracts the archive into dest, except manifest.json and the files in skip. It returns the paths of
+// the files written or merged, also when it fails partway.
+func extractTar(source string, dest string, skip map[string]bool) (written []string, err error) {
 	// Open source file
 	file, err := os.Open(source)
 	if err != nil {
-		return fmt.Errorf("failed to open source file: %w", err)
+		return written, fmt.Errorf("failed to open source file: %w", err)
 	}
 	defer file.Close()
 
 	// Create gzip reader
 	gzr, err := gzip.NewReader(file)
 	if err != nil {
-		return fmt.Errorf("failed to create gzip reader: %w", err)
+		return written, fmt.Errorf("failed to create gzip reader: %w", err)
 	}
 	defer gzr.Close()
 
@@ -87,120 +253,65 @@ func extractTar(source string, dest string) error {
 			break // End of archive
 		}
 		if err != nil {
-			return fmt.Errorf("tar read error: %w", err)
+			return written, fmt.Errorf("tar read error: %w", err)
+		}
+
+		if name := path.Clean(header.Name); name == manifestName || skip[name] {
+			continue
 		}
 
 		// Sanitize file path to prevent path traversal
 		targetPath := filepath.Join(dest, header.Name)
 		if !strings.HasPrefix(targetPath, filepath.Clean(dest)+string(os.PathSeparator)) {
-			return fmt.Errorf("illegal file path: %s", header.Name)
+			return written, fmt.Errorf("illegal file path: %s", header.Name)
 		}
 
 		switch header.Typeflag {
 		case tar.TypeDir:
 			// Create directory with original permissions
 			if err := os.MkdirAll(targetPath, os.FileMode(header.Mode)); err != nil {
-				return fmt.Errorf("failed to create directory: %w", err)
+				return written, fmt.Errorf("failed to create directory: %w", err)
 			}
 
 		case tar.TypeReg:
+			// Owner metadata of several imports is merged instead of replaced.
+			if strings.HasSuffix(header.Name, ".metadata") {
+				if _, err := os.Stat(targetPath); err == nil {
+					if err := mergeMetadata(targetPath, tr); err != nil {
+						return written, fmt.Errorf("failed to merge metadata: %w", err)
+					}
+					written = append(written, path.Clean(header.Name))
+					continue
+				}
+			}
+
 			// Create parent directories if needed
 			if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
-				return fmt.Errorf("failed to create parent directories: %w", err)
+				return written, fmt.Errorf("failed to create parent directories: %w", err)
 			}
 
 			// Create file with original permissions
 			f, err := os.OpenFile(targetPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(header.Mode))
 			if err != nil {
-				return fmt.Errorf("failed to create file: %w", err)
+				return written, fmt.Errorf("failed to create file: %w", err)
 			}
 
+			written = append(written, path.Clean(header.Name))
 			// Copy file contents
 			if _, err := io.Copy(f, tr); err != nil {
 				f.Close()
-				return fmt.Errorf("failed to copy file contents: %w", err)
+				return written, fmt.Errorf("failed to copy file contents: %w", err)
 			}
 			f.Close()
 
 			// Preserve modification time
 			if err := os.Chtimes(targetPath, header.AccessTime, header.ModTime); err != nil {
-				return fmt.Errorf("failed to set file times: %w", err)
+				return written, fmt.Errorf("failed to set file times: %w", err)
 			}
 
 		default:
-			return fmt.Errorf("unsupported file type: %v", header.Typeflag)
+			return written, fmt.Errorf("unsupported file type: %v", header.Typeflag)
 		}
 	}
-	return nil
-}
-
-func createTar(source string, dest string) error {
-	// Create destination file
-	file, err := os.Create(dest)
-	if err != nil {
-		return fmt.Errorf("failed to create destination file: %w", err)
-	}
-	defer file.Close()
-
-	// Create gzip writer
-	gzw := gzip.NewWriter(file)
-	defer gzw.Close()
-
-	// Create tar writer
-	tw := tar.NewWriter(gzw)
-	defer tw.Close()
-
-	// Walk the source directory
-	baseDir := filepath.Clean(source)
-	err = filepath.Walk(baseDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// Get relative path
-		relPath, err := filepath.Rel(baseDir, path)
-		if err != nil {
-			return err
-		}
-		if relPath == "." {
-			return nil // Skip root directory
-		}
-
-		// Create tar header
-		header, err := tar.FileInfoHeader(info, "")
-		if err != nil {
-			return fmt.Errorf("failed to create header: %w", err)
-		}
-		header.Name = relPath
-
-		// Write header
-		if err := tw.WriteHeader(header); err != nil {
-			return fmt.Errorf("failed to write header: %w", err)
-		}
-
-		// Skip directories (header only)
-		if info.IsDir() {
-			return nil
-		}
-
-		// Open file for reading
-		f, err := os.Open(path)
-		if err != nil {
-			return fmt.Errorf("failed to open file: %w", err)
-		}
-		defer f.Close()
-
-		// Copy file contents
-		if _, err := io.Copy(tw, f); err != nil {
-			return fmt.Errorf("failed to copy file contents: %w", err)
-		}
-
-		return nil
-	})
-
-	if err != nil {
-		return fmt.Errorf("directory walk failed: %w", err)
-	}
-
-	return nil
+	return written, nil
 }
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 
 	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/config"
 	"github.com/spf13/cobra"
 )
 
@@ -12,12 +13,13 @@ var maxPods int
 var latestFirst bool
 var maxLinesToRead int
 var bottomFile bool
-var tail int
+var tailLines int
 
 func NewCommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "logs",
-		Short: "Get logs of a pod",
+		Use:       "logs",
+		Short:     "Get logs of a pod",
+		ValidArgs: []string{"setpath", "getpath"},
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) >= 1 && args[0] == "setpath" {
 				if len(args) == 1 || args[1] == "" {
@@ -28,6 +30,11 @@ func NewCommand() *cobra.Command {
 				fp, err := filepath.Abs(path)
 				if err != nil {
 					cmd.Println(pkg.ColorLine("Please provide a valid path!", pkg.ColorRed))
+					return
+				}
+				if err := config.Set(pkg.ConfigFilePath, "", "logsPath", fp, nil); err != nil {
+					cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+					return
 				}
 				pkg.ConfigData.LogsPath = fp
 				return
@@ -43,12 +50,29 @@ func NewCommand() *cobra.Command {
 	cmd.PersistentFlags().BoolVar(&latestFirst, "latest", false, "reverse the order of the log files")
 	cmd.PersistentFlags().BoolVarP(&bottomFile, "end-of-file", "e", false, "reverse the order of the logs")
 	cmd.PersistentFlags().IntVar(&maxLinesToRead, "max-lines", 10, "maximum number of lines to read from the log file")
-	cmd.PersistentFlags().IntVar(&tail, "tail", 10, "No. of lines to use for diff")
+	cmd.PersistentFlags().IntVar(&tailLines, "tail", 10, "No. of lines to use for diff")
+	cmd.PersistentFlags().StringArrayVar(&whereExprs, "where", nil, `filter JSON and logfmt lines on a field, can be repeated. e.g. --where level=error --where user_id=42
+Supported operators: = != =~ !~ (regex) > >= < <= (numeric)`)
+	cmd.PersistentFlags().StringSliceVar(&fieldNames, "fields", nil, "only keep these fields of JSON and logfmt lines, e.g. --fields ts,msg,err")
+	cmd.PersistentFlags().StringSliceVar(&fieldOrder, "field-order", nil, "fields printed first when pretty printing JSON and logfmt lines")
+	cmd.PersistentFlags().BoolVar(&multilineEvents, "multiline", false, "group Go panics, Java exceptions and Python tracebacks spanning several lines into single events")
+	cmd.PersistentFlags().BoolVar(&rawLines, "raw", false, "print JSON and logfmt lines as they were logged instead of pretty printing them")
+	registerCompletions(cmd)
 	cmd.AddCommand(newRecordCommand())
 	cmd.AddCommand(newShowCommand())
 	cmd.AddCommand(newCleanupCommand())
 	cmd.AddCommand(newDiffCommand())
 	cmd.AddCommand(newExportCmd())
 	cmd.AddCommand(newImportCmd())
+	cmd.AddCommand(newSearchCommand())
+	cmd.AddCommand(newQueryCommand())
+	cmd.AddCommand(newErrorsCommand())
+	cmd.AddCommand(newStatsCommand())
+	cmd.AddCommand(newLsCommand())
+	cmd.AddCommand(newTraceCommand())
+	cmd.AddCommand(newNewCommand())
+	cmd.AddCommand(newAlertsCommand())
+	cmd.AddCommand(newCrashesCommand())
+	cmd.AddCommand(newReplayCommand())
 	return cmd
 }
@@ -0,0 +1,172 @@
+package logs
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/output"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+type lsPod struct {
+	Name      string `json:"name"`
+	CreatedAt string `json:"createdAt,omitempty"`
+	Bytes     int64  `json:"bytes"`
+	// Exists is nil when the recorder never wrote a status for the pod.
+	Exists *bool  `json:"exists"`
+	Phase  string `json:"phase,omitempty"`
+}
+
+type lsRevision struct {
+	Revision int     `json:"revision"`
+	Pods     []lsPod `json:"pods"`
+}
+
+type lsOwner struct {
+	Kind      string       `json:"kind"`
+	Name      string       `json:"name"`
+	Revisions []lsRevision `json:"revisions,omitempty"`
+	// Pods holds the pods of owners recorded without revisions.
+	Pods []lsPod `json:"pods,omitempty"`
+}
+
+type lsNamespace struct {
+	Namespace string    `json:"namespace"`
+	Owners    []lsOwner `json:"owners"`
+	// Pods are recorded pods that have no owner metadata.
+	Pods []lsPod `json:"pods,omitempty"`
+}
+
+func newLsCommand() *cobra.Command {
+	var allNamespaces bool
+	cmd := &cobra.Command{
+		Use:   "ls",
+		Short: "List the namespaces, owners, revisions and pods in the log store",
+		Long: `List everything recorded in the log store as a tree of namespaces, owners, revisions and pods.
+Every pod shows its creation time, the size of its log, whether it still exists and its last known phase.
+Existence and phase come from the status kept by the recorder and are shown as "-" for pods recorded without one.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			s := logStore()
+			namespaces := []string{namespace}
+			if allNamespaces {
+				var err error
+				if namespaces, err = s.Namespaces(); err != nil {
+					cmd.Println(pkg.ColorLine(fmt.Sprintf("could not read the log store: %v", err), pkg.ColorRed))
+					return
+				}
+			}
+			listing := make([]lsNamespace, 0, len(namespaces))
+			for _, ns := range namespaces {
+				l, err := listNamespace(s, ns)
+				if err != nil {
+					cmd.Println("No logs found for namespace:", ns)
+					continue
+				}
+				listing = append(listing, l)
+			}
+			if output.Structured() {
+				if err := output.Write(os.Stdout, listing); err != nil {
+					cmd.Println("Error encoding listing:", err)
+				}
+				return
+			}
+			printListing(listing)
+		},
+	}
+	cmd.Flags().BoolVarP(&allNamespaces, "all-namespaces", "A", false, "list every recorded namespace")
+	addArchiveFlag(cmd)
+	return cmd
+}
+
+func listNamespace(s *store.Store, ns string) (lsNamespace, error) {
+	l := lsNamespace{Namespace: ns, Owners: make([]lsOwner, 0)}
+	owners, err := s.Owners(ns)
+	if err != nil {
+		return l, err
+	}
+	owned := make(map[string]bool)
+	for _, o := range owners {
+		pods, err := s.Pods(ns, o.Kind, o.Name)
+		if err != nil {
+			continue
+		}
+		owner := lsOwner{Kind: o.Kind, Name: o.Name}
+		for _, rev := range store.Revisions(pods) {
+			owner.Revisions = append(owner.Revisions, lsRevision{Revision: rev})
+		}
+		for _, pod := range pods {
+			owned[pod.Name] = true
+			p := listPod(s, pod)
+			if pod.Revision == 0 || len(owner.Revisions) == 0 {
+				owner.Pods = append(owner.Pods, p)
+				continue
+			}
+			for i := range owner.Revisions {
+				if owner.Revisions[i].Revision == pod.Revision {
+					owner.Revisions[i].Pods = append(owner.Revisions[i].Pods, p)
+				}
+			}
+		}
+		l.Owners = append(l.Owners, owner)
+	}
+	pods, err := s.AllPods(ns)
+	if err != nil {
+		return l, err
+	}
+	for _, pod := range pods {
+		if !owned[pod.Name] {
+			l.Pods = append(l.Pods, listPod(s, pod))
+		}
+	}
+	return l, nil
+}
+
+func listPod(s *store.Store, pod store.Pod) lsPod {
+	p := lsPod{Name: pod.Name, CreatedAt: pod.CreatedAt}
+	if info, err := s.Stat(pod.LogPath); err == nil {
+		p.Bytes = info.Size()
+	}
+	if status, err := s.Status(pod.Namespace, pod.Name); err == nil {
+		exists := !status.Deleted
+		p.Exists = &exists
+		p.Phase = status.Phase
+	}
+	return p
+}
+
+func printListing(listing []lsNamespace) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tCREATED\tSIZE\tEXISTS\tPHASE")
+	for _, ns := range listing {
+		fmt.Fprintf(w, "%s\t\t\t\t\n", ns.Namespace)
+		for _, o := range ns.Owners {
+			fmt.Fprintf(w, "  %s/%s\t\t\t\t\n", o.Kind, o.Name)
+			for _, rev := range o.Revisions {
+				fmt.Fprintf(w, "    revision %d\t\t\t\t\n", rev.Revision)
+				printListedPods(w, rev.Pods, 6)
+			}
+			printListedPods(w, o.Pods, 4)
+		}
+		printListedPods(w, ns.Pods, 2)
+	}
+	w.Flush()
+}
+
+func printListedPods(w *tabwriter.Writer, pods []lsPod, indent int) {
+	for _, p := range pods {
+		exists := "-"
+		if p.Exists != nil {
+			exists = "no"
+			if *p.Exists {
+				exists = "yes"
+			}
+		}
+		fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\t%s\n", strings.Repeat(" ", indent), p.Name, orDash(p.CreatedAt),
+			humanBytes(p.Bytes), exists, orDash(p.Phase))
+	}
+}
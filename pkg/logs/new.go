@@ -0,0 +1,73 @@
+package logs
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/completion"
+	"github.com/revolyssup/k8sdebug/pkg/output"
+	"github.com/revolyssup/k8sdebug/pkg/patterns"
+	"github.com/spf13/cobra"
+)
+
+func newNewCommand() *cobra.Command {
+	var revision string
+	var severities []string
+	cmd := &cobra.Command{
+		Use:   "new <name>",
+		Short: "List line patterns the newest revision logs that no previous revision ever logged",
+		Long: `Compare the pods of the newest ReplicaSet revision of a deployment (or --revision) against the pods of all
+previous revisions and list the line patterns that never appeared before, errors and warnings first, with their
+count, pods and first occurrence.
+
+Lines are compared after normalizing volatile tokens such as timestamps, ids, addresses and numbers. JSON and logfmt
+lines are compared on their level, message and error fields. Multi-line stack traces count as a single line.`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeName,
+		Run: func(cmd *cobra.Command, args []string) {
+			pods, ok := loadOwnerPods(cmd, args[0])
+			if !ok {
+				return
+			}
+			result, err := patterns.New(logStore(), pods, revision)
+			if err != nil {
+				cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+				return
+			}
+			if len(severities) > 0 {
+				result.Patterns = slices.DeleteFunc(result.Patterns, func(p *patterns.Pattern) bool {
+					return !slices.Contains(severities, p.Severity)
+				})
+			}
+			if output.Structured() {
+				if err := output.Write(os.Stdout, result); err != nil {
+					cmd.PrintErrln("Error encoding patterns:", err)
+				}
+				return
+			}
+			printNewPatterns(result)
+		},
+	}
+	cmd.Flags().StringVar(&revision, "revision", "latest", "revision compared against all the revisions before it")
+	cmd.Flags().StringSliceVar(&severities, "severity", nil, "only list patterns of these severities: error, warn or info")
+	cmd.RegisterFlagCompletionFunc("severity", completion.Fixed("error", "warn", "info"))
+	return cmd
+}
+
+func printNewPatterns(result *patterns.Result) {
+	fmt.Printf("Revision %d of %s (%d pods) against revisions %v (%d pods)\n",
+		result.Revision, result.Owner, len(result.Pods), result.Baseline, len(result.BaselinePods))
+	if len(result.Patterns) == 0 {
+		fmt.Println(pkg.ColorLine("Nothing new is logged.", pkg.ColorGreen))
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
+	fmt.Fprintln(w, "Severity\tCount\tPods\tFirst Seen\tFirst Pod\tPattern")
+	for _, p := range result.Patterns {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\n", p.Severity, p.Count, len(p.Pods), formatSeen(p.FirstSeen), p.FirstPod, truncate(p.Pattern, 120))
+	}
+	w.Flush()
+}
@@ -0,0 +1,88 @@
+package logs
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/output"
+	"github.com/revolyssup/k8sdebug/pkg/query"
+	"github.com/spf13/cobra"
+)
+
+func newQueryCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "query <query>",
+		Short: "Run a pipeline query over the recorded logs",
+		Long: `Run a pipeline query over the recorded logs, e.g.
+
+  k8sdebug logs query '{ns="shop", owner="deployment/api"} |= "timeout" | json | latency_ms > 500 | count by pod'
+
+Selector labels: ns, owner (kind/name), kind, name, pod, revision with = != =~ !~.
+Without an ns matcher every recorded namespace is queried.
+Line filters:    |= "text"  != "text"  |~ "regex"  !~ "regex"
+Parsers:         | json  | logfmt
+Field filters:   | field = value, with = != =~ !~ > >= < <=
+Projection:      | fields ts, msg
+Limit:           | limit 100, the first lines of all the selected pods, read by namespace and then by pod creation
+Aggregations:    | count [by labels]  | sum|avg|min|max field [by labels]
+Aggregations group by selector labels or parsed fields and must be the last stage.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			q, err := query.Parse(args[0])
+			if err != nil {
+				cmd.Println(pkg.ColorLine(fmt.Sprintf("invalid query: %v", err), pkg.ColorRed))
+				return
+			}
+			res, err := query.Exec(logStore(), q)
+			if err != nil {
+				cmd.Println(pkg.ColorLine(fmt.Sprintf("query failed: %v", err), pkg.ColorRed))
+				return
+			}
+			if output.Structured() {
+				var items any = res.Lines
+				if res.Aggregate {
+					items = res.Samples
+				}
+				if err := output.Write(os.Stdout, items); err != nil {
+					cmd.PrintErrln("Error encoding result:", err)
+				}
+			} else if res.Aggregate {
+				printSamples(q, res.Samples)
+			} else {
+				for _, l := range res.Lines {
+					fmt.Printf("%s: %s\n", pkg.Colorize(l.Namespace+"/"+l.Pod, pkg.ColorYellow), l.Line)
+				}
+				cmd.Println("Total lines: ", len(res.Lines))
+			}
+			// The result is computed without the lines that could not be read.
+			for _, e := range res.Errors {
+				cmd.PrintErrln(pkg.Colorize("Error reading pod "+e, pkg.ColorRed))
+			}
+			cmd.Println("Total pods scanned: ", res.Scanned)
+		},
+	}
+	return cmd
+}
+
+func printSamples(q *query.Query, samples []query.Sample) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
+	header := append([]string{}, q.Aggregation.By...)
+	title := q.Aggregation.Func
+	if q.Aggregation.Field != "" {
+		title += "(" + q.Aggregation.Field + ")"
+	}
+	fmt.Fprintln(w, strings.Join(append(header, title), "\t"))
+	for _, s := range samples {
+		row := make([]string, 0, len(q.Aggregation.By)+1)
+		for _, by := range q.Aggregation.By {
+			row = append(row, s.Labels[by])
+		}
+		row = append(row, strconv.FormatFloat(s.Value, 'f', -1, 64))
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+}
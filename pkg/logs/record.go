@@ -9,6 +9,9 @@ import (
 	"time"
 
 	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/alert"
+	"github.com/revolyssup/k8sdebug/pkg/hook"
+	"github.com/revolyssup/k8sdebug/pkg/output"
 	"github.com/spf13/cobra"
 	"k8s.io/klog/v2"
 )
@@ -17,12 +20,41 @@ var (
 	namespace string
 )
 var labels string
+var alertRules string
+var hooksConfig string
+var crashLines int
+
+// recorderStatus is the schema of logs record status with a machine-readable --output.
+type recorderStatus struct {
+	Running  bool   `json:"running"`
+	PID      int    `json:"pid,omitempty"`
+	LogsPath string `json:"logsPath"`
+}
 
 func newRecordCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "record",
 		Short: "Record logs of a pod",
-		Args:  cobra.ExactArgs(1),
+		Long: `Record the logs of the pods of the namespace in the background.
+
+While recording, the hooks of ~/.k8sdebug/hooks.yaml (or --hooks <file>) run a command with sh -c on pod events:
+
+  hooks:
+  - name: describe
+    event: pod-added           # pod-added, restart, exit (non-zero exit code) or log-match
+    command: kubectl describe pod -n $K8SDEBUG_NAMESPACE $K8SDEBUG_POD
+  - name: heap-dump
+    event: log-match
+    match: OutOfMemoryError    # matched against the line, or the termination reason for restart and exit
+    owner: deployment/api      # only pods of this owner, namespace: restricts to a namespace
+    command: ./dump.sh
+    timeout: 2m                # default 1m
+    cooldown: 10m              # do not run again for the same pod within 10m, default 30s
+
+The pod context is passed in K8SDEBUG_EVENT, K8SDEBUG_NAMESPACE, K8SDEBUG_POD, K8SDEBUG_OWNER, K8SDEBUG_CONTAINER,
+K8SDEBUG_RESTARTS, K8SDEBUG_EXIT_CODE, K8SDEBUG_REASON, K8SDEBUG_LINE, K8SDEBUG_LOG and K8SDEBUG_LOGS_PATH.
+The output of every run, with its exit status, is kept in <pod>.hooks/ next to the log of the pod.`,
+		Args: cobra.ExactArgs(1),
 		PreRun: func(cmd *cobra.Command, args []string) {
 			cmd.Println(pkg.ColorLine("NOTE: Currently only 1 recorder is supported at a time.", pkg.ColorYellow))
 		},
@@ -59,6 +91,13 @@ func newRecordCommand() *cobra.Command {
 	cmd.AddCommand(&cobra.Command{
 		Use: "status",
 		Run: func(cmd *cobra.Command, args []string) {
+			if output.Structured() {
+				status := recorderStatus{Running: pkg.ConfigData.LoggerPID != 0, PID: pkg.ConfigData.LoggerPID, LogsPath: pkg.ConfigData.LogsPath}
+				if err := output.Write(os.Stdout, status); err != nil {
+					cmd.PrintErrln("Error encoding status:", err)
+				}
+				return
+			}
 			if pkg.ConfigData.LoggerPID != 0 {
 				fmt.Println("Logger is running with PID:", pkg.ConfigData.LoggerPID)
 			} else {
@@ -69,6 +108,9 @@ func newRecordCommand() *cobra.Command {
 		Short: "Status of the logger",
 	})
 	cmd.PersistentFlags().StringVarP(&labels, "labels", "l", "", "list of key value pairs to use as labels while filtering pods.")
+	cmd.PersistentFlags().StringVar(&alertRules, "alerts", filepath.Join(filepath.Dir(pkg.ConfigFilePath), "alerts.yaml"), "alert rules evaluated while recording, used if the file exists. See logs alerts --help")
+	cmd.PersistentFlags().StringVar(&hooksConfig, "hooks", filepath.Join(filepath.Dir(pkg.ConfigFilePath), "hooks.yaml"), "hooks run on pod events while recording, used if the file exists. See logs record --help")
+	cmd.PersistentFlags().IntVar(&crashLines, "crash-lines", 200, "lines kept from every log in crash bundles, 0 disables crash bundles. See logs crashes --help")
 	return cmd
 }
 
@@ -108,19 +150,40 @@ func startLogger() {
 	cmd := exec.Command(binpath)
 	cmd.Env = os.Environ()
 	cmd.Env = append(cmd.Env, fmt.Sprintf("NAMESPACE=%s", namespace))
-	cmd.Env = append(cmd.Env, fmt.Sprintf("LOGS_PATH=%s", pkg.ConfigData.LogsPath))
+	cmd.Env = append(cmd.Env, fmt.Sprintf("K8SDEBUG_LOGS_PATH=%s", pkg.ConfigData.LogsPath))
 	cmd.Env = append(cmd.Env, fmt.Sprintf("TYPE=%s", typ))
 	if labels != "" {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("LABELS=%s", labels))
 	}
+	cmd.Env = append(cmd.Env, fmt.Sprintf("CRASH_LINES=%d", crashLines))
+	if _, err := os.Stat(alertRules); err == nil {
+		config, err := alert.Load(alertRules)
+		if err != nil {
+			fmt.Println(pkg.ColorLine(fmt.Sprintf("Invalid alert rules: %v", err), pkg.ColorRed))
+			return
+		}
+		fmt.Printf("Evaluating %d alert rules from %s\n", len(config.Rules), alertRules)
+		cmd.Env = append(cmd.Env, fmt.Sprintf("ALERT_RULES=%s", alertRules))
+	}
+	if _, err := os.Stat(hooksConfig); err == nil {
+		config, err := hook.Load(hooksConfig)
+		if err != nil {
+			fmt.Println(pkg.ColorLine(fmt.Sprintf("Invalid hooks: %v", err), pkg.ColorRed))
+			return
+		}
+		fmt.Printf("Running %d hooks from %s\n", len(config.Hooks), hooksConfig)
+		cmd.Env = append(cmd.Env, fmt.Sprintf("HOOKS_CONFIG=%s", hooksConfig))
+	}
 	if err := cmd.Start(); err != nil {
 		fmt.Println("Error starting logger:", err)
 		return
 	}
 	cmd.Stderr = os.Stderr
 	cmd.Stdout = os.Stdout
-	// Store PID
-	pkg.ConfigData.LoggerPID = cmd.Process.Pid
+	if err := pkg.SetLoggerPID(cmd.Process.Pid); err != nil {
+		fmt.Println(pkg.ColorLine(fmt.Sprintf("Logger started with PID %d but it could not be saved: %v", cmd.Process.Pid, err), pkg.ColorRed))
+		return
+	}
 	fmt.Println("Logger started with PID:", pkg.ConfigData.LoggerPID)
 }
 
@@ -139,7 +202,9 @@ func stopLogger() {
 		return
 	}
 	fmt.Println("STOPPED")
-	pkg.ConfigData.LoggerPID = 0
+	if err := pkg.SetLoggerPID(0); err != nil {
+		fmt.Println(pkg.ColorLine(fmt.Sprintf("Could not save the logger state: %v", err), pkg.ColorRed))
+	}
 }
 func init() {
 	home, err := os.UserHomeDir()
@@ -8,12 +8,16 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/alert"
+	"github.com/revolyssup/k8sdebug/pkg/crash"
+	"github.com/revolyssup/k8sdebug/pkg/hook"
+	"github.com/revolyssup/k8sdebug/pkg/store"
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
@@ -37,6 +41,93 @@ type checkpoint struct {
 
 var checkpointData checkpoint
 
+// alerts evaluates the rules of the ALERT_RULES file, it is nil without rules.
+var alerts *alert.Engine
+
+// podOwners maps the recorded pods to their root owner as kind/name, for the alert rules scoped to an owner.
+var podOwners sync.Map
+
+// workers tracks the goroutines processing pods and streaming their logs. They all stop when the
+// context of the recorder is cancelled and are waited for before the alerts and hooks are flushed.
+var workers sync.WaitGroup
+
+func initAlerts() {
+	path := os.Getenv("ALERT_RULES")
+	if path == "" {
+		return
+	}
+	config, err := alert.Load(path)
+	if err != nil {
+		fmt.Println("Alerts disabled:", err)
+		return
+	}
+	alerts = alert.NewEngine(config, alert.Notifiers(filepath.Join(pkg.ConfigData.LogsPath, alert.LogName)), func(err error) {
+		fmt.Println("Error sending alert:", err)
+	})
+	fmt.Printf("Evaluating %d alert rules from %s\n", len(config.Rules), path)
+}
+
+// hooks runs the commands of the HOOKS_CONFIG file, it is nil without hooks.
+var hooks *hook.Runner
+
+func initHooks() {
+	path := os.Getenv("HOOKS_CONFIG")
+	if path == "" {
+		return
+	}
+	config, err := hook.Load(path)
+	if err != nil {
+		fmt.Println("Hooks disabled:", err)
+		return
+	}
+	hooks = hook.NewRunner(config, pkg.ConfigData.LogsPath, func(err error) {
+		fmt.Println("Error running hook:", err)
+	})
+	fmt.Printf("Running %d hooks from %s\n", len(config.Hooks), path)
+}
+
+// crashes assembles a crash bundle for every abnormal termination found by crashTracker, it is nil when disabled.
+var crashes *crash.Collector
+var crashTracker = crash.NewTracker()
+
+func initCrashes(cs kubernetes.Interface) {
+	lines, err := strconv.Atoi(os.Getenv("CRASH_LINES"))
+	if err != nil {
+		lines = 200
+	}
+	if lines <= 0 {
+		return
+	}
+	crashes = &crash.Collector{Client: cs, Store: store.New(pkg.ConfigData.LogsPath), Lines: lines}
+}
+
+// collectCrash assembles the bundle of a termination in the background.
+func collectCrash(pod *v1.Pod, t crash.Termination) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		bundle, err := crashes.Collect(ctx, pod, alertPod(pod).Owner, t)
+		if err != nil {
+			fmt.Println("Error collecting crash bundle of pod", pod.Name, err.Error())
+			return
+		}
+		fmt.Println("Crash bundle of pod", pod.Name, "written to", bundle.Path)
+	}()
+}
+
+func hookPod(pod *v1.Pod) hook.Pod {
+	ref := alertPod(pod)
+	return hook.Pod{Namespace: ref.Namespace, Name: ref.Name, Owner: ref.Owner}
+}
+
+func alertPod(pod *v1.Pod) alert.Pod {
+	ref := alert.Pod{Namespace: namespace, Name: pod.Name}
+	if owner, ok := podOwners.Load(pod.Name); ok {
+		ref.Owner = owner.(string)
+	}
+	return ref
+}
+
 func initialiseDebugFile() {
 	if _, err := os.Stat(filepath.Join(pkg.ConfigData.LogsPath, ".k8s.debug")); os.IsNotExist(err) {
 		debugFile, err = os.Create(filepath.Join(pkg.ConfigData.LogsPath, ".k8s.debug"))
@@ -113,12 +204,15 @@ func main() {
 	initialiseDebugFile()
 	readCheckpoint()
 	defer writeCheckpoint()
+	initAlerts()
+	initHooks()
 	kubeconfig := clientcmd.NewDefaultClientConfigLoadingRules().GetDefaultFilename()
 	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
 	if err != nil {
 		fmt.Println(err.Error())
 	}
 	cs := kubernetes.NewForConfigOrDie(config)
+	initCrashes(cs)
 	ctx, cancel := context.WithCancel(context.Background())
 
 	/*
@@ -141,7 +235,7 @@ func main() {
 	}
 	pods := mergeSort(initialList.Items)
 	for _, pod := range pods {
-		processPod(ctx, cs, &pod, namespace)
+		processPod(ctx, cs, &pod, namespace, false)
 	}
 	opts.ResourceVersion = initialList.ResourceVersion
 	watcher, err := cs.CoreV1().Pods(namespace).Watch(context.TODO(), opts)
@@ -150,39 +244,55 @@ func main() {
 		return
 	}
 	fmt.Println("Watching for new pods in namespace" + namespace)
+	watching := make(chan struct{})
 	go func() {
+		defer close(watching)
 		for event := range watcher.ResultChan() {
 			switch event.Type {
 			case watch.Added:
 				pod := event.Object.(*v1.Pod)
-				go processPod(ctx, cs, pod, namespace)
+				workers.Add(1)
+				go func() {
+					defer workers.Done()
+					processPod(ctx, cs, pod, namespace, true)
+				}()
+			case watch.Modified:
+				recordStatus(event.Object.(*v1.Pod), false)
+			case watch.Deleted:
+				recordStatus(event.Object.(*v1.Pod), true)
 			}
 		}
 	}()
 
-	var wg sync.WaitGroup
 	sigchan := make(chan os.Signal, 1)
 	signal.Notify(sigchan, os.Interrupt)
-	wg.Add(1)
-	go func() {
-		select {
-		case <-sigchan: // Wait for interrupt triggered via `k8sdebug logs runner stop`
-			cancel()
-			wg.Done()
-		}
-	}()
-	wg.Wait()
+	<-sigchan // Wait for interrupt triggered via `k8sdebug logs runner stop`
+	// No pod is processed once the watch has stopped, the pods being processed and the log streams
+	// stop with the context. Only then can nothing be sent to the alerts and hooks anymore.
+	cancel()
+	watcher.Stop()
+	<-watching
+	workers.Wait()
+	if hooks != nil {
+		hooks.Wait()
+	}
+	if alerts != nil {
+		alerts.Wait()
+	}
 	fmt.Println("Stopping logger...")
 }
 
 // Process pod first synchronously append metadata to the metadata log because order is important.
 // And then starts a go routine that watches for pod logs and writes to log files.
-func processPod(ctx context.Context, cs *kubernetes.Clientset, pod *v1.Pod, namespace string) {
+// added is true for pods created while recording, which run the pod-added hooks.
+func processPod(ctx context.Context, cs *kubernetes.Clientset, pod *v1.Pod, namespace string, added bool) {
 	creationTime := pod.CreationTimestamp.Time
 	podName := pod.Name
 	// Wait for pod to be ready or reach a terminal state
 	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
+	// latest is the newest state of the pod known here, fetched at fetchedAt.
+	latest, fetchedAt := pod, time.Now()
 podWaitLoop:
 	for {
 		select {
@@ -190,6 +300,7 @@ podWaitLoop:
 			fmt.Printf("Timeout waiting for pod %s to be ready\n", podName)
 			break podWaitLoop
 		default:
+			requestedAt := time.Now()
 			currentPod, err := cs.CoreV1().Pods(namespace).Get(waitCtx, podName, metav1.GetOptions{})
 			if err != nil {
 				if kerrors.IsNotFound(err) {
@@ -200,6 +311,7 @@ podWaitLoop:
 				time.Sleep(2 * time.Second)
 				continue
 			}
+			latest, fetchedAt = currentPod, requestedAt
 
 			switch currentPod.Status.Phase {
 			case v1.PodRunning:
@@ -222,6 +334,9 @@ podWaitLoop:
 		}
 	}
 
+	if ctx.Err() != nil {
+		return
+	}
 	fmt.Println("New pod added:", pod.Name, "at", creationTime.Format("2006-01-02 15:04:05"))
 	// podNs := pod.Namespace
 	// TODO: Fix this 5 second wait
@@ -233,29 +348,40 @@ podWaitLoop:
 		fmt.Println(err.Error())
 		return
 	}
-	owner := getLastNode(&PodNode{
+	chain := getOwnerChain(&PodNode{
 		pod: pod,
 		cs:  cs,
 	})
+	owner := chain[len(chain)-1]
 	path := filepath.Join(pkg.ConfigData.LogsPath, namespace, fmt.Sprintf("%s.%s.metadata", strings.ToLower(owner.Type()), owner.Name()))
 
-	// Use the advisory lock to write in metadata file
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		fmt.Println(err.Error())
+	entry := fmt.Sprintf("%s ; %s", creationTime.Format("2006-01-02 15:04:05"), podName)
+	for _, n := range chain {
+		// Remember which ReplicaSet revision the pod belongs to so that revisions can be diffed later.
+		if rsNode, ok := n.(*ReplicasetNode); ok {
+			entry += fmt.Sprintf(" ; %s ; %s", rsNode.Name(), rsNode.rs.Annotations[revisionAnnotation])
+		}
 	}
-	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
-		fmt.Println("Error locking file:", err)
+	// The metadata file is shared with other recorders and with logs cleanup, which rewrites it.
+	if err := store.AppendMetadata(path, entry); err != nil {
+		fmt.Println("Error writing metadata:", err)
 		return
 	}
-	f.WriteString(fmt.Sprintf("%s ; %s\n", creationTime.Format("2006-01-02 15:04:05"), podName))
-	syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
-	f.Close()
+	podOwners.Store(podName, strings.ToLower(owner.Type())+"/"+owner.Name())
+	if hooks != nil && added {
+		hooks.PodAdded(hookPod(pod))
+	}
 
+	// The watch may have recorded a newer status while the pod was awaited.
+	if status, err := store.New(pkg.ConfigData.LogsPath).Status(namespace, podName); err != nil || status.UpdatedAt.Before(fetchedAt) {
+		recordStatus(latest, false)
+	}
 	//TODO: Can there be a race condition here?
 	checkpointData.LastResourceVersion = pod.ResourceVersion
 	//Start watching and recording logs
+	workers.Add(1)
 	go func(podName string) {
+		defer workers.Done()
 		fmt.Println("Watching logs for pod: " + podName)
 		path = filepath.Join(dir, podName+".log")
 		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
@@ -263,6 +389,17 @@ podWaitLoop:
 			fmt.Println(err.Error())
 		}
 		defer file.Close() // Remember to close the file
+		// Lines are evaluated against the alert rules and the log-match hooks as they are written.
+		writers := []io.Writer{file}
+		if alerts != nil {
+			ref := alertPod(pod)
+			writers = append(writers, alert.NewLineWriter(func(line string) { alerts.Line(ref, line) }))
+		}
+		if hooks != nil {
+			ref := hookPod(pod)
+			writers = append(writers, alert.NewLineWriter(func(line string) { hooks.Line(ref, line) }))
+		}
+		out := io.MultiWriter(writers...)
 		for {
 			opts := &v1.PodLogOptions{
 				Follow: true,
@@ -274,7 +411,7 @@ podWaitLoop:
 				return
 			}
 			defer stream.Close()
-			if _, err := io.Copy(file, stream); err != nil {
+			if _, err := io.Copy(out, stream); err != nil {
 				fmt.Println(err.Error())
 			}
 			fmt.Println("Stream closed for pod: " + podName)
@@ -283,6 +420,65 @@ podWaitLoop:
 
 }
 
+// recordStatus stores the phase and container restarts of the pod next to its logs.
+func recordStatus(pod *v1.Pod, deleted bool) {
+	status := store.PodStatus{
+		Phase:     string(pod.Status.Phase),
+		Deleted:   deleted,
+		UpdatedAt: time.Now(),
+	}
+	var lastReason string
+	var containers []hook.Container
+	for _, c := range pod.Status.ContainerStatuses {
+		cstatus := store.ContainerStatus{Name: c.Name, Restarts: c.RestartCount}
+		switch {
+		case c.State.Running != nil:
+			cstatus.State = "running"
+		case c.State.Waiting != nil:
+			cstatus.State = "waiting"
+			cstatus.Reason = c.State.Waiting.Reason
+		case c.State.Terminated != nil:
+			cstatus.State = "terminated"
+			cstatus.Reason = c.State.Terminated.Reason
+			cstatus.ExitCode = c.State.Terminated.ExitCode
+		}
+		status.Restarts += c.RestartCount
+		status.Containers = append(status.Containers, cstatus)
+		if t := c.LastTerminationState.Terminated; t != nil {
+			lastReason = t.Reason
+		}
+		hc := hook.Container{Name: c.Name, Restarts: c.RestartCount}
+		t := c.State.Terminated
+		if t == nil {
+			t = c.LastTerminationState.Terminated
+		}
+		if t != nil {
+			hc.ExitCode, hc.Reason, hc.FinishedAt = t.ExitCode, t.Reason, t.FinishedAt.Time
+		}
+		containers = append(containers, hc)
+	}
+	if alerts != nil {
+		alerts.Restarts(alertPod(pod), status.Restarts, lastReason)
+	}
+	if hooks != nil {
+		hooks.Containers(hookPod(pod), containers)
+	}
+	if crashes != nil {
+		for _, t := range crashTracker.Terminations(pod) {
+			if !deleted {
+				collectCrash(pod, t)
+			}
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(pkg.ConfigData.LogsPath, namespace), 0755); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	if err := store.New(pkg.ConfigData.LogsPath).WriteStatus(namespace, pod.Name, status); err != nil {
+		fmt.Println("Error writing status of pod", pod.Name, err.Error())
+	}
+}
+
 func mergeSort(pods []v1.Pod) []v1.Pod {
 	if len(pods) <= 1 {
 		sortedPods := pods
@@ -326,12 +522,17 @@ type Node interface {
 	Name() string
 }
 
-func getLastNode(n Node) Node {
+const revisionAnnotation = "deployment.kubernetes.io/revision"
+
+// getOwnerChain returns n followed by every owner up to the root of the ownerReferences chain.
+func getOwnerChain(n Node) []Node {
+	chain := []Node{n}
 	for {
 		nextNode := n.Next()
 		if nextNode == nil {
-			return n
+			return chain
 		}
+		chain = append(chain, nextNode)
 		n = nextNode
 	}
 }
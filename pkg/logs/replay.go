@@ -0,0 +1,154 @@
+package logs
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/output"
+	"github.com/revolyssup/k8sdebug/pkg/replay"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/revolyssup/k8sdebug/pkg/structured"
+	"github.com/spf13/cobra"
+)
+
+func newReplayCommand() *cobra.Command {
+	var speed, target, since, until string
+	var maxGap time.Duration
+	var interleave bool
+	cmd := &cobra.Command{
+		Use:   "replay <name>",
+		Short: "Re-emit recorded logs with their original timing",
+		Long: `Re-emit the recorded lines of a pod, or of the pods of an owner with --type, with their original relative
+timing, to test log parsers, alert rules and dashboards against real incidents.
+
+  --speed       10x replays ten times faster, 0.5x twice slower, max without waiting
+  --max-gap     caps every wait, so that idle periods of the recording do not stall the replay
+  --interleave  merges the lines of all the pods in time order instead of replaying the pods one after another
+  --target      where lines are sent instead of stdout:
+                  tcp://host:port or udp://host:port  RFC 5424 syslog, the pod is the hostname and the container the app name
+                  http://host:port/path              one JSON POST per line
+
+Lines keep their pod and container attribution: a prefix on stdout, the JSON fields with --output json or --target http.
+Lines without a timestamp are sent with the previous line.`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeName,
+		Run: func(cmd *cobra.Command, args []string) {
+			player := &replay.Player{MaxGap: maxGap}
+			var err error
+			if player.Speed, err = replay.ParseSpeed(speed); err != nil {
+				cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+				return
+			}
+			fromTime, err := parseTimeFlag(since)
+			if err != nil {
+				cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+				return
+			}
+			toTime, err := parseTimeFlag(until)
+			if err != nil {
+				cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+				return
+			}
+			var from, to time.Time
+			if fromTime != nil {
+				from = *fromTime
+			}
+			if toTime != nil {
+				to = *toTime
+			}
+			pods := []store.Pod{{Name: args[0], Namespace: namespace, OwnerKind: "pod", OwnerName: args[0], LogPath: logStore().LogPath(namespace, args[0])}}
+			if typ != "pod" {
+				var ok bool
+				if pods, ok = loadOwnerPods(cmd, args[0]); !ok {
+					return
+				}
+				pods = selectPods(pods)
+			}
+			send := printReplayed
+			if target != "" {
+				sink, err := replay.Dial(target)
+				if err != nil {
+					cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+					return
+				}
+				defer sink.Close()
+				send = sink.Send
+			}
+			streams := make([]*replay.Stream, 0, len(pods))
+			for _, pod := range pods {
+				stream, closeFn, err := replayStream(logStore(), pod, from, to)
+				if err != nil {
+					cmd.PrintErrln("file not found for pod:", pod.Name)
+					continue
+				}
+				defer closeFn()
+				streams = append(streams, stream)
+			}
+			if len(streams) == 0 {
+				cmd.Println(pkg.ColorLine("No logs to replay.", pkg.ColorRed))
+				return
+			}
+			sent := 0
+			start := time.Now()
+			err = player.Play(streams, interleave, func(l replay.Line) error {
+				sent++
+				return send(l)
+			})
+			if err != nil {
+				cmd.Println(pkg.ColorLine(fmt.Sprintf("Replay stopped after %d lines: %v", sent, err), pkg.ColorRed))
+				return
+			}
+			cmd.Println(pkg.ColorLine(fmt.Sprintf("Replayed %d lines of %d pods in %s", sent, len(streams), time.Since(start).Round(time.Millisecond)), pkg.ColorGreen))
+		},
+	}
+	cmd.Flags().StringVar(&speed, "speed", "1x", "replay speed, e.g. 10x, 0.5x or max")
+	cmd.Flags().DurationVar(&maxGap, "max-gap", 0, "longest wait between two lines, e.g. 5s. 0 keeps the original gaps")
+	cmd.Flags().BoolVar(&interleave, "interleave", false, "merge the lines of all the pods in time order")
+	cmd.Flags().StringVar(&target, "target", "", "send the lines to tcp://host:port, udp://host:port (syslog) or http://host:port/path instead of stdout")
+	cmd.Flags().StringVar(&since, "since", "", `only replay lines logged after this time, e.g. 2h or "2025-01-02 15:04:05"`)
+	cmd.Flags().StringVar(&until, "until", "", `only replay lines logged before this time, e.g. 1h or "2025-01-02 15:04:05"`)
+	addArchiveFlag(cmd)
+	return cmd
+}
+
+// replayStream opens the log of the pod. Lines before the first timestamp get the creation time of the pod.
+func replayStream(s *store.Store, pod store.Pod, since, until time.Time) (*replay.Stream, func() error, error) {
+	file, err := s.Open(pod.LogPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	template := replay.Line{Namespace: pod.Namespace, Pod: pod.Name}
+	if pod.OwnerKind != "pod" {
+		template.Owner = pod.Owner().String()
+	}
+	// The store does not tell the containers of a pod apart, the container is only known for single container pods.
+	if status, err := s.Status(pod.Namespace, pod.Name); err == nil && len(status.Containers) == 1 {
+		template.Container = status.Containers[0].Name
+	}
+	start := pod.Created()
+	if start.IsZero() {
+		if info, err := file.Stat(); err == nil {
+			start = info.ModTime()
+		}
+	}
+	return replay.NewStream(file, template, start, since, until), file.Close, nil
+}
+
+// printReplayed writes a replayed line to stdout, prefixed with its pod and container, or as a JSON event.
+func printReplayed(l replay.Line) error {
+	if output.Structured() {
+		return output.Event(os.Stdout, l)
+	}
+	source := l.Pod
+	if l.Container != "" {
+		source += "/" + l.Container
+	}
+	color := pkg.ColorYellow
+	if structured.IsError(l.Line) {
+		color = pkg.ColorRed
+	}
+	_, err := fmt.Printf("%s: %s\n", pkg.Colorize(source, color), l.Line)
+	return err
+}
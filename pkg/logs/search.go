@@ -0,0 +1,131 @@
+package logs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/multiline"
+	"github.com/revolyssup/k8sdebug/pkg/output"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+func newSearchCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "search <regex> [name]",
+		Short: "Search the recorded logs of an owner, or of every pod in the namespace if no name is given",
+		Args:  cobra.RangeArgs(1, 2),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) != 1 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return completeName(cmd, nil, toComplete)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			re, err := regexp.Compile(args[0])
+			if err != nil {
+				cmd.Println(pkg.ColorLine(fmt.Sprintf("invalid regular expression: %v", err), pkg.ColorRed))
+				return
+			}
+			if err := setupLineTransform(!output.Structured()); err != nil {
+				cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+				return
+			}
+			var pods []store.Pod
+			if len(args) == 2 {
+				var ok bool
+				if pods, ok = loadOwnerPods(cmd, args[1]); !ok {
+					return
+				}
+			} else {
+				if pods, err = logStore().AllPods(namespace); err != nil {
+					cmd.Println("No logs found for namespace:", namespace)
+					return
+				}
+			}
+			found := make([]searchMatch, 0)
+			emit := func(pod store.Pod, line string) {
+				fmt.Printf("%s: %s\n", pkg.Colorize(pod.Name, pkg.ColorYellow), line)
+			}
+			if output.Structured() {
+				emit = func(pod store.Pod, line string) {
+					found = append(found, searchMatch{Namespace: pod.Namespace, Pod: pod.Name, Line: line})
+				}
+			}
+			matches := 0
+			for _, pod := range pods {
+				n, err := searchPod(pod, re, emit)
+				if err != nil {
+					cmd.PrintErrln("file not found for pod:", pod.Name)
+					continue
+				}
+				matches += n
+			}
+			if output.Structured() {
+				if err := output.Write(os.Stdout, found); err != nil {
+					cmd.PrintErrln("Error encoding matches:", err)
+				}
+			}
+			cmd.Println("Total matches: ", matches)
+		},
+	}
+	addArchiveFlag(cmd)
+	return cmd
+}
+
+// searchMatch is the schema of logs search with a machine-readable --output.
+type searchMatch struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Line      string `json:"line"`
+}
+
+// searchPod passes every line of the pod matching re and the structured filters to emit.
+func searchPod(pod store.Pod, re *regexp.Regexp, emit func(store.Pod, string)) (int, error) {
+	file, err := logStore().Open(pod.LogPath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	matches := 0
+	if multilineEvents {
+		scanner := multiline.NewScanner(file)
+		for scanner.Scan() {
+			e := scanner.Event()
+			if !re.MatchString(e.Text()) {
+				continue
+			}
+			lines := append([]string{}, e.Lines...)
+			if lineTransform != nil {
+				var ok bool
+				if lines[0], ok = lineTransform(lines[0]); !ok {
+					continue
+				}
+			}
+			matches++
+			emit(pod, strings.Join(lines, "\n"))
+		}
+		return matches, scanner.Err()
+	}
+	buf := bufio.NewScanner(file)
+	buf.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for buf.Scan() {
+		line := buf.Text()
+		if !re.MatchString(line) {
+			continue
+		}
+		if lineTransform != nil {
+			var ok bool
+			if line, ok = lineTransform(line); !ok {
+				continue
+			}
+		}
+		matches++
+		emit(pod, line)
+	}
+	return matches, buf.Err()
+}
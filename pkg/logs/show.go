@@ -1,7 +1,6 @@
 package logs
 
 import (
-	"bufio"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -9,170 +8,223 @@ import (
 	"text/tabwriter"
 
 	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/output"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/revolyssup/k8sdebug/pkg/tail"
+	"github.com/revolyssup/k8sdebug/pkg/workspace"
 	"github.com/spf13/cobra"
 )
 
 var typ string
 var onlyName bool
 
+var archivePath string
+var archiveStore *store.Store
+
 func newShowCommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "show",
-		Short: "Show logs of a pod",
-		Args:  cobra.ExactArgs(1),
+		Use:               "show",
+		Short:             "Show logs of a pod",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeName,
 		Run: func(cmd *cobra.Command, args []string) {
 			name := args[0]
-			totalPods := 0
-			podNames := make([]string, 0)
-			logPaths := make([]string, 0)
-			timeStamps := make([]string, 0)
-			switch typ {
-			case "pod":
-				path := filepath.Join(pkg.ConfigData.LogsPath, namespace, fmt.Sprintf("%s.log", name))
-				logs, err := os.ReadFile(path)
-				if err != nil {
-					cmd.Println("No logs found for pod:", name)
-					return
-				}
-				cmd.Println(pkg.ColorLine("Logs from pod ", pkg.ColorYellow), name, ":", "\n", string(logs))
-
-			case "deployment":
-				path := filepath.Join(pkg.ConfigData.LogsPath, namespace, fmt.Sprintf("deployment.%s.metadata", name))
-				f, err := os.Open(path)
-				if err != nil {
-					cmd.Println("No logs found for deployment:", name)
-					return
-				}
-				buf := bufio.NewScanner(f)
-				buf.Split(bufio.ScanLines)
-				for buf.Scan() {
-					if !latestFirst && totalPods >= maxPods {
-						break
-					}
-					line := buf.Text()
-					if line == "" {
-						continue
-					}
-					ele := strings.Split(line, ";")
-					if len(ele) < 2 {
-						continue
-					}
-					podName := strings.TrimSpace(ele[1])
-					logPath := filepath.Join(pkg.ConfigData.LogsPath, namespace, fmt.Sprintf("%s.log", podName))
-					podNames = append(podNames, podName)
-					logPaths = append(logPaths, logPath)
-					timeStamps = append(timeStamps, ele[0])
-					totalPods++
-				}
-
-			case "replicaset":
-				path := filepath.Join(pkg.ConfigData.LogsPath, namespace, fmt.Sprintf("replicaset.%s.metadata", name))
-				f, err := os.Open(path)
-				if err != nil {
-					cmd.Println("No logs found for replicaset:", name)
+			// Structured output keeps the lines as they were logged.
+			if err := setupLineTransform(!output.Structured()); err != nil {
+				cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+				return
+			}
+			if typ == "pod" && !output.Structured() {
+				printPodFile(cmd, name)
+				return
+			}
+			pods := []store.Pod{{Name: name, Namespace: namespace, OwnerKind: "pod", OwnerName: name, LogPath: logStore().LogPath(namespace, name)}}
+			if typ != "pod" {
+				var ok bool
+				if pods, ok = loadOwnerPods(cmd, name); !ok {
 					return
 				}
-				buf := bufio.NewScanner(f)
-				buf.Split(bufio.ScanLines)
-				for buf.Scan() {
-					if !latestFirst && totalPods >= maxPods {
-						break
-					}
-					line := buf.Text()
-					if line == "" {
-						continue
-					}
-					ele := strings.Split(line, ";")
-					if len(ele) < 2 {
-						continue
-					}
-					// timestamp := strings.TrimSpace(ele[0])
-					podName := strings.TrimSpace(ele[1])
-					logPath := filepath.Join(pkg.ConfigData.LogsPath, namespace, fmt.Sprintf("%s.log", podName))
-					podNames = append(podNames, podName)
-					logPaths = append(logPaths, logPath)
-					timeStamps = append(timeStamps, ele[0])
-					totalPods++
-				}
 			}
-			podNames, logSlice, timeStamps := getPodLogs(podNames, logPaths, timeStamps)
+			if output.Structured() {
+				writeShownPods(cmd, selectPods(pods))
+				return
+			}
+			pods, logSlice := getPodLogs(selectPods(pods))
 			w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
-			for i := range podNames {
+			for i := range pods {
 				if onlyName {
 					if i == 0 {
 						fmt.Fprintln(w, "Pod Name\tCreated At")
 					}
-					fmt.Fprintln(w, fmt.Sprintf("%s\t%s", podNames[i], timeStamps[i]))
-					if i == len(podNames)-1 {
+					fmt.Fprintln(w, fmt.Sprintf("%s\t%s", pods[i].Name, pods[i].CreatedAt))
+					if i == len(pods)-1 {
 						w.Flush()
 					}
 				} else {
-					fmt.Println(pkg.ColorLine(fmt.Sprintf("Logs from pod: %s - %s", podNames[i], timeStamps[i]), pkg.ColorYellow), string(logSlice[i]))
+					fmt.Println(pkg.ColorLine(fmt.Sprintf("Logs from pod: %s - %s", pods[i].Name, pods[i].CreatedAt), pkg.ColorYellow), string(logSlice[i]))
 				}
 			}
-			cmd.Println("Total pods scanned: ", len(podNames))
+			cmd.Println("Total pods scanned: ", len(pods))
 		},
 	}
 	cmd.Flags().BoolVar(&onlyName, "only-names", false, "display only names")
+	addArchiveFlag(cmd)
 	return cmd
 }
 
-func getPodLogs(podNames []string, logPath []string, timestamps []string) (filteredPodNames []string, logSlice []string, newTimestamps []string) {
+// shownPod is the schema of logs show with a machine-readable --output.
+type shownPod struct {
+	Namespace string   `json:"namespace"`
+	Pod       string   `json:"pod"`
+	CreatedAt string   `json:"createdAt,omitempty"`
+	Revision  int      `json:"revision,omitempty"`
+	Lines     []string `json:"lines,omitempty"`
+}
+
+func writeShownPods(cmd *cobra.Command, pods []store.Pod) {
+	shown := make([]shownPod, 0, len(pods))
+	for _, pod := range pods {
+		p := shownPod{Namespace: pod.Namespace, Pod: pod.Name, CreatedAt: pod.CreatedAt, Revision: pod.Revision}
+		if !onlyName {
+			lines, err := readPodLines(pod)
+			if err != nil {
+				cmd.PrintErrln("file not found for pod:", pod.Name)
+				continue
+			}
+			p.Lines = lines
+		}
+		shown = append(shown, p)
+	}
+	if err := output.Write(os.Stdout, shown); err != nil {
+		cmd.PrintErrln("Error encoding logs:", err)
+	}
+}
+
+// logStore returns the store that commands read recorded logs from: the archive given with --archive,
+// or the store of the active workspace. Commands with --archive open it before they run, see addArchiveFlag.
+func logStore() *store.Store {
+	if archivePath == "" {
+		return workspace.Current()
+	}
+	return archiveStore
+}
+
+// openLogStore returns the store of logStore, opening the archive given with --archive the first time.
+func openLogStore() (*store.Store, error) {
+	if archivePath == "" {
+		return workspace.Current(), nil
+	}
+	if archiveStore == nil {
+		s, err := store.OpenArchive(archivePath, archiveCacheDir())
+		if err != nil {
+			return nil, fmt.Errorf("could not open archive %s: %w", archivePath, err)
+		}
+		archiveStore = s
+	}
+	return archiveStore, nil
+}
+
+// archiveCacheDir holds the indexes of the archives opened with --archive.
+func archiveCacheDir() string {
+	return filepath.Join(filepath.Dir(pkg.ConfigFilePath), "archives")
+}
+
+// addArchiveFlag lets a read-only command work on an exported archive instead of the store.
+// The archive is opened before the command runs, which prints the error if it cannot be read.
+func addArchiveFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&archivePath, "archive", "", "read the logs from a tar.gz written by logs export, without importing it. An index is cached on first open")
+	cmd.MarkFlagFilename("archive", "gz")
+	run := cmd.Run
+	cmd.Run = func(cmd *cobra.Command, args []string) {
+		if _, err := openLogStore(); err != nil {
+			cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+			return
+		}
+		run(cmd, args)
+	}
+}
+
+// loadOwnerPods reads the metadata of the owner of kind --type and prints a message if nothing was recorded.
+func loadOwnerPods(cmd *cobra.Command, name string) ([]store.Pod, bool) {
+	pods, err := logStore().Pods(namespace, typ, name)
+	if err != nil {
+		cmd.Printf("No logs found for %s: %s\n", typ, name)
+		return nil, false
+	}
+	return pods, true
+}
+
+// selectPods applies --max-pods and --latest to the chronologically ordered pods.
+func selectPods(pods []store.Pod) []store.Pod {
 	initial := 0
-	final := len(podNames)
+	final := len(pods)
 	if latestFirst {
-		initial = len(podNames) - maxPods
+		initial = len(pods) - maxPods
 	} else {
 		final = maxPods
 	}
 	if initial < 0 {
 		initial = 0
 	}
-	if final > len(podNames) {
-		final = len(podNames)
+	if final > len(pods) {
+		final = len(pods)
 	}
-	for i := initial; i < final; i++ {
-		filteredPodNames = append(filteredPodNames, podNames[i])
-		newTimestamps = append(newTimestamps, timestamps[i])
+	return pods[initial:final]
+}
+
+func getPodLogs(pods []store.Pod) (filteredPods []store.Pod, logSlice []string) {
+	for _, pod := range pods {
 		if onlyName {
+			filteredPods = append(filteredPods, pod)
 			continue
 		}
-		file, err := os.Open(logPath[i])
+		logs, err := readPodLogs(pod)
 		if err != nil {
-			fmt.Println("file not found for pod:", podNames[i])
+			fmt.Fprintln(os.Stderr, "file not found for pod:", pod.Name)
 			continue
 		}
-		defer file.Close()
-		logs := readNLines(file)
+		filteredPods = append(filteredPods, pod)
 		logSlice = append(logSlice, logs)
 	}
 	return
 }
 
-func readNLines(file *os.File) string {
-	n := maxLinesToRead
+func readPodLogs(pod store.Pod) (string, error) {
+	lines, err := readPodLines(pod)
+	return strings.Join(lines, "\n"), err
+}
+
+// readPodLines reads the first --max-lines lines of the pod, or the last ones with --end-of-file.
+// Memory use only depends on --max-lines, not on the size of the log.
+func readPodLines(pod store.Pod) ([]string, error) {
+	file, err := logStore().Open(pod.LogPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
 	var lines []string
-	i := 0
-	buf := bufio.NewScanner(file)
-	initial := i
-	for ; buf.Scan(); i++ {
-		line := buf.Text()
-		lines = append(lines, line)
-	}
-	if len(lines) == 0 {
-		return ""
-	}
-	final := len(lines)
-	if bottomFile {
-		initial = len(lines) - n
-	} else {
-		final = n
+	switch {
+	case multilineEvents:
+		// Every event counts as one line so that stack traces are not cut in the middle.
+		lines, err = readEvents(file, maxLinesToRead, bottomFile)
+	case bottomFile:
+		lines, err = tail.Last(file, maxLinesToRead, lineTransform)
+	default:
+		lines, err = tail.First(file, maxLinesToRead, lineTransform)
 	}
-	if initial < 0 {
-		initial = 0
+	return lines, err
+}
+
+// printPodFile streams the whole log of a single pod through the line filters.
+func printPodFile(cmd *cobra.Command, name string) {
+	file, err := logStore().Open(logStore().LogPath(namespace, name))
+	if err != nil {
+		cmd.Println("No logs found for pod:", name)
+		return
 	}
-	if final >= len(lines) {
-		final = len(lines) - 1
+	defer file.Close()
+	cmd.Println(pkg.ColorLine("Logs from pod ", pkg.ColorYellow), name, ":")
+	if err := tail.Copy(cmd.OutOrStdout(), file, lineTransform); err != nil {
+		cmd.Println(pkg.ColorLine(fmt.Sprintf("Error reading logs of pod %s: %v", name, err), pkg.ColorRed))
 	}
-	return strings.Join(lines[initial:final], "\n")
 }
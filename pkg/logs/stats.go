@@ -0,0 +1,219 @@
+package logs
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/output"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/revolyssup/k8sdebug/pkg/structured"
+	"github.com/revolyssup/k8sdebug/pkg/tail"
+	"github.com/spf13/cobra"
+)
+
+// podStats summarizes the recorded logs of one pod.
+type podStats struct {
+	Pod            string    `json:"pod"`
+	Revision       int       `json:"revision,omitempty"`
+	CreatedAt      string    `json:"createdAt,omitempty"`
+	Lines          int       `json:"lines"`
+	Bytes          int64     `json:"bytes"`
+	FirstTimestamp time.Time `json:"firstTimestamp"`
+	LastTimestamp  time.Time `json:"lastTimestamp"`
+	Lifetime       string    `json:"lifetime"`
+	Restarts       int32     `json:"restarts"`
+	LinesPerMinute float64   `json:"linesPerMinute"`
+	Errors         int       `json:"errors"`
+	Warnings       int       `json:"warnings"`
+	Phase          string    `json:"phase,omitempty"`
+	lifetime       time.Duration
+}
+
+// statsTotals aggregates podStats, per revision or for the whole owner.
+type statsTotals struct {
+	Revision int   `json:"revision,omitempty"`
+	Pods     int   `json:"pods"`
+	Lines    int   `json:"lines"`
+	Bytes    int64 `json:"bytes"`
+	Restarts int32 `json:"restarts"`
+	Errors   int   `json:"errors"`
+	Warnings int   `json:"warnings"`
+}
+
+func (t *statsTotals) add(s podStats) {
+	t.Pods++
+	t.Lines += s.Lines
+	t.Bytes += s.Bytes
+	t.Restarts += s.Restarts
+	t.Errors += s.Errors
+	t.Warnings += s.Warnings
+}
+
+type ownerStats struct {
+	Namespace string        `json:"namespace"`
+	Owner     string        `json:"owner"`
+	Pods      []podStats    `json:"pods"`
+	Revisions []statsTotals `json:"revisions,omitempty"`
+	Total     statsTotals   `json:"total"`
+}
+
+func newStatsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Show per pod and per owner statistics of the recorded logs",
+		Long: `Show line count, bytes, first and last timestamp, lifetime, restarts, lines per minute and
+heuristic error and warning counts of every pod of an owner, with per revision and owner totals.
+Timestamps are read from the log lines, falling back to the pod creation time and the last write of the log file.`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeName,
+		Run: func(cmd *cobra.Command, args []string) {
+			pods, ok := loadOwnerPods(cmd, args[0])
+			if !ok {
+				return
+			}
+			stats := computeOwnerStats(pods)
+			stats.Namespace = namespace
+			stats.Owner = typ + "/" + args[0]
+			if output.Structured() {
+				if err := output.Write(os.Stdout, stats); err != nil {
+					cmd.Println("Error encoding stats:", err)
+				}
+				return
+			}
+			printOwnerStats(stats)
+		},
+	}
+	return cmd
+}
+
+func computeOwnerStats(pods []store.Pod) ownerStats {
+	stats := ownerStats{Pods: make([]podStats, 0, len(pods))}
+	revisions := make(map[int]*statsTotals)
+	for _, pod := range pods {
+		s, err := computePodStats(pod)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "file not found for pod:", pod.Name)
+			continue
+		}
+		stats.Pods = append(stats.Pods, s)
+		stats.Total.add(s)
+		if pod.Revision != 0 {
+			if _, ok := revisions[pod.Revision]; !ok {
+				revisions[pod.Revision] = &statsTotals{Revision: pod.Revision}
+			}
+			revisions[pod.Revision].add(s)
+		}
+	}
+	for _, t := range revisions {
+		stats.Revisions = append(stats.Revisions, *t)
+	}
+	sort.Slice(stats.Revisions, func(i, j int) bool {
+		return stats.Revisions[i].Revision < stats.Revisions[j].Revision
+	})
+	return stats
+}
+
+func computePodStats(pod store.Pod) (podStats, error) {
+	s := podStats{Pod: pod.Name, Revision: pod.Revision, CreatedAt: pod.CreatedAt}
+	file, err := logStore().Open(pod.LogPath)
+	if err != nil {
+		return s, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return s, err
+	}
+	s.Bytes = info.Size()
+	buf := tail.NewScanner(file)
+	for buf.Scan() {
+		line := buf.Text()
+		s.Lines++
+		switch structured.Severity(line) {
+		case structured.SeverityError:
+			s.Errors++
+		case structured.SeverityWarn:
+			s.Warnings++
+		}
+		if t, ok := structured.Timestamp(line); ok {
+			if s.FirstTimestamp.IsZero() {
+				s.FirstTimestamp = t
+			}
+			s.LastTimestamp = t
+		}
+	}
+	if s.FirstTimestamp.IsZero() {
+		s.FirstTimestamp = pod.Created()
+	}
+	if s.LastTimestamp.IsZero() {
+		s.LastTimestamp = info.ModTime()
+	}
+	if !s.FirstTimestamp.IsZero() && s.LastTimestamp.After(s.FirstTimestamp) {
+		s.lifetime = s.LastTimestamp.Sub(s.FirstTimestamp)
+		s.LinesPerMinute = float64(s.Lines) / s.lifetime.Minutes()
+	}
+	s.Lifetime = s.lifetime.Round(time.Second).String()
+	if status, err := logStore().Status(pod.Namespace, pod.Name); err == nil {
+		s.Restarts = status.Restarts
+		s.Phase = status.Phase
+		if status.Deleted {
+			s.Phase = "Deleted"
+		}
+	}
+	return s, buf.Err()
+}
+
+func printOwnerStats(stats ownerStats) {
+	fmt.Print(pkg.ColorLine(fmt.Sprintf("Stats of %s in %s", stats.Owner, stats.Namespace), pkg.ColorYellow))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
+	fmt.Fprintln(w, "Pod Name\tRevision\tPhase\tLines\tBytes\tFirst Timestamp\tLast Timestamp\tLifetime\tRestarts\tLines/min\tErrors\tWarnings")
+	for _, s := range stats.Pods {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%d\t%.1f\t%d\t%d\n", s.Pod, revisionString(s.Revision), orDash(s.Phase),
+			s.Lines, humanBytes(s.Bytes), formatSeen(s.FirstTimestamp), formatSeen(s.LastTimestamp), s.Lifetime,
+			s.Restarts, s.LinesPerMinute, s.Errors, s.Warnings)
+	}
+	w.Flush()
+	if len(stats.Revisions) > 0 {
+		fmt.Println()
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
+		fmt.Fprintln(w, "Revision\tPods\tLines\tBytes\tRestarts\tErrors\tWarnings")
+		for _, t := range stats.Revisions {
+			fmt.Fprintf(w, "%d\t%d\t%d\t%s\t%d\t%d\t%d\n", t.Revision, t.Pods, t.Lines, humanBytes(t.Bytes), t.Restarts, t.Errors, t.Warnings)
+		}
+		w.Flush()
+	}
+	t := stats.Total
+	fmt.Printf("\nTotal: %d pods, %d lines, %s, %d restarts, %d errors, %d warnings\n",
+		t.Pods, t.Lines, humanBytes(t.Bytes), t.Restarts, t.Errors, t.Warnings)
+}
+
+func revisionString(rev int) string {
+	if rev == 0 {
+		return "-"
+	}
+	return fmt.Sprint(rev)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,71 @@
+package logs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputePodStats(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"shop/deployment.api.metadata": "2025-01-01 10:00:00 ; api-1 ; api-5d4 ; 1\n2025-01-01 10:00:00 ; api-2 ; api-5d4 ; 1\n",
+		"shop/api-1.log": `{"ts":"2025-01-01T10:00:00Z","level":"info","msg":"start"}
+{"ts":"2025-01-01T10:01:00Z","level":"warn","msg":"slow"}
+{"ts":"2025-01-01T10:02:00Z","level":"error","msg":"failed"}
+`,
+		"shop/api-1.status": `{"phase":"Running","restarts":2}`,
+		"shop/api-2.log":    "one\ntwo\nthree\nfour\nfive\n",
+		"shop/api-2.status": `{"phase":"Running","deleted":true}`,
+		"shop/debug.log":    "plain\n",
+	})
+	// Without timestamps in the lines, the lifetime runs from the pod creation to the last write of the log.
+	created, err := time.ParseInLocation(store.TimeFormat, "2025-01-01 10:00:00", time.Local)
+	require.NoError(t, err)
+	written := created.Add(10 * time.Minute)
+	require.NoError(t, os.Chtimes(filepath.Join(root, "shop", "api-2.log"), written, written))
+	s := store.New(root)
+	useLogStore(t, s)
+
+	pods, err := s.Pods("shop", "deployment", "api")
+	require.NoError(t, err)
+	require.Len(t, pods, 2)
+
+	stats, err := computePodStats(pods[0])
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats.Lines)
+	assert.Equal(t, 1, stats.Errors)
+	assert.Equal(t, 1, stats.Warnings)
+	assert.Equal(t, time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC), stats.FirstTimestamp.UTC())
+	assert.Equal(t, time.Date(2025, 1, 1, 10, 2, 0, 0, time.UTC), stats.LastTimestamp.UTC())
+	assert.Equal(t, "2m0s", stats.Lifetime)
+	assert.InDelta(t, 1.5, stats.LinesPerMinute, 0.001)
+	assert.Equal(t, int32(2), stats.Restarts)
+	assert.Equal(t, "Running", stats.Phase)
+
+	stats, err = computePodStats(pods[1])
+	require.NoError(t, err)
+	assert.Equal(t, 5, stats.Lines)
+	assert.True(t, created.Equal(stats.FirstTimestamp))
+	assert.True(t, written.Equal(stats.LastTimestamp))
+	assert.Equal(t, "10m0s", stats.Lifetime)
+	assert.InDelta(t, 0.5, stats.LinesPerMinute, 0.001)
+	assert.Equal(t, "Deleted", stats.Phase)
+
+	// A standalone pod has no creation time, so neither a lifetime nor a rate is computed.
+	pods, err = s.Pods("shop", "pod", "debug")
+	require.NoError(t, err)
+	stats, err = computePodStats(pods[0])
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Lines)
+	assert.Equal(t, "0s", stats.Lifetime)
+	assert.Zero(t, stats.LinesPerMinute)
+
+	_, err = computePodStats(store.Pod{Name: "gone", Namespace: "shop", LogPath: s.LogPath("shop", "gone")})
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,81 @@
+package logs
+
+import (
+	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/structured"
+)
+
+var (
+	whereExprs []string
+	fieldNames []string
+	fieldOrder []string
+	rawLines   bool
+)
+
+// lineTransform is applied to every line read from a log file. Returning false drops the line.
+// nil keeps the lines unchanged.
+var lineTransform func(line string) (string, bool)
+
+// setupLineTransform builds lineTransform from the redaction rules of the settings, --where, --fields, --field-order
+// and --raw.
+// pretty enables pretty printing of JSON and logfmt lines, it is off when lines are compared in diff.
+func setupLineTransform(pretty bool) error {
+	conditions := make([]structured.Condition, 0, len(whereExprs))
+	for _, expr := range whereExprs {
+		c, err := structured.ParseCondition(expr)
+		if err != nil {
+			return err
+		}
+		conditions = append(conditions, c)
+	}
+	redact, err := pkg.Settings.Redactor()
+	if err != nil {
+		return err
+	}
+	pretty = pretty && !rawLines
+	filtered := len(conditions) > 0 || len(fieldNames) > 0
+	if !filtered && !pretty {
+		lineTransform = nil
+		if redact != nil {
+			lineTransform = func(line string) (string, bool) {
+				return redact(line), true
+			}
+		}
+		return nil
+	}
+	lineTransform = func(line string) (string, bool) {
+		if redact != nil {
+			line = redact(line)
+		}
+		rec := structured.Parse(line)
+		if filtered && (!rec.Structured() || !structured.MatchAll(rec, conditions)) {
+			return "", false
+		}
+		if len(fieldNames) > 0 {
+			rec = rec.Project(fieldNames)
+			if len(rec.Fields) == 0 {
+				return "", false
+			}
+		}
+		if !rec.Structured() || (!pretty && len(fieldNames) == 0) {
+			return line, true
+		}
+		if !pretty {
+			return rec.Logfmt(), true
+		}
+		return prettyRecord(rec.Ordered(fieldOrder)), true
+	}
+	return nil
+}
+
+// prettyRecord renders a structured line as logfmt, colored by its level.
+func prettyRecord(rec structured.Record) string {
+	line := rec.Logfmt()
+	switch structured.Severity(rec.Raw) {
+	case structured.SeverityError:
+		return pkg.Colorize(line, pkg.ColorRed)
+	case structured.SeverityWarn:
+		return pkg.Colorize(line, pkg.ColorYellow)
+	}
+	return line
+}
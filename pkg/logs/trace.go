@@ -0,0 +1,187 @@
+package logs
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/output"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/revolyssup/k8sdebug/pkg/structured"
+	"github.com/revolyssup/k8sdebug/pkg/tail"
+	"github.com/spf13/cobra"
+)
+
+var defaultIDFields = []string{"trace_id", "traceId", "trace.id", "traceID", "request_id", "requestId", "request.id", "x_request_id"}
+
+// traceLine is a line carrying the traced id. Service is the owner of the pod.
+type traceLine struct {
+	Time    time.Time `json:"time"`
+	Service string    `json:"service"`
+	Pod     string    `json:"pod"`
+	Line    string    `json:"line"`
+}
+
+type traceService struct {
+	Service   string    `json:"service"`
+	Pods      []string  `json:"pods"`
+	Lines     int       `json:"lines"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+type traceResult struct {
+	ID        string         `json:"id"`
+	Namespace string         `json:"namespace"`
+	Services  []traceService `json:"services"`
+	Lines     []traceLine    `json:"lines"`
+}
+
+func newTraceCommand() *cobra.Command {
+	var idFields []string
+	cmd := &cobra.Command{
+		Use:   "trace <id>",
+		Short: "Follow a trace or request id across every recorded pod of the namespace",
+		Long: `Find every line carrying a trace or request id across all owners of the namespace and show them
+in chronological order, with a summary per service (the owner of the pods).
+JSON and logfmt lines match when one of the --id-fields has the id as value, nested JSON keys are joined with dots.
+Plain lines match on text like trace_id=<id> or request_id: <id>.
+Lines are ordered by their timestamp, lines without one by the creation time of their pod.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := setupLineTransform(!output.Structured()); err != nil {
+				cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+				return
+			}
+			pods, err := logStore().AllPods(namespace)
+			if err != nil {
+				cmd.Println("No logs found for namespace:", namespace)
+				return
+			}
+			res := traceResult{ID: args[0], Namespace: namespace}
+			match := newTraceMatcher(args[0], idFields)
+			for _, pod := range pods {
+				lines, err := tracePod(pod, match)
+				if err != nil {
+					cmd.PrintErrln("file not found for pod:", pod.Name)
+					continue
+				}
+				res.Lines = append(res.Lines, lines...)
+			}
+			sort.SliceStable(res.Lines, func(i, j int) bool {
+				return res.Lines[i].Time.Before(res.Lines[j].Time)
+			})
+			res.Services = traceServices(res.Lines)
+			if output.Structured() {
+				if err := output.Write(os.Stdout, res); err != nil {
+					cmd.PrintErrln("Error encoding trace:", err)
+				}
+				return
+			}
+			printTrace(res)
+		},
+	}
+	cmd.Flags().StringSliceVar(&idFields, "id-fields", defaultIDFields, "names of the fields carrying trace and request ids")
+	return cmd
+}
+
+// newTraceMatcher returns a function reporting whether a line carries id in one of the fields.
+func newTraceMatcher(id string, fields []string) func(string) bool {
+	names := make([]string, 0, len(fields))
+	for _, f := range fields {
+		names = append(names, regexp.QuoteMeta(f))
+	}
+	plain := regexp.MustCompile(`(?i)(?:^|[^\w.])(?:` + strings.Join(names, "|") + `)["']?\s*[=:]\s*["']?` +
+		regexp.QuoteMeta(id) + `(?:$|[^\w-])`)
+	return func(line string) bool {
+		if !strings.Contains(line, id) {
+			return false
+		}
+		if rec := structured.Parse(line); rec.Structured() {
+			for _, f := range fields {
+				if v, ok := rec.Get(f); ok && v == id {
+					return true
+				}
+			}
+			return false
+		}
+		return plain.MatchString(line)
+	}
+}
+
+func tracePod(pod store.Pod, match func(string) bool) ([]traceLine, error) {
+	file, err := logStore().Open(pod.LogPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	service := pod.Owner().String()
+	lines := make([]traceLine, 0)
+	scanner := tail.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !match(line) {
+			continue
+		}
+		at, ok := structured.Timestamp(line)
+		if !ok {
+			at = pod.Created()
+		}
+		if lineTransform != nil {
+			if line, ok = lineTransform(line); !ok {
+				continue
+			}
+		}
+		lines = append(lines, traceLine{Time: at, Service: service, Pod: pod.Name, Line: line})
+	}
+	return lines, scanner.Err()
+}
+
+// traceServices summarizes the chronologically ordered lines per service, in the order the services were first seen.
+func traceServices(lines []traceLine) []traceService {
+	services := make([]traceService, 0)
+	index := make(map[string]int)
+	for _, l := range lines {
+		i, ok := index[l.Service]
+		if !ok {
+			i = len(services)
+			index[l.Service] = i
+			services = append(services, traceService{Service: l.Service, FirstSeen: l.Time})
+		}
+		s := &services[i]
+		s.Lines++
+		s.LastSeen = l.Time
+		if !slices.Contains(s.Pods, l.Pod) {
+			s.Pods = append(s.Pods, l.Pod)
+		}
+	}
+	return services
+}
+
+func printTrace(res traceResult) {
+	if len(res.Lines) == 0 {
+		fmt.Println(pkg.ColorLine(fmt.Sprintf("No lines found for %s in %s.", res.ID, res.Namespace), pkg.ColorYellow))
+		return
+	}
+	fmt.Print(pkg.ColorLine(fmt.Sprintf("Trace %s in %s: %d lines across %d services", res.ID, res.Namespace, len(res.Lines), len(res.Services)), pkg.ColorYellow))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
+	fmt.Fprintln(w, "Service\tPods\tLines\tFirst Seen\tLast Seen")
+	for _, s := range res.Services {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", s.Service, strings.Join(s.Pods, ","), s.Lines, formatSeen(s.FirstSeen), formatSeen(s.LastSeen))
+	}
+	w.Flush()
+	fmt.Println()
+	start := res.Lines[0].Time
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, l := range res.Lines {
+		fmt.Fprintf(w, "%s\t+%s\t%s\t%s\t%s\n", formatSeen(l.Time), l.Time.Sub(start).Round(time.Millisecond),
+			pkg.Colorize(l.Service, pkg.ColorYellow), l.Pod, l.Line)
+	}
+	w.Flush()
+}
@@ -0,0 +1,76 @@
+package logs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceMatcher(t *testing.T) {
+	match := newTraceMatcher("abc", defaultIDFields)
+	for _, tc := range []struct {
+		line string
+		want bool
+	}{
+		{`{"msg":"ok","trace_id":"abc"}`, true},
+		{`{"msg":"ok","trace":{"id":"abc"}}`, true},
+		{`{"msg":"ok","request":{"id":"abc-1"}}`, false},
+		{`{"msg":"abc","user":"abc"}`, false},
+		{`level=info msg=ok requestId=abc`, true},
+		{`level=info msg=ok requestId=abcd`, false},
+		{`handled trace_id=abc in 3ms`, true},
+		{`handled request_id: "abc"`, true},
+		{`handled trace_id=abc-1 in 3ms`, false},
+		{`handled trace_id=abc.`, true},
+		{`handled my_trace_id=abc`, false},
+		{`user abc logged in`, false},
+	} {
+		assert.Equal(t, tc.want, match(tc.line), tc.line)
+	}
+
+	match = newTraceMatcher("abc", []string{"span"})
+	assert.True(t, match(`{"span":"abc"}`))
+	assert.False(t, match(`{"trace_id":"abc"}`))
+	assert.False(t, match(`trace_id=abc`))
+}
+
+func TestTracePod(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"shop/deployment.api.metadata": "2025-01-01 10:00:00 ; api-1 ; api-5d4 ; 1\n",
+		"shop/api-1.log":               "2025-01-01T10:00:05Z trace_id=abc start\n2025-01-01T10:00:06Z trace_id=abd other\nplain trace_id=abc\n",
+	})
+	s := store.New(root)
+	useLogStore(t, s)
+	pods, err := s.Pods("shop", "deployment", "api")
+	require.NoError(t, err)
+
+	lines, err := tracePod(pods[0], newTraceMatcher("abc", defaultIDFields))
+	require.NoError(t, err)
+	require.Len(t, lines, 2)
+	assert.Equal(t, "deployment/api", lines[0].Service)
+	assert.Equal(t, "api-1", lines[0].Pod)
+	assert.Equal(t, "2025-01-01T10:00:05Z trace_id=abc start", lines[0].Line)
+	assert.True(t, time.Date(2025, 1, 1, 10, 0, 5, 0, time.UTC).Equal(lines[0].Time))
+	// Lines without a timestamp take the creation time of their pod.
+	assert.True(t, pods[0].Created().Equal(lines[1].Time))
+}
+
+func TestTraceServices(t *testing.T) {
+	at := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	services := traceServices([]traceLine{
+		{Time: at, Service: "deployment/gateway", Pod: "gateway-1"},
+		{Time: at.Add(time.Second), Service: "deployment/api", Pod: "api-1"},
+		{Time: at.Add(2 * time.Second), Service: "deployment/api", Pod: "api-2"},
+		{Time: at.Add(3 * time.Second), Service: "deployment/gateway", Pod: "gateway-1"},
+		{Time: at.Add(4 * time.Second), Service: "deployment/api", Pod: "api-1"},
+	})
+	assert.Equal(t, []traceService{
+		{Service: "deployment/gateway", Pods: []string{"gateway-1"}, Lines: 2, FirstSeen: at, LastSeen: at.Add(3 * time.Second)},
+		{Service: "deployment/api", Pods: []string{"api-1", "api-2"}, Lines: 3, FirstSeen: at.Add(time.Second), LastSeen: at.Add(4 * time.Second)},
+	}, services)
+	assert.Empty(t, traceServices(nil))
+}
@@ -0,0 +1,188 @@
+package multiline
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+)
+
+type Kind string
+
+const (
+	KindLine            Kind = "line"
+	KindGoPanic         Kind = "go-panic"
+	KindJavaException   Kind = "java-exception"
+	KindPythonTraceback Kind = "python-traceback"
+)
+
+// Event is a group of consecutive log lines that belong together, e.g. a panic with its goroutine dump.
+// Lines that are not part of a stack trace are events of KindLine with a single line.
+type Event struct {
+	Kind  Kind     `json:"kind"`
+	Lines []string `json:"lines"`
+	// Line is the 1-based line number of the first line in the log file.
+	Line int `json:"line"`
+}
+
+func (e Event) Text() string {
+	return strings.Join(e.Lines, "\n")
+}
+
+// Header is the line describing the error: the panic message, the exception line or, for
+// Python, the final "Error: message" line after the traceback.
+func (e Event) Header() string {
+	if e.Kind == KindPythonTraceback {
+		for i := len(e.Lines) - 1; i >= 0; i-- {
+			if l := e.Lines[i]; l != "" && !startsWithSpace(l) {
+				return l
+			}
+		}
+	}
+	return e.Lines[0]
+}
+
+var (
+	javaException = regexp.MustCompile(`^(Exception in thread "[^"]*" )?([a-zA-Z_$][\w$]*\.)+[\w$]*(Exception|Error|Throwable)(: .*)?$`)
+	javaFrame     = regexp.MustCompile(`^\s+(at |\.\.\. \d+ (more|common frames omitted))`)
+	javaCause     = regexp.MustCompile(`^\s*(Caused by|Suppressed): `)
+	goFrame       = regexp.MustCompile(`^[\w./*()\-]+\(.*\)$`)
+)
+
+func startKind(line string) Kind {
+	switch {
+	case strings.HasPrefix(line, "panic: "), strings.HasPrefix(line, "fatal error: "):
+		return KindGoPanic
+	case strings.HasPrefix(line, "Traceback (most recent call last):"):
+		return KindPythonTraceback
+	case javaException.MatchString(line):
+		return KindJavaException
+	}
+	return KindLine
+}
+
+func startsWithSpace(line string) bool {
+	return strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")
+}
+
+// Assembler groups lines pushed one at a time into events.
+type Assembler struct {
+	current *Event
+	// closed is set once a Python traceback got its final exception line.
+	closed bool
+	lineNo int
+}
+
+// Add pushes the next line and returns the event completed by it, if any.
+func (a *Assembler) Add(line string) (Event, bool) {
+	a.lineNo++
+	if a.current != nil && a.continues(line) {
+		a.current.Lines = append(a.current.Lines, line)
+		return Event{}, false
+	}
+	done, ok := a.Flush()
+	a.current = &Event{Kind: startKind(line), Lines: []string{line}, Line: a.lineNo}
+	a.closed = false
+	return done, ok
+}
+
+// Flush returns the event being assembled, if any.
+func (a *Assembler) Flush() (Event, bool) {
+	if a.current == nil {
+		return Event{}, false
+	}
+	e := *a.current
+	a.current = nil
+	// Blank lines are allowed inside Go panics but do not belong at their end.
+	for len(e.Lines) > 1 && strings.TrimSpace(e.Lines[len(e.Lines)-1]) == "" {
+		e.Lines = e.Lines[:len(e.Lines)-1]
+	}
+	return e, true
+}
+
+func (a *Assembler) continues(line string) bool {
+	switch a.current.Kind {
+	case KindGoPanic:
+		return line == "" ||
+			startsWithSpace(line) ||
+			strings.HasPrefix(line, "goroutine ") ||
+			strings.HasPrefix(line, "created by ") ||
+			strings.HasPrefix(line, "[signal ") ||
+			strings.HasPrefix(line, "exit status ") ||
+			strings.HasPrefix(line, "panic: ") ||
+			goFrame.MatchString(line)
+	case KindJavaException:
+		return javaFrame.MatchString(line) || javaCause.MatchString(line)
+	case KindPythonTraceback:
+		if strings.HasPrefix(line, "During handling of the above exception") ||
+			strings.HasPrefix(line, "The above exception was the direct cause") {
+			a.closed = false
+			return true
+		}
+		if a.closed {
+			return false
+		}
+		if startsWithSpace(line) || line == "" || strings.HasPrefix(line, "Traceback (most recent call last):") {
+			return true
+		}
+		// The first unindented line is the exception itself and ends the traceback.
+		a.closed = true
+		return true
+	}
+	return false
+}
+
+// Scanner reads events from a reader, like bufio.Scanner does for lines.
+type Scanner struct {
+	lines *bufio.Scanner
+	asm   Assembler
+	event Event
+	done  bool
+}
+
+func NewScanner(r io.Reader) *Scanner {
+	lines := bufio.NewScanner(r)
+	lines.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	return &Scanner{lines: lines}
+}
+
+func (s *Scanner) Scan() bool {
+	for !s.done {
+		if !s.lines.Scan() {
+			s.done = true
+			break
+		}
+		if e, ok := s.asm.Add(s.lines.Text()); ok {
+			s.event = e
+			return true
+		}
+	}
+	if e, ok := s.asm.Flush(); ok {
+		s.event = e
+		return true
+	}
+	return false
+}
+
+func (s *Scanner) Event() Event {
+	return s.event
+}
+
+func (s *Scanner) Err() error {
+	return s.lines.Err()
+}
+
+// Group groups already read lines into events.
+func Group(lines []string) []Event {
+	var a Assembler
+	events := make([]Event, 0, len(lines))
+	for _, l := range lines {
+		if e, ok := a.Add(l); ok {
+			events = append(events, e)
+		}
+	}
+	if e, ok := a.Flush(); ok {
+		events = append(events, e)
+	}
+	return events
+}
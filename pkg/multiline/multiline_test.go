@@ -0,0 +1,58 @@
+package multiline_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/revolyssup/k8sdebug/pkg/multiline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const goPanic = `panic: runtime error: index out of range [5] with length 3
+
+goroutine 1 [running]:
+main.handler(0xc000012345)
+	/app/main.go:12 +0x1d
+main.main()
+	/app/main.go:20 +0x25
+exit status 2`
+
+func TestGroup(t *testing.T) {
+	logs := "starting\n" + goPanic + "\n\nrestarted\n" +
+		`Traceback (most recent call last):
+  File "app.py", line 3, in <module>
+    main()
+  File "app.py", line 2, in main
+    raise ValueError("bad")
+ValueError: bad
+java.lang.IllegalStateException: boom
+	at com.x.Foo.bar(Foo.java:12)
+Caused by: java.io.IOException: io
+	... 2 more
+done`
+	events := multiline.Group(strings.Split(logs, "\n"))
+	require.Len(t, events, 6)
+	assert.Equal(t, multiline.KindLine, events[0].Kind)
+	assert.Equal(t, multiline.KindGoPanic, events[1].Kind)
+	assert.Equal(t, goPanic, events[1].Text())
+	assert.Equal(t, []string{"main.handler", "main.main"}, events[1].Frames())
+	assert.Equal(t, "restarted", events[2].Lines[0])
+	assert.Equal(t, 11, events[2].Line)
+	assert.Equal(t, multiline.KindPythonTraceback, events[3].Kind)
+	assert.Equal(t, "ValueError: bad", events[3].Header())
+	assert.Equal(t, []string{"app.py:main", "app.py:<module>"}, events[3].Frames())
+	assert.Equal(t, multiline.KindJavaException, events[4].Kind)
+	assert.Len(t, events[4].Lines, 4)
+	assert.Equal(t, "done", events[5].Lines[0])
+}
+
+func TestSignature(t *testing.T) {
+	other := strings.NewReplacer("[5] with length 3", "[7] with length 2", "0xc000012345", "0xc000099999").Replace(goPanic)
+	a := multiline.Group(strings.Split(goPanic, "\n"))[0]
+	b := multiline.Group(strings.Split(other, "\n"))[0]
+	assert.Equal(t, a.Signature(), b.Signature())
+
+	c := multiline.Group(strings.Split(strings.Replace(goPanic, "main.handler", "main.other", 1), "\n"))[0]
+	assert.NotEqual(t, a.Signature(), c.Signature())
+}
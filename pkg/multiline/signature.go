@@ -0,0 +1,61 @@
+package multiline
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"regexp"
+	"strings"
+
+	"github.com/revolyssup/k8sdebug/pkg/normalize"
+)
+
+// signatureFrames is the number of top frames that identify a stack.
+const signatureFrames = 5
+
+var (
+	javaFrameFunc = regexp.MustCompile(`^\s+at ([\w$.<>/]+)\(`)
+	pythonFrame   = regexp.MustCompile(`^\s+File "([^"]+)", line \d+, in (.+)$`)
+	goArgs        = regexp.MustCompile(`\([^()]*\)$`)
+)
+
+// Frames returns the functions of the stack trace of the event, top frame first, without arguments,
+// addresses and line numbers.
+func (e Event) Frames() []string {
+	frames := make([]string, 0)
+	for _, l := range e.Lines[1:] {
+		switch e.Kind {
+		case KindGoPanic:
+			if startsWithSpace(l) || strings.HasPrefix(l, "goroutine ") || !goFrame.MatchString(l) {
+				continue
+			}
+			frames = append(frames, goArgs.ReplaceAllString(strings.TrimPrefix(l, "created by "), ""))
+		case KindJavaException:
+			if m := javaFrameFunc.FindStringSubmatch(l); m != nil {
+				frames = append(frames, m[1])
+			}
+		case KindPythonTraceback:
+			if m := pythonFrame.FindStringSubmatch(l); m != nil {
+				frames = append(frames, m[1]+":"+m[2])
+			}
+		}
+	}
+	if e.Kind == KindPythonTraceback {
+		// Python prints the innermost frame last.
+		for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+			frames[i], frames[j] = frames[j], frames[i]
+		}
+	}
+	return frames
+}
+
+// Signature identifies events with the same origin. It hashes the kind, the normalized header
+// and the top frames, so the same panic in different pods or at different times has the same signature.
+func (e Event) Signature() string {
+	frames := e.Frames()
+	if len(frames) > signatureFrames {
+		frames = frames[:signatureFrames]
+	}
+	h := sha1.New()
+	h.Write([]byte(string(e.Kind) + "\n" + normalize.Line(e.Header()) + "\n" + strings.Join(frames, "\n")))
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
@@ -0,0 +1,64 @@
+package normalize
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/revolyssup/k8sdebug/pkg/structured"
+)
+
+// Volatile tokens, replaced in order. More specific patterns come first so that e.g. a UUID is
+// not turned into a series of numbers.
+var replacements = []struct {
+	re   *regexp.Regexp
+	with string
+}{
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`), "<ts>"},
+	{regexp.MustCompile(`\d{2}:\d{2}:\d{2}(\.\d+)?`), "<time>"},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "<uuid>"},
+	{regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}(:\d+)?\b`), "<ip>"},
+	{regexp.MustCompile(`\b0x[0-9a-fA-F]+\b`), "<hex>"},
+	{regexp.MustCompile(`\b[0-9a-f]{12,}\b`), "<hex>"},
+	// Suffixes added by ReplicaSets and Jobs to pod names, e.g. api-7d9f8b6c4-x2x7q.
+	{regexp.MustCompile(`\b([a-z0-9]+(-[a-z0-9]+)*)-[a-z0-9]{8,10}-[a-z0-9]{5}\b`), "$1-<pod>"},
+	{regexp.MustCompile(`"[^"]*"`), `"<str>"`},
+	{regexp.MustCompile(`'[^']*'`), `'<str>'`},
+	// Numbers, with their unit if they have one, e.g. 35ms, 1h30m or 512MiB.
+	{regexp.MustCompile(`-?\b(\d+(\.\d+)?(ns|us|µs|ms|s|m|h|d|[kKMGT]i?B|B))+\b|-?\b\d+(\.\d+)?\b`), "<n>"},
+}
+
+// Line replaces tokens that change between otherwise identical log lines, like timestamps,
+// ids, addresses and numbers, with placeholders.
+func Line(line string) string {
+	for _, r := range replacements {
+		line = r.re.ReplaceAllString(line, r.with)
+	}
+	return line
+}
+
+// messageKeys are the fields of JSON and logfmt lines that make up their pattern. The other fields
+// usually carry request specific values.
+var messageKeys = []string{"level", "lvl", "severity", "msg", "message", "error", "err", "exception"}
+
+// Pattern returns the normalized form of a log line, equal for lines logged by the same statement.
+// JSON and logfmt lines are reduced to their level, message and error fields, or to their keys
+// if they have none of them.
+func Pattern(line string) string {
+	rec := structured.Parse(line)
+	if !rec.Structured() {
+		return Line(line)
+	}
+	parts := make([]string, 0, len(messageKeys))
+	for _, key := range messageKeys {
+		if v, ok := rec.Get(key); ok {
+			parts = append(parts, key+"="+Line(v))
+		}
+	}
+	if len(parts) == 0 {
+		for _, f := range rec.Fields {
+			parts = append(parts, f.Key)
+		}
+		return rec.Format.String() + "{" + strings.Join(parts, ",") + "}"
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,44 @@
+package normalize_test
+
+import (
+	"testing"
+
+	"github.com/revolyssup/k8sdebug/pkg/normalize"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPattern(t *testing.T) {
+	for _, tc := range []struct {
+		line string
+		want string
+	}{
+		{`2025-01-02T15:04:05Z connected to 10.0.0.12:5432 in 35ms`, `<ts> connected to <ip> in <n>`},
+		{`request 3f2b1c9e-8a4d-4e2f-9c1a-7b6d5e4f3a2b from api-7d9f8b6c4-x2x7q took 12.5s`, `request <uuid> from api-<pod> took <n>`},
+		{`retry in 1h30m, cache 512MiB, load -0.75, 35%`, `retry in <n>, cache <n>, load <n>, <n>%`},
+		{`value 0xdeadbeef sha 4f2b1c9e8a4d4e2f`, `value <hex> sha <hex>`},
+		{`user 'alice' said "hi" at 15:04:05.123`, `user '<str>' said "<str>" at <time>`},
+		{`v2 handler abc123 ready`, `v2 handler abc123 ready`},
+		// Structured lines are reduced to their level, message and error fields.
+		{`{"ts":"2025-01-02T15:04:05Z","level":"error","msg":"query failed","error":"timeout after 30s","request_id":"abc123","user":42}`,
+			`level=error msg=query failed error=timeout after <n>`},
+		{`{"severity":"WARN","message":"pool at 90%","pool":{"size":10}}`, `severity=WARN message=pool at <n>%`},
+		{`level=warn msg="slow query" duration=1.2s table=orders`, `level=warn msg=slow query`},
+		// Or to their keys when they have none.
+		{`{"user":42,"path":"/api"}`, `json{user,path}`},
+		{`user=42 path=/api`, `logfmt{user,path}`},
+	} {
+		assert.Equal(t, tc.want, normalize.Pattern(tc.line), tc.line)
+	}
+}
+
+func TestPatternSameStatement(t *testing.T) {
+	for _, lines := range [][2]string{
+		{`{"level":"error","msg":"query failed","error":"timeout after 30s","request_id":"abc"}`,
+			`{"request_id":"zzz","error":"timeout after 5s","msg":"query failed","level":"error","user":7}`},
+		{`2025-01-02 15:04:05 GET /orders/1234 200 in 12ms`, `2025-01-03 09:00:00 GET /orders/98 200 in 1.5s`},
+		{`level=info msg="user 42 logged in" ip=10.0.0.1`, `level=info msg="user 7 logged in" ip=10.0.0.2`},
+	} {
+		assert.Equal(t, normalize.Pattern(lines[0]), normalize.Pattern(lines[1]), lines[0])
+	}
+	assert.NotEqual(t, normalize.Pattern(`{"level":"error","msg":"query failed"}`), normalize.Pattern(`{"level":"warn","msg":"query failed"}`))
+}
@@ -0,0 +1,79 @@
+// Package output encodes command results in the machine-readable formats selected with the global --output flag.
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	Text  = "text"
+	JSON  = "json"
+	YAML  = "yaml"
+	JSONL = "jsonl"
+)
+
+// Format is the output format of every command, set by the global --output flag.
+var Format = Text
+
+// Validate checks the value given to --output.
+func Validate() error {
+	switch Format {
+	case Text, JSON, YAML, JSONL:
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, use one of text, json, yaml or jsonl", Format)
+}
+
+// Structured reports whether a machine-readable format was selected instead of human text.
+func Structured() bool {
+	return Format != Text
+}
+
+// Write encodes v in the selected format. With jsonl a slice is written one element per line,
+// any other value as a single line.
+func Write(w io.Writer, v any) error {
+	switch Format {
+	case YAML:
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case JSONL:
+		enc := json.NewEncoder(w)
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return enc.Encode(v)
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if err := enc.Encode(rv.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+}
+
+// Event writes one event of a long running command as soon as it happens: a single line of JSON
+// for json and jsonl, a YAML document for yaml.
+func Event(w io.Writer, v any) error {
+	if Format != YAML {
+		return json.NewEncoder(w).Encode(v)
+	}
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "---\n%s", data)
+	return err
+}
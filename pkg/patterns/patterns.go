@@ -0,0 +1,150 @@
+// Package patterns finds the line patterns the pods of a revision log that the pods of older revisions never logged.
+package patterns
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg/multiline"
+	"github.com/revolyssup/k8sdebug/pkg/normalize"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/revolyssup/k8sdebug/pkg/structured"
+)
+
+// Pattern is a line pattern logged by the pods of a revision that no previous revision logged.
+type Pattern struct {
+	Pattern   string    `json:"pattern"`
+	Severity  string    `json:"severity"`
+	Count     int       `json:"count"`
+	Pods      []string  `json:"pods"`
+	FirstSeen time.Time `json:"firstSeen"`
+	FirstPod  string    `json:"firstPod"`
+	Sample    string    `json:"sample"`
+}
+
+type Result struct {
+	Owner        store.Owner `json:"owner"`
+	Revision     int         `json:"revision"`
+	Pods         []string    `json:"pods"`
+	Baseline     []int       `json:"baselineRevisions"`
+	BaselinePods []string    `json:"baselinePods"`
+	Patterns     []*Pattern  `json:"patterns"`
+}
+
+// severityRank orders errors before warnings before everything else.
+func severityRank(severity string) int {
+	switch severity {
+	case structured.SeverityError:
+		return 0
+	case structured.SeverityWarn:
+		return 1
+	}
+	return 2
+}
+
+// New collects the patterns of the pods of the revision, "latest" for the newest one, that the pods of older
+// revisions never logged. Errors come first, then warnings, then the most frequent patterns.
+func New(s *store.Store, pods []store.Pod, rev string) (*Result, error) {
+	revisions := store.Revisions(pods)
+	if len(revisions) == 0 {
+		return nil, fmt.Errorf("no revisions recorded")
+	}
+	target := revisions[len(revisions)-1]
+	if rev != "latest" {
+		var err error
+		if target, err = strconv.Atoi(rev); err != nil {
+			return nil, fmt.Errorf("invalid revision %s", rev)
+		}
+	}
+	result := &Result{Owner: pods[0].Owner(), Revision: target, Pods: make([]string, 0),
+		Baseline: make([]int, 0), BaselinePods: make([]string, 0), Patterns: make([]*Pattern, 0)}
+	for _, r := range revisions {
+		if r < target {
+			result.Baseline = append(result.Baseline, r)
+		}
+	}
+	if len(result.Baseline) == 0 {
+		return nil, fmt.Errorf("no revision recorded before revision %d", target)
+	}
+
+	seen := make(map[string]bool)
+	for _, pod := range pods {
+		if pod.Revision >= target {
+			continue
+		}
+		result.BaselinePods = append(result.BaselinePods, pod.Name)
+		scan(s, pod, func(pattern string, e multiline.Event) { seen[pattern] = true })
+	}
+	found := make(map[string]*Pattern)
+	for _, pod := range pods {
+		if pod.Revision != target {
+			continue
+		}
+		result.Pods = append(result.Pods, pod.Name)
+		scan(s, pod, func(pattern string, e multiline.Event) {
+			if seen[pattern] {
+				return
+			}
+			p, ok := found[pattern]
+			if !ok {
+				p = &Pattern{Pattern: pattern, Severity: severity(e), Pods: make([]string, 0), Sample: e.Text()}
+				found[pattern] = p
+				result.Patterns = append(result.Patterns, p)
+			}
+			p.Count++
+			if !slices.Contains(p.Pods, pod.Name) {
+				p.Pods = append(p.Pods, pod.Name)
+			}
+			at, ok := structured.Timestamp(e.Lines[0])
+			if !ok {
+				at = pod.Created()
+			}
+			if p.FirstSeen.IsZero() || at.Before(p.FirstSeen) {
+				p.FirstSeen = at
+				p.FirstPod = pod.Name
+			}
+		})
+	}
+	if len(result.Pods) == 0 {
+		return nil, fmt.Errorf("no pods recorded for revision %d", target)
+	}
+	sort.SliceStable(result.Patterns, func(i, j int) bool {
+		a, b := result.Patterns[i], result.Patterns[j]
+		if severityRank(a.Severity) != severityRank(b.Severity) {
+			return severityRank(a.Severity) < severityRank(b.Severity)
+		}
+		return a.Count > b.Count
+	})
+	return result, nil
+}
+
+// scan passes the pattern of every event of the pod to fn. Stack traces are reduced to their kind and header.
+func scan(s *store.Store, pod store.Pod, fn func(string, multiline.Event)) {
+	file, err := s.Open(pod.LogPath)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	scanner := multiline.NewScanner(file)
+	for scanner.Scan() {
+		e := scanner.Event()
+		pattern := normalize.Pattern(e.Lines[0])
+		if e.Kind != multiline.KindLine {
+			pattern = string(e.Kind) + ": " + normalize.Line(e.Header())
+		}
+		fn(pattern, e)
+	}
+}
+
+func severity(e multiline.Event) string {
+	if e.Kind != multiline.KindLine {
+		return structured.SeverityError
+	}
+	if severity := structured.Severity(e.Lines[0]); severity != "" {
+		return severity
+	}
+	return "info"
+}
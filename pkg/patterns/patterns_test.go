@@ -0,0 +1,86 @@
+package patterns_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/revolyssup/k8sdebug/pkg/patterns"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/revolyssup/k8sdebug/pkg/structured"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"deployment.api.metadata": "2025-01-01 10:00:00 ; api-a-1 ; api-a ; 1\n" +
+			"2025-01-01 10:00:00 ; api-a-2 ; api-a ; 1\n" +
+			"2025-01-02 10:00:00 ; api-b-1 ; api-b ; 2\n" +
+			"2025-01-02 10:05:00 ; api-b-2 ; api-b ; 2\n",
+		"api-a-1.log": `2025-01-01T10:00:01Z starting on port 8080
+{"level":"warn","msg":"cache miss","key":"a"}
+`,
+		"api-a-2.log": "2025-01-01T10:00:02Z request took 12ms\n",
+		"api-b-1.log": `2025-01-02T10:00:01Z starting on port 9090
+{"level":"warn","msg":"cache miss","key":"b"}
+2025-01-02T10:00:03Z feature flag enabled
+{"level":"error","msg":"db down","error":"dial tcp 10.0.0.1:5432: refused"}
+java.lang.IllegalStateException: boom
+	at com.x.Foo.bar(Foo.java:12)
+`,
+		"api-b-2.log": `2025-01-02T10:05:01Z request took 2s
+{"level":"warn","msg":"retrying","attempt":2}
+2025-01-02T10:00:02Z feature flag enabled
+`,
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "shop"), 0755))
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(root, "shop", name), []byte(content), 0644))
+	}
+	s := store.New(root)
+	pods, err := s.Pods("shop", "deployment", "api")
+	require.NoError(t, err)
+
+	result, err := patterns.New(s, pods, "latest")
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Revision)
+	assert.Equal(t, []int{1}, result.Baseline)
+	assert.Equal(t, []string{"api-a-1", "api-a-2"}, result.BaselinePods)
+	assert.Equal(t, []string{"api-b-1", "api-b-2"}, result.Pods)
+
+	type summary struct {
+		Pattern, Severity string
+		Count             int
+		Pods              []string
+		FirstPod          string
+	}
+	got := make([]summary, 0, len(result.Patterns))
+	for _, p := range result.Patterns {
+		got = append(got, summary{p.Pattern, p.Severity, p.Count, p.Pods, p.FirstPod})
+	}
+	// The starting, cache miss and request lines only differ from revision 1 in their values.
+	assert.Equal(t, []summary{
+		{"level=error msg=db down error=dial tcp <ip>: refused", structured.SeverityError, 1, []string{"api-b-1"}, "api-b-1"},
+		{"java-exception: java.lang.IllegalStateException: boom", structured.SeverityError, 1, []string{"api-b-1"}, "api-b-1"},
+		{"level=warn msg=retrying", structured.SeverityWarn, 1, []string{"api-b-2"}, "api-b-2"},
+		{"<ts> feature flag enabled", "info", 2, []string{"api-b-1", "api-b-2"}, "api-b-2"},
+	}, got)
+	flag := result.Patterns[3]
+	assert.Equal(t, "2025-01-02T10:00:02Z", flag.FirstSeen.UTC().Format("2006-01-02T15:04:05Z"), "the earliest occurrence across pods")
+	assert.Equal(t, "java.lang.IllegalStateException: boom\n\tat com.x.Foo.bar(Foo.java:12)", result.Patterns[1].Sample)
+
+	explicit, err := patterns.New(s, pods, "2")
+	require.NoError(t, err)
+	assert.Equal(t, result, explicit)
+
+	for rev, msg := range map[string]string{
+		"1":    "no revision recorded before revision 1",
+		"3":    "no pods recorded for revision 3",
+		"prev": "invalid revision prev",
+	} {
+		_, err := patterns.New(s, pods, rev)
+		assert.EqualError(t, err, msg, rev)
+	}
+}
@@ -5,19 +5,24 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"strconv"
 	"sync"
 	"time"
 
 	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/completion"
 	"github.com/revolyssup/k8sdebug/pkg/forwarder"
+	"github.com/revolyssup/k8sdebug/pkg/output"
 	"github.com/revolyssup/k8sdebug/pkg/portforward/mock"
 	"github.com/revolyssup/k8sdebug/pkg/portforward/roundrobin"
 	"github.com/revolyssup/k8sdebug/pkg/portforward/sticky"
+	"github.com/revolyssup/k8sdebug/pkg/workspace"
 	"github.com/spf13/cobra"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -43,6 +48,38 @@ var (
 	indexToStopChan    = make(map[int]chan struct{}) // Track stop channels by index to close previous port forwards
 )
 
+// forwardEvent is printed for every change of the forwarded pods when a machine-readable --output is selected.
+type forwardEvent struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Pod     string    `json:"pod,omitempty"`
+	Address string    `json:"address,omitempty"`
+	Message string    `json:"message,omitempty"`
+}
+
+// Event types of port-forward.
+const (
+	eventListening     = "listening"
+	eventForwarded     = "forwarded"
+	eventForwardFailed = "forward-failed"
+	eventPodAdded      = "pod-added"
+	eventPodDeleted    = "pod-deleted"
+	eventError         = "error"
+	eventStopped       = "stopped"
+)
+
+// emit prints the event with a machine-readable --output and text otherwise.
+func emit(e forwardEvent, text string) {
+	if !output.Structured() {
+		fmt.Print(text)
+		return
+	}
+	e.Time = time.Now()
+	if err := output.Event(os.Stdout, e); err != nil {
+		fmt.Fprintln(os.Stderr, "Error encoding event:", err)
+	}
+}
+
 func forwardToPod(hostConn net.Conn, podCon net.Conn) {
 	//Copy data bidirectionally
 	go io.Copy(hostConn, podCon)
@@ -61,14 +98,21 @@ func getPodConnection(fw forwarder.Forwarder, hostConn net.Conn) (net.Conn, erro
 	return podConn, nil
 }
 
+// forwarders are the policies accepted by --policy.
+var forwarders = map[string]func() forwarder.Forwarder{
+	"round-robin": func() forwarder.Forwarder { return roundrobin.New(&connPool) },
+	"mock":        func() forwarder.Forwarder { return mock.New() },
+	"sticky":      func() forwarder.Forwarder { return sticky.New(&connPool) },
+}
+
+// Policies returns the names of the policies accepted by --policy.
+func Policies() []string {
+	return slices.Sorted(maps.Keys(forwarders))
+}
+
 func getForwarder(policy string) forwarder.Forwarder {
-	switch policy {
-	case "round-robin":
-		return roundrobin.New(&connPool)
-	case "mock":
-		return mock.New()
-	case "sticky":
-		return sticky.New(&connPool)
+	if newForwarder, ok := forwarders[policy]; ok {
+		return newForwarder()
 	}
 	return nil
 }
@@ -107,12 +151,12 @@ func listenAndAccept(ctx context.Context, listener net.Listener, fw forwarder.Fo
 				if errors.Is(err, net.ErrClosed) {
 					return // Prolly exiting
 				}
-				fmt.Printf("Accept error: %v", err)
+				emit(forwardEvent{Type: eventError, Message: fmt.Sprintf("accept error: %v", err)}, fmt.Sprintf("Accept error: %v", err))
 				continue
 			}
 			podConn, err := getPodConnection(fw, hostConn)
 			if err != nil {
-				fmt.Printf("Pod connection error: %v", err)
+				emit(forwardEvent{Type: eventError, Message: fmt.Sprintf("pod connection error: %v", err)}, fmt.Sprintf("Pod connection error: %v", err))
 				continue
 			}
 			forwardToPod(hostConn, podConn)
@@ -126,7 +170,7 @@ func NewCommand() *cobra.Command {
 		Run: func(cmd *cobra.Command, args []string) {
 			fw := getForwarder(policy)
 			if fw == nil {
-				fmt.Errorf("invalid policy for forwarding traffic\n")
+				cmd.Println(pkg.ColorLine(fmt.Sprintf("invalid policy for forwarding traffic: %s", policy), pkg.ColorRed))
 				return
 			}
 			listener, err := net.Listen("tcp", fmt.Sprintf(":%s", hostport))
@@ -154,7 +198,8 @@ func NewCommand() *cobra.Command {
 			pods := initialList.Items
 			connPool = make([]string, len(pods))                 // This maintains list of available addresses that be used to forward traffic
 			podNameToPoolIndex = make(map[string]int, len(pods)) // This is used to free the connpool when pod is terminated
-			fmt.Printf(pkg.ColorLine(fmt.Sprintf("listening on %s using %s policy across %d pods\n", hostport, policy, len(pods)), pkg.ColorGreen))
+			listening := fmt.Sprintf("listening on %s using %s policy across %d pods", hostport, policy, len(pods))
+			emit(forwardEvent{Type: eventListening, Address: ":" + hostport, Message: listening}, pkg.ColorLine(listening+"\n", pkg.ColorGreen))
 
 			startPortForward := func(iConnPool int, pod v1.Pod) (string, error) {
 				if iConnPool == fromWatch {
@@ -183,7 +228,11 @@ func NewCommand() *cobra.Command {
 				hostPortStr := fmt.Sprintf("%s:%s", strconv.Itoa(hostPort), containerPort)
 				connPool[iConnPool] = strconv.Itoa(hostPort)
 				podNameToPoolIndex[pod.Name] = iConnPool
-				forwarder, err := portforward.New(dialer, []string{hostPortStr}, stopChan, readyChan, os.Stdout, os.Stderr)
+				var out io.Writer = os.Stdout
+				if output.Structured() {
+					out = io.Discard
+				}
+				forwarder, err := portforward.New(dialer, []string{hostPortStr}, stopChan, readyChan, out, os.Stderr)
 				if err != nil {
 					connPool[iConnPool] = "" // Reset connPool entry
 					addFreeIndex(iConnPool)  // Return index to freeList
@@ -191,18 +240,25 @@ func NewCommand() *cobra.Command {
 				}
 				go func() {
 					if err := forwarder.ForwardPorts(); err != nil {
-						fmt.Println("coud not forward connection for pod", pod.Name)
+						emit(forwardEvent{Type: eventForwardFailed, Pod: pod.Name, Message: err.Error()}, fmt.Sprintln("coud not forward connection for pod", pod.Name))
 					}
 				}()
 				return hostPortStr, nil
 			}
 			for i, pod := range pods {
-				startPortForward(i, pod)
+				addr, err := startPortForward(i, pod)
+				if err != nil {
+					emit(forwardEvent{Type: eventForwardFailed, Pod: pod.Name, Message: err.Error()}, fmt.Sprintf("could not create port forward for %s\n", pod.Name))
+					continue
+				}
+				if output.Structured() {
+					emit(forwardEvent{Type: eventForwarded, Pod: pod.Name, Address: addr}, "")
+				}
 			}
 			opts.ResourceVersion = initialList.ResourceVersion
 			watcher, err := cs.CoreV1().Pods(namespace).Watch(ctx, opts)
 			if err != nil {
-				fmt.Println("could not create a watcher for pods")
+				emit(forwardEvent{Type: eventError, Message: "could not create a watcher for pods"}, "could not create a watcher for pods\n")
 				return
 			}
 			var wg sync.WaitGroup
@@ -214,15 +270,15 @@ func NewCommand() *cobra.Command {
 						if pod == nil {
 							continue
 						}
-						fmt.Printf("new pod recieved: %s. will try to create portforward\n", pod.Name)
+						emit(forwardEvent{Type: eventPodAdded, Pod: pod.Name}, fmt.Sprintf("new pod recieved: %s. will try to create portforward\n", pod.Name))
 						//TODO: find a better way
 						time.Sleep(2 * time.Second) //Wait for pod to start
 						addr, err := startPortForward(fromWatch, *pod)
 						if err != nil {
-							fmt.Printf("could not create port forward for %s\n", pod.Name)
+							emit(forwardEvent{Type: eventForwardFailed, Pod: pod.Name, Message: err.Error()}, fmt.Sprintf("could not create port forward for %s\n", pod.Name))
 							continue
 						}
-						fmt.Println(pkg.ColorLine(fmt.Sprintf("New port forward created for pod %s on %s", pod.Name, addr), pkg.ColorGreen))
+						emit(forwardEvent{Type: eventForwarded, Pod: pod.Name, Address: addr}, fmt.Sprintln(pkg.ColorLine(fmt.Sprintf("New port forward created for pod %s on %s", pod.Name, addr), pkg.ColorGreen)))
 					case watch.Deleted:
 						pod := event.Object.(*v1.Pod)
 						i := podNameToPoolIndex[pod.Name]
@@ -231,7 +287,7 @@ func NewCommand() *cobra.Command {
 							delete(indexToStopChan, i)
 						}
 						addFreeIndex(i)
-						fmt.Println(pkg.ColorLine("New freelist: ", pkg.ColorYellow), freeList)
+						emit(forwardEvent{Type: eventPodDeleted, Pod: pod.Name}, fmt.Sprintln(pkg.ColorLine("New freelist: ", pkg.ColorYellow), freeList))
 					}
 				}
 			}()
@@ -244,7 +300,7 @@ func NewCommand() *cobra.Command {
 				wg.Done()
 			}()
 			wg.Wait()
-			fmt.Println("Stopping watcher...")
+			emit(forwardEvent{Type: eventStopped}, "Stopping watcher...\n")
 		},
 	}
 
@@ -258,5 +314,12 @@ sticky: In this mode, requests from a particular source IP will always be direct
 	cmd.Flags().StringVarP(&labels, "labels", "l", "", "list of key value pairs to use as labels while filtering pods.")
 	cmd.Flags().StringVar(&hostport, "hostport", "3000", "host port on which requests will be sent")
 	cmd.Flags().StringVar(&containerPort, "containerport", "80", "container port on which requests will be sent")
+	cmd.RegisterFlagCompletionFunc("namespace", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completion.Values(completion.New(workspace.Current()).Namespaces(), toComplete)
+	})
+	cmd.RegisterFlagCompletionFunc("type", completion.Fixed(completion.Kinds...))
+	cmd.RegisterFlagCompletionFunc("policy", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completion.Values(Policies(), toComplete)
+	})
 	return cmd
 }
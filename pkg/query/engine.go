@@ -0,0 +1,322 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/revolyssup/k8sdebug/pkg/structured"
+	"github.com/revolyssup/k8sdebug/pkg/tail"
+)
+
+// Line is a log line that made it through the pipeline.
+type Line struct {
+	Namespace string             `json:"namespace"`
+	Owner     string             `json:"owner"`
+	Pod       string             `json:"pod"`
+	Line      string             `json:"line"`
+	Fields    []structured.Field `json:"fields,omitempty"`
+}
+
+// Sample is the aggregated value of one group.
+type Sample struct {
+	Labels map[string]string `json:"labels"`
+	Value  float64           `json:"value"`
+}
+
+// Result holds Lines for plain queries and Samples for queries ending with an aggregation.
+type Result struct {
+	Lines     []Line   `json:"lines,omitempty"`
+	Samples   []Sample `json:"samples,omitempty"`
+	Aggregate bool     `json:"aggregate"`
+	// Scanned is the number of pods whose logs were read.
+	Scanned int `json:"scanned"`
+	// Errors lists the pods whose logs could not be read completely, the result leaves out their unread lines.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// entry is the state of a line while it flows through the pipeline.
+type entry struct {
+	pod  store.Pod
+	line string
+	rec  *structured.Record
+}
+
+// record returns the parsed fields of the line, detecting the format if no parser stage ran.
+func (e *entry) record() structured.Record {
+	if e.rec == nil {
+		rec := structured.Parse(e.line)
+		e.rec = &rec
+	}
+	return *e.rec
+}
+
+// label returns the value of a selector label or of a parsed field.
+func (e *entry) label(name string) string {
+	switch name {
+	case "ns", "namespace":
+		return e.pod.Namespace
+	case "owner":
+		return e.pod.Owner().String()
+	case "kind":
+		return e.pod.OwnerKind
+	case "name":
+		return e.pod.OwnerName
+	case "pod":
+		return e.pod.Name
+	case "revision":
+		return strconv.Itoa(e.pod.Revision)
+	}
+	v, _ := e.record().Get(name)
+	return v
+}
+
+type lineFilter struct {
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+func (f *lineFilter) apply(e *entry) bool {
+	switch f.op {
+	case "|=":
+		return strings.Contains(e.line, f.value)
+	case "!=":
+		return !strings.Contains(e.line, f.value)
+	case "|~":
+		return f.re.MatchString(e.line)
+	case "!~":
+		return !f.re.MatchString(e.line)
+	}
+	return false
+}
+
+// parserStage keeps only the lines in the given format and makes their fields available.
+type parserStage struct {
+	format structured.Format
+}
+
+func (s *parserStage) apply(e *entry) bool {
+	return e.record().Format == s.format
+}
+
+type fieldFilter struct {
+	condition structured.Condition
+}
+
+func (f *fieldFilter) apply(e *entry) bool {
+	return f.condition.Match(e.record())
+}
+
+// fieldsStage replaces the line with the selected fields in logfmt.
+type fieldsStage struct {
+	names []string
+}
+
+func (s *fieldsStage) apply(e *entry) bool {
+	rec := e.record().Project(s.names)
+	if len(rec.Fields) == 0 {
+		return false
+	}
+	e.rec = &rec
+	e.line = rec.Logfmt()
+	return true
+}
+
+// Exec runs the query over the store. Pods are read namespace by namespace in alphabetical order and
+// by creation time within a namespace, and a limit on lines keeps the first lines in that order.
+func Exec(s *store.Store, q *Query) (*Result, error) {
+	pods, err := selectPods(s, q.Selector)
+	if err != nil {
+		return nil, err
+	}
+	res := &Result{Aggregate: q.Aggregation != nil, Lines: make([]Line, 0)}
+	groups := make(map[string]*group)
+	for _, pod := range pods {
+		done, err := scanPod(s, pod, q, func(e *entry) bool {
+			if q.Aggregation != nil {
+				addToGroup(groups, q.Aggregation, e)
+				return true
+			}
+			res.Lines = append(res.Lines, Line{
+				Namespace: e.pod.Namespace,
+				Owner:     e.pod.Owner().String(),
+				Pod:       e.pod.Name,
+				Line:      e.line,
+				Fields:    fieldsOf(e),
+			})
+			return q.Limit == 0 || len(res.Lines) < q.Limit
+		})
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // The log may have been removed since the pods were listed.
+		}
+		if err != nil {
+			res.Errors = append(res.Errors, fmt.Sprintf("%s/%s: %v", pod.Namespace, pod.Name, err))
+			continue
+		}
+		res.Scanned++
+		if done {
+			break
+		}
+	}
+	if q.Aggregation != nil {
+		res.Lines = nil
+		res.Samples = samples(groups, q.Aggregation, q.Limit)
+	}
+	return res, nil
+}
+
+func fieldsOf(e *entry) []structured.Field {
+	if e.rec == nil {
+		return nil
+	}
+	return e.rec.Fields
+}
+
+// scanPod feeds every line of the pod through the pipeline and calls emit for the lines that pass.
+// It reports whether emit asked to stop.
+func scanPod(s *store.Store, pod store.Pod, q *Query, emit func(*entry) bool) (bool, error) {
+	file, err := s.Open(pod.LogPath)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	buf := tail.NewScanner(file)
+	for buf.Scan() {
+		e := &entry{pod: pod, line: buf.Text()}
+		keep := true
+		for _, stage := range q.Stages {
+			if !stage.apply(e) {
+				keep = false
+				break
+			}
+		}
+		if keep && !emit(e) {
+			return true, nil
+		}
+	}
+	return false, buf.Err()
+}
+
+// selectPods returns the recorded pods matching every matcher of the selector.
+func selectPods(s *store.Store, selector []Matcher) ([]store.Pod, error) {
+	namespaces, err := s.Namespaces()
+	if err != nil {
+		return nil, err
+	}
+	pods := make([]store.Pod, 0)
+	for _, ns := range namespaces {
+		if !matches(selector, "ns", ns) {
+			continue
+		}
+		nsPods, err := s.AllPods(ns)
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range nsPods {
+			e := &entry{pod: pod}
+			keep := true
+			for _, m := range selector {
+				if !m.Match(e.label(m.Label)) {
+					keep = false
+					break
+				}
+			}
+			if keep {
+				pods = append(pods, pod)
+			}
+		}
+	}
+	return pods, nil
+}
+
+func matches(selector []Matcher, label, value string) bool {
+	for _, m := range selector {
+		if m.Label == label && !m.Match(value) {
+			return false
+		}
+	}
+	return true
+}
+
+type group struct {
+	labels map[string]string
+	count  int
+	sum    float64
+	min    float64
+	max    float64
+}
+
+func addToGroup(groups map[string]*group, agg *Aggregation, e *entry) {
+	value := 1.0
+	if agg.Func != "count" {
+		v, ok := e.record().Get(agg.Field)
+		if !ok {
+			return
+		}
+		var err error
+		if value, err = strconv.ParseFloat(v, 64); err != nil {
+			return
+		}
+	}
+	labels := make(map[string]string, len(agg.By))
+	keyParts := make([]string, 0, len(agg.By))
+	for _, by := range agg.By {
+		labels[by] = e.label(by)
+		keyParts = append(keyParts, by+"="+labels[by])
+	}
+	key := strings.Join(keyParts, ",")
+	g, ok := groups[key]
+	if !ok {
+		g = &group{labels: labels, min: value, max: value}
+		groups[key] = g
+	}
+	g.count++
+	g.sum += value
+	g.min = min(g.min, value)
+	g.max = max(g.max, value)
+}
+
+// samples computes the value of every group, sorted by descending value.
+func samples(groups map[string]*group, agg *Aggregation, limit int) []Sample {
+	result := make([]Sample, 0, len(groups))
+	for _, g := range groups {
+		s := Sample{Labels: g.labels}
+		switch agg.Func {
+		case "count":
+			s.Value = float64(g.count)
+		case "sum":
+			s.Value = g.sum
+		case "avg":
+			s.Value = g.sum / float64(g.count)
+		case "min":
+			s.Value = g.min
+		case "max":
+			s.Value = g.max
+		}
+		result = append(result, s)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Value != result[j].Value {
+			return result[i].Value > result[j].Value
+		}
+		return labelString(result[i].Labels, agg.By) < labelString(result[j].Labels, agg.By)
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+func labelString(labels map[string]string, order []string) string {
+	parts := make([]string, 0, len(order))
+	for _, k := range order {
+		parts = append(parts, k+"="+labels[k])
+	}
+	return strings.Join(parts, ",")
+}
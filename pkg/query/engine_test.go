@@ -0,0 +1,152 @@
+package query_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/revolyssup/k8sdebug/pkg/query"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/revolyssup/k8sdebug/pkg/structured"
+	"github.com/revolyssup/k8sdebug/pkg/tail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newStore(t *testing.T) *store.Store {
+	root := t.TempDir()
+	files := map[string]string{
+		"shop/deployment.api.metadata": "2025-01-01 10:00:00 ; api-1 ; api-5d4 ; 1\n2025-01-02 10:00:00 ; api-2 ; api-6e5 ; 2\n",
+		"shop/api-1.log": `{"level":"info","msg":"request","latency_ms":100}
+{"level":"error","msg":"timeout","latency_ms":900}
+plain timeout line
+`,
+		"shop/api-2.log": `{"level":"info","msg":"request","latency_ms":300}
+{"level":"info","msg":"request","latency_ms":700}
+level=warn msg="slow request" latency_ms=600
+`,
+		"shop/worker-0.log": "worker timeout\n",
+		"other/db-0.log":    "db timeout\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return store.New(root)
+}
+
+func exec(t *testing.T, s *store.Store, input string) *query.Result {
+	q, err := query.Parse(input)
+	require.NoError(t, err, input)
+	res, err := query.Exec(s, q)
+	require.NoError(t, err, input)
+	return res
+}
+
+// lines returns "pod: line" for every line of the result.
+func lines(res *query.Result) []string {
+	out := make([]string, 0, len(res.Lines))
+	for _, l := range res.Lines {
+		out = append(out, l.Pod+": "+l.Line)
+	}
+	return out
+}
+
+func TestExecLines(t *testing.T) {
+	s := newStore(t)
+	for _, tc := range []struct {
+		query   string
+		scanned int
+		want    []string
+	}{
+		{`{ns="shop", owner="deployment/api"} |= "timeout"`, 2, []string{
+			`api-1: {"level":"error","msg":"timeout","latency_ms":900}`,
+			"api-1: plain timeout line",
+		}},
+		{`{pod=~"api-.*|db-.*"} |~ "time(out)?" != "plain"`, 3, []string{
+			"db-0: db timeout",
+			`api-1: {"level":"error","msg":"timeout","latency_ms":900}`,
+		}},
+		{`{kind="pod"} !~ "db.*"`, 2, []string{"worker-0: worker timeout"}},
+		{`{revision="2"} | json | latency_ms > 500`, 1, []string{
+			`api-2: {"level":"info","msg":"request","latency_ms":700}`,
+		}},
+		{`{owner="deployment/api"} | logfmt`, 2, []string{
+			`api-2: level=warn msg="slow request" latency_ms=600`,
+		}},
+		{`{owner="deployment/api"} | latency_ms >= 600 | fields msg, latency_ms`, 2, []string{
+			"api-1: msg=timeout latency_ms=900",
+			"api-2: msg=request latency_ms=700",
+			`api-2: msg="slow request" latency_ms=600`,
+		}},
+		// The limit applies to all the pods together, api-2 is not read.
+		{`{owner="deployment/api"} | limit 2`, 1, []string{
+			`api-1: {"level":"info","msg":"request","latency_ms":100}`,
+			`api-1: {"level":"error","msg":"timeout","latency_ms":900}`,
+		}},
+		{`{ns="missing"}`, 0, []string{}},
+	} {
+		res := exec(t, s, tc.query)
+		assert.False(t, res.Aggregate, tc.query)
+		assert.Equal(t, tc.scanned, res.Scanned, tc.query)
+		assert.Equal(t, tc.want, lines(res), tc.query)
+	}
+
+	res := exec(t, s, `{pod="api-1"} | json | level="error"`)
+	assert.Empty(t, res.Errors)
+	require.Len(t, res.Lines, 1)
+	assert.Equal(t, "shop", res.Lines[0].Namespace)
+	assert.Equal(t, "deployment/api", res.Lines[0].Owner)
+	assert.Contains(t, res.Lines[0].Fields, structured.Field{Key: "msg", Value: "timeout"}, "the parsed fields are returned")
+}
+
+func TestExecAggregations(t *testing.T) {
+	s := newStore(t)
+	for _, tc := range []struct {
+		query string
+		want  []query.Sample
+	}{
+		{`|= "timeout" | count by ns`, []query.Sample{
+			{Labels: map[string]string{"ns": "shop"}, Value: 3},
+			{Labels: map[string]string{"ns": "other"}, Value: 1},
+		}},
+		{`{owner="deployment/api"} | count by revision`, []query.Sample{
+			{Labels: map[string]string{"revision": "1"}, Value: 3},
+			{Labels: map[string]string{"revision": "2"}, Value: 3},
+		}},
+		{`{owner="deployment/api"} | avg latency_ms by pod`, []query.Sample{
+			{Labels: map[string]string{"pod": "api-2"}, Value: 1600.0 / 3},
+			{Labels: map[string]string{"pod": "api-1"}, Value: 500},
+		}},
+		{`{owner="deployment/api"} | sum latency_ms by level`, []query.Sample{
+			{Labels: map[string]string{"level": "info"}, Value: 1100},
+			{Labels: map[string]string{"level": "error"}, Value: 900},
+			{Labels: map[string]string{"level": "warn"}, Value: 600},
+		}},
+		{`{owner="deployment/api"} | json | limit 1 | max latency_ms by pod`, []query.Sample{
+			{Labels: map[string]string{"pod": "api-1"}, Value: 900},
+		}},
+		{`{owner="deployment/api"} | min latency_ms`, []query.Sample{
+			{Labels: map[string]string{}, Value: 100},
+		}},
+	} {
+		res := exec(t, s, tc.query)
+		assert.True(t, res.Aggregate, tc.query)
+		assert.Empty(t, res.Lines, tc.query)
+		assert.Equal(t, tc.want, res.Samples, tc.query)
+	}
+}
+
+func TestExecReportsUnreadablePods(t *testing.T) {
+	s := newStore(t)
+	long := strings.Repeat("x", tail.MaxLineSize+1)
+	require.NoError(t, os.WriteFile(s.LogPath("shop", "worker-0"), []byte("worker timeout\n"+long+"\n"), 0644))
+
+	res := exec(t, s, `{ns="shop"} |= "timeout" | count by pod`)
+	assert.Equal(t, 2, res.Scanned)
+	require.Len(t, res.Errors, 1)
+	assert.Contains(t, res.Errors[0], "shop/worker-0")
+	assert.Contains(t, res.Errors[0], "too long")
+}
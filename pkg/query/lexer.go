@@ -0,0 +1,150 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp   // = != =~ !~ == > >= < <= |= |~
+	tokPipe // |
+	tokLBrace
+	tokRBrace
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of query"
+	}
+	return strconv.Quote(t.text)
+}
+
+// Two character operators come first so that they win over their one character prefixes.
+var opTokens = []string{"|=", "|~", "!=", "!~", "=~", "==", ">=", "<=", "=", ">", "<"}
+
+func lex(input string) ([]token, error) {
+	tokens := make([]token, 0)
+	i := 0
+	for i < len(input) {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+			continue
+		case c == '{':
+			tokens = append(tokens, token{tokLBrace, "{", i})
+			i++
+			continue
+		case c == '}':
+			tokens = append(tokens, token{tokRBrace, "}", i})
+			i++
+			continue
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+			continue
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+			continue
+		case c == ',':
+			tokens = append(tokens, token{tokComma, ",", i})
+			i++
+			continue
+		case c == '"' || c == '`':
+			s, n, err := lexString(input[i:])
+			if err != nil {
+				return nil, fmt.Errorf("at position %d: %w", i, err)
+			}
+			tokens = append(tokens, token{tokString, s, i})
+			i += n
+			continue
+		}
+		if op := matchOp(input[i:]); op != "" {
+			tokens = append(tokens, token{tokOp, op, i})
+			i += len(op)
+			continue
+		}
+		if c == '|' {
+			tokens = append(tokens, token{tokPipe, "|", i})
+			i++
+			continue
+		}
+		if c == '-' || c == '.' || unicode.IsDigit(rune(c)) {
+			start := i
+			i++
+			for i < len(input) && (input[i] == '.' || unicode.IsDigit(rune(input[i]))) {
+				i++
+			}
+			if _, err := strconv.ParseFloat(input[start:i], 64); err != nil {
+				return nil, fmt.Errorf("at position %d: invalid number %q", start, input[start:i])
+			}
+			tokens = append(tokens, token{tokNumber, input[start:i], start})
+			continue
+		}
+		if isIdentChar(c) {
+			start := i
+			for i < len(input) && (isIdentChar(input[i]) || input[i] == '.' || input[i] == '-') {
+				i++
+			}
+			tokens = append(tokens, token{tokIdent, input[start:i], start})
+			continue
+		}
+		return nil, fmt.Errorf("at position %d: unexpected character %q", i, c)
+	}
+	tokens = append(tokens, token{tokEOF, "", len(input)})
+	return tokens, nil
+}
+
+func matchOp(s string) string {
+	for _, op := range opTokens {
+		if strings.HasPrefix(s, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+}
+
+// lexString reads a double quoted string with Go escapes or a raw backtick string.
+// It returns the unquoted value and the number of bytes consumed.
+func lexString(s string) (string, int, error) {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		if s[i] == '\\' && quote == '"' {
+			i++
+			continue
+		}
+		if s[i] == quote {
+			if quote == '`' {
+				return s[1:i], i + 1, nil
+			}
+			v, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid string %s", s[:i+1])
+			}
+			return v, i + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
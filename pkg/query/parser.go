@@ -0,0 +1,299 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/revolyssup/k8sdebug/pkg/structured"
+)
+
+// Query is a parsed query of the form
+//
+//	{ns="shop", owner="deployment/api"} |= "timeout" | json | latency_ms > 500 | count by pod
+//
+// A selector chooses the pods, a pipeline of stages filters and parses their lines and an
+// optional final aggregation turns the lines into grouped values.
+type Query struct {
+	Selector    []Matcher
+	Stages      []Stage
+	Aggregation *Aggregation
+	// Limit is the maximum number of lines or groups returned, 0 means no limit. Lines are limited
+	// across all the selected pods, see Exec for the order they are read in.
+	Limit int
+}
+
+// Matcher selects pods on one of the labels ns, owner (kind/name), kind, name, pod and revision.
+type Matcher struct {
+	Label string
+	Op    string
+	Value string
+	re    *regexp.Regexp
+}
+
+func (m Matcher) Match(value string) bool {
+	switch m.Op {
+	case "=":
+		return value == m.Value
+	case "!=":
+		return value != m.Value
+	case "=~":
+		return m.re.MatchString(value)
+	case "!~":
+		return !m.re.MatchString(value)
+	}
+	return false
+}
+
+// Stage is a step of the pipeline. It returns false to drop the entry.
+type Stage interface {
+	apply(e *entry) bool
+}
+
+// Aggregation turns the remaining lines into one value per group.
+type Aggregation struct {
+	Func  string // count, sum, avg, min or max
+	Field string // field aggregated by sum, avg, min and max
+	By    []string
+}
+
+var selectorLabels = map[string]bool{"ns": true, "owner": true, "kind": true, "name": true, "pod": true, "revision": true}
+
+var aggregationFuncs = map[string]bool{"count": true, "sum": true, "avg": true, "min": true, "max": true}
+
+type parser struct {
+	tokens []token
+	pos    int
+	limit  int
+}
+
+// Parse parses a query string.
+func Parse(input string) (*Query, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	q, err := p.parseQuery()
+	if err != nil {
+		return nil, err
+	}
+	q.Limit = p.limit
+	return q, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, fmt.Errorf("expected %s at position %d, got %s", what, t.pos, t)
+	}
+	return t, nil
+}
+
+func (p *parser) parseQuery() (*Query, error) {
+	q := &Query{}
+	if p.peek().kind == tokLBrace {
+		selector, err := p.parseSelector()
+		if err != nil {
+			return nil, err
+		}
+		q.Selector = selector
+	}
+	for p.peek().kind != tokEOF {
+		if q.Aggregation != nil {
+			return nil, fmt.Errorf("%s must be the last stage of the query", q.Aggregation.Func)
+		}
+		t := p.next()
+		switch {
+		case t.kind == tokOp && (t.text == "|=" || t.text == "!=" || t.text == "|~" || t.text == "!~"):
+			s, err := p.expect(tokString, "a string after "+t.text)
+			if err != nil {
+				return nil, err
+			}
+			f, err := newLineFilter(t.text, s.text)
+			if err != nil {
+				return nil, err
+			}
+			q.Stages = append(q.Stages, f)
+		case t.kind == tokPipe:
+			stage, agg, err := p.parsePipeStage()
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case agg != nil:
+				q.Aggregation = agg
+			case stage == nil:
+			default:
+				q.Stages = append(q.Stages, stage)
+			}
+		default:
+			return nil, fmt.Errorf("expected a pipeline stage at position %d, got %s", t.pos, t)
+		}
+	}
+	return q, nil
+}
+
+func (p *parser) parseSelector() ([]Matcher, error) {
+	p.next() // {
+	matchers := make([]Matcher, 0)
+	for {
+		if p.peek().kind == tokRBrace {
+			p.next()
+			return matchers, nil
+		}
+		label, err := p.expect(tokIdent, "a label")
+		if err != nil {
+			return nil, err
+		}
+		if !selectorLabels[label.text] {
+			return nil, fmt.Errorf("unknown label %s in selector, supported labels are ns, owner, kind, name, pod and revision", label.text)
+		}
+		op, err := p.expect(tokOp, "an operator")
+		if err != nil {
+			return nil, err
+		}
+		value, err := p.expect(tokString, "a quoted value")
+		if err != nil {
+			return nil, err
+		}
+		m := Matcher{Label: label.text, Op: op.text, Value: value.text}
+		switch op.text {
+		case "=", "!=":
+		case "=~", "!~":
+			if m.re, err = regexp.Compile("^(?:" + value.text + ")$"); err != nil {
+				return nil, fmt.Errorf("invalid regular expression for %s: %w", label.text, err)
+			}
+		default:
+			return nil, fmt.Errorf("operator %s is not supported in selectors", op.text)
+		}
+		matchers = append(matchers, m)
+		switch t := p.next(); t.kind {
+		case tokComma:
+		case tokRBrace:
+			return matchers, nil
+		default:
+			return nil, fmt.Errorf("expected , or } at position %d, got %s", t.pos, t)
+		}
+	}
+}
+
+func (p *parser) parsePipeStage() (Stage, *Aggregation, error) {
+	t, err := p.expect(tokIdent, "a stage after |")
+	if err != nil {
+		return nil, nil, err
+	}
+	// A keyword followed by an operator is a field filter on a field with the same name.
+	if p.peek().kind == tokOp {
+		stage, err := p.parseFieldFilter(t.text)
+		return stage, nil, err
+	}
+	switch {
+	case t.text == "json":
+		return &parserStage{format: structured.FormatJSON}, nil, nil
+	case t.text == "logfmt":
+		return &parserStage{format: structured.FormatLogfmt}, nil, nil
+	case t.text == "fields":
+		names, err := p.parseIdentList()
+		if err != nil {
+			return nil, nil, err
+		}
+		return &fieldsStage{names: names}, nil, nil
+	case t.text == "limit":
+		n, err := p.expect(tokNumber, "a number after limit")
+		if err != nil {
+			return nil, nil, err
+		}
+		if p.limit, err = strconv.Atoi(n.text); err != nil || p.limit <= 0 {
+			return nil, nil, fmt.Errorf("limit must be a positive integer")
+		}
+		return nil, nil, nil
+	case aggregationFuncs[t.text]:
+		agg := &Aggregation{Func: t.text}
+		if t.text != "count" {
+			field, err := p.expect(tokIdent, "a field to "+t.text)
+			if err != nil {
+				return nil, nil, err
+			}
+			agg.Field = field.text
+		}
+		if p.peek().kind == tokIdent && p.peek().text == "by" {
+			p.next()
+			if agg.By, err = p.parseIdentList(); err != nil {
+				return nil, nil, err
+			}
+		}
+		return nil, agg, nil
+	}
+	return nil, nil, fmt.Errorf("unknown stage %s at position %d", t.text, t.pos)
+}
+
+// parseIdentList parses "a, b, c" or "(a, b, c)".
+func (p *parser) parseIdentList() ([]string, error) {
+	paren := p.peek().kind == tokLParen
+	if paren {
+		p.next()
+	}
+	names := make([]string, 0)
+	for {
+		t, err := p.expect(tokIdent, "a field name")
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, t.text)
+		if p.peek().kind != tokComma {
+			break
+		}
+		p.next()
+	}
+	if paren {
+		if _, err := p.expect(tokRParen, ")"); err != nil {
+			return nil, err
+		}
+	}
+	return names, nil
+}
+
+func (p *parser) parseFieldFilter(field string) (Stage, error) {
+	op := p.next()
+	switch op.text {
+	case "|=", "|~":
+		return nil, fmt.Errorf("operator %s cannot be used on field %s", op.text, field)
+	}
+	value := p.next()
+	switch value.kind {
+	case tokString, tokNumber, tokIdent:
+	default:
+		return nil, fmt.Errorf("expected a value after %s%s at position %d, got %s", field, op.text, value.pos, value)
+	}
+	c, err := structured.NewCondition(field, op.text, value.text)
+	if err != nil {
+		return nil, err
+	}
+	return &fieldFilter{condition: c}, nil
+}
+
+func newLineFilter(op, value string) (Stage, error) {
+	f := &lineFilter{op: op, value: value}
+	if strings.HasSuffix(op, "~") {
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %w", value, err)
+		}
+		f.re = re
+	}
+	return f, nil
+}
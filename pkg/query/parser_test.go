@@ -0,0 +1,42 @@
+package query_test
+
+import (
+	"testing"
+
+	"github.com/revolyssup/k8sdebug/pkg/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	q, err := query.Parse(`{ns="shop", owner="deployment/api"} |= "timeout" | json | latency_ms > 500 | limit 10 | count by pod`)
+	require.NoError(t, err)
+	require.Len(t, q.Selector, 2)
+	assert.Equal(t, "owner", q.Selector[1].Label)
+	assert.Equal(t, "deployment/api", q.Selector[1].Value)
+	assert.Len(t, q.Stages, 3)
+	assert.Equal(t, 10, q.Limit)
+	require.NotNil(t, q.Aggregation)
+	assert.Equal(t, &query.Aggregation{Func: "count", By: []string{"pod"}}, q.Aggregation)
+
+	q, err = query.Parse(`| logfmt | avg latency_ms by (pod, level)`)
+	require.NoError(t, err)
+	assert.Empty(t, q.Selector)
+	assert.Equal(t, &query.Aggregation{Func: "avg", Field: "latency_ms", By: []string{"pod", "level"}}, q.Aggregation)
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, input := range []string{
+		`{foo="bar"}`,
+		`{ns>"shop"}`,
+		`|= timeout`,
+		`| count | json`,
+		`| latency_ms > fast`,
+		`|~ "("`,
+		`{ns="shop"`,
+		`| unknown`,
+	} {
+		_, err := query.Parse(input)
+		assert.Error(t, err, input)
+	}
+}
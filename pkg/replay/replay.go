@@ -0,0 +1,154 @@
+// Package replay re-emits recorded log lines with their original relative timing, optionally accelerated,
+// to test log parsers, alert rules and dashboards against real incidents.
+package replay
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg/structured"
+	"github.com/revolyssup/k8sdebug/pkg/tail"
+)
+
+// Line is a recorded line with the pod it was logged by.
+type Line struct {
+	Time      time.Time `json:"time"`
+	Namespace string    `json:"namespace"`
+	Pod       string    `json:"pod"`
+	Container string    `json:"container,omitempty"`
+	Owner     string    `json:"owner,omitempty"`
+	Line      string    `json:"line"`
+}
+
+// Stream reads the lines of a pod log. Lines without a timestamp get the one of the previous line,
+// starting at the time given to NewStream.
+type Stream struct {
+	scanner *bufio.Scanner
+	line    Line
+	since   time.Time
+	until   time.Time
+}
+
+// NewStream reads the log r of the pod described by template. since and until, when set, drop the lines outside of them.
+func NewStream(r io.Reader, template Line, start, since, until time.Time) *Stream {
+	template.Time = start
+	return &Stream{scanner: tail.NewScanner(r), line: template, since: since, until: until}
+}
+
+// Next returns the next line of the log, or false at its end.
+func (s *Stream) Next() (Line, bool) {
+	for s.scanner.Scan() {
+		s.line.Line = s.scanner.Text()
+		if t, ok := structured.Timestamp(s.line.Line); ok {
+			s.line.Time = t
+		}
+		if !s.since.IsZero() && s.line.Time.Before(s.since) {
+			continue
+		}
+		if !s.until.IsZero() && s.line.Time.After(s.until) {
+			return Line{}, false
+		}
+		return s.line, true
+	}
+	return Line{}, false
+}
+
+func (s *Stream) Err() error {
+	return s.scanner.Err()
+}
+
+// merge returns the lines of the streams in time order. Lines with the same time keep the order of the streams.
+func merge(streams []*Stream) func() (Line, bool) {
+	heads := make([]Line, len(streams))
+	ok := make([]bool, len(streams))
+	for i, s := range streams {
+		heads[i], ok[i] = s.Next()
+	}
+	return func() (Line, bool) {
+		next := -1
+		for i := range streams {
+			if ok[i] && (next < 0 || heads[i].Time.Before(heads[next].Time)) {
+				next = i
+			}
+		}
+		if next < 0 {
+			return Line{}, false
+		}
+		line := heads[next]
+		heads[next], ok[next] = streams[next].Next()
+		return line, true
+	}
+}
+
+// Player sends lines with the time between them divided by Speed.
+type Player struct {
+	// Speed 0 sends the lines without waiting.
+	Speed float64
+	// MaxGap, when positive, caps every wait, so that idle periods of the recording do not stall the replay.
+	MaxGap time.Duration
+	// Sleep waits, it defaults to time.Sleep.
+	Sleep func(time.Duration)
+}
+
+// Play sends the lines of the streams. With interleave the lines of all the streams are merged in time order,
+// otherwise the streams are played one after another, each from its first line.
+func (p *Player) Play(streams []*Stream, interleave bool, send func(Line) error) error {
+	if interleave {
+		if err := p.play(merge(streams), send); err != nil {
+			return err
+		}
+	} else {
+		for _, s := range streams {
+			if err := p.play(s.Next, send); err != nil {
+				return err
+			}
+		}
+	}
+	for _, s := range streams {
+		if err := s.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Player) play(next func() (Line, bool), send func(Line) error) error {
+	sleep := p.Sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+	var previous time.Time
+	for line, ok := next(); ok; line, ok = next() {
+		if !previous.IsZero() && p.Speed > 0 && line.Time.After(previous) {
+			wait := time.Duration(float64(line.Time.Sub(previous)) / p.Speed)
+			if p.MaxGap > 0 && wait > p.MaxGap {
+				wait = p.MaxGap
+			}
+			sleep(wait)
+		}
+		// Lines going back in time are sent at once without moving the clock back.
+		if line.Time.After(previous) {
+			previous = line.Time
+		}
+		if err := send(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseSpeed parses a replay speed such as 10x, 0.5 or max. max, like 0, sends the lines without waiting.
+func ParseSpeed(value string) (float64, error) {
+	if value == "max" {
+		return 0, nil
+	}
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+	if err != nil || speed < 0 {
+		return 0, fmt.Errorf("invalid speed %q, use a factor such as 1x, 10x or 0.5x, or max", value)
+	}
+	return speed, nil
+}
@@ -0,0 +1,116 @@
+package replay_test
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg/replay"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2025, 1, 2, 15, 0, 0, 0, time.UTC)
+
+func stream(pod, log string) *replay.Stream {
+	return replay.NewStream(strings.NewReader(log), replay.Line{Namespace: "shop", Pod: pod}, start, time.Time{}, time.Time{})
+}
+
+func play(t *testing.T, p *replay.Player, interleave bool, streams ...*replay.Stream) ([]string, []time.Duration) {
+	var waits []time.Duration
+	p.Sleep = func(d time.Duration) { waits = append(waits, d) }
+	var sent []string
+	require.NoError(t, p.Play(streams, interleave, func(l replay.Line) error {
+		sent = append(sent, l.Pod+": "+l.Line)
+		return nil
+	}))
+	return sent, waits
+}
+
+const (
+	apiLog = "2025-01-02T15:00:01Z starting\nno timestamp\n2025-01-02T15:00:11Z ready\n2025-01-02T15:00:31Z error: boom\n"
+	webLog = "2025-01-02T15:00:05Z web up\n2025-01-02T15:00:20Z web request\n"
+)
+
+func TestPlay(t *testing.T) {
+	sent, waits := play(t, &replay.Player{Speed: 10}, false, stream("api", apiLog), stream("web", webLog))
+	assert.Equal(t, []string{
+		"api: 2025-01-02T15:00:01Z starting", "api: no timestamp", "api: 2025-01-02T15:00:11Z ready", "api: 2025-01-02T15:00:31Z error: boom",
+		"web: 2025-01-02T15:00:05Z web up", "web: 2025-01-02T15:00:20Z web request",
+	}, sent)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 1500 * time.Millisecond}, waits, "every pod starts from its first line")
+
+	sent, waits = play(t, &replay.Player{Speed: 1, MaxGap: 8 * time.Second}, true, stream("api", apiLog), stream("web", webLog))
+	assert.Equal(t, []string{
+		"api: 2025-01-02T15:00:01Z starting", "api: no timestamp", "web: 2025-01-02T15:00:05Z web up", "api: 2025-01-02T15:00:11Z ready",
+		"web: 2025-01-02T15:00:20Z web request", "api: 2025-01-02T15:00:31Z error: boom",
+	}, sent)
+	assert.Equal(t, []time.Duration{4 * time.Second, 6 * time.Second, 8 * time.Second, 8 * time.Second}, waits)
+
+	_, waits = play(t, &replay.Player{Speed: 0}, true, stream("api", apiLog))
+	assert.Empty(t, waits)
+}
+
+func TestStreamWindow(t *testing.T) {
+	s := replay.NewStream(strings.NewReader(apiLog), replay.Line{Pod: "api"}, start, start.Add(5*time.Second), start.Add(20*time.Second))
+	sent, _ := play(t, &replay.Player{}, false, s)
+	assert.Equal(t, []string{"api: 2025-01-02T15:00:11Z ready"}, sent)
+}
+
+func TestParseSpeed(t *testing.T) {
+	for value, want := range map[string]float64{"10x": 10, "0.5x": 0.5, "2": 2, "max": 0} {
+		speed, err := replay.ParseSpeed(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, want, speed, value)
+	}
+	_, err := replay.ParseSpeed("fast")
+	assert.Error(t, err)
+}
+
+func TestSyslog(t *testing.T) {
+	l := replay.Line{Time: start, Namespace: "shop", Pod: "api-1", Container: "app", Owner: "deployment/api", Line: `level=error msg="a ] b"`}
+	assert.Equal(t, `<11>1 2025-01-02T15:00:00Z api-1 app - - [k8s@32473 namespace="shop" pod="api-1" container="app" owner="deployment/api"] level=error msg="a ] b"`, replay.Syslog(l))
+	assert.True(t, strings.HasPrefix(replay.Syslog(replay.Line{Time: start, Pod: "web", Line: "ok"}), "<14>1 2025-01-02T15:00:00Z web - - -"))
+}
+
+func TestUDPSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	sink, err := replay.Dial("udp://" + conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer sink.Close()
+	require.NoError(t, sink.Send(replay.Line{Time: start, Namespace: "shop", Pod: "api-1", Line: "hello"}))
+	buf := make([]byte, 1024)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, `<14>1 2025-01-02T15:00:00Z api-1 - - - [k8s@32473 namespace="shop" pod="api-1"] hello`, string(buf[:n]))
+}
+
+func TestHTTPSink(t *testing.T) {
+	var received []replay.Line
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var l replay.Line
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&l))
+		received = append(received, l)
+		if l.Line == "reject" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	sink, err := replay.Dial(server.URL + "/logs")
+	require.NoError(t, err)
+	l := replay.Line{Time: start, Namespace: "shop", Pod: "api-1", Container: "app", Line: "hello"}
+	require.NoError(t, sink.Send(l))
+	assert.Error(t, sink.Send(replay.Line{Line: "reject"}))
+	require.Len(t, received, 2)
+	assert.Equal(t, l, received[0])
+
+	_, err = replay.Dial("ftp://localhost:21")
+	assert.Error(t, err)
+}
@@ -0,0 +1,116 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg/structured"
+)
+
+// Sink receives the replayed lines.
+type Sink interface {
+	Send(Line) error
+	Close() error
+}
+
+// Dial returns the sink of a target: tcp://host:port or udp://host:port for a syslog receiver,
+// http://host:port/path to post every line as JSON.
+func Dial(target string) (Sink, error) {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid replay target %q, use tcp://host:port, udp://host:port or http://host:port/path", target)
+	}
+	switch u.Scheme {
+	case "tcp", "udp":
+		conn, err := net.DialTimeout(u.Scheme, u.Host, 10*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		return &syslogSink{conn: conn, stream: u.Scheme == "tcp"}, nil
+	case "http", "https":
+		return &httpSink{url: target, client: &http.Client{Timeout: 10 * time.Second}}, nil
+	}
+	return nil, fmt.Errorf("unsupported replay target %q, use tcp://, udp:// or http://", target)
+}
+
+// syslogSink writes RFC 5424 messages, one per datagram over UDP and newline delimited over TCP.
+type syslogSink struct {
+	conn   net.Conn
+	stream bool
+}
+
+func (s *syslogSink) Send(l Line) error {
+	msg := Syslog(l)
+	if s.stream {
+		msg += "\n"
+	}
+	_, err := s.conn.Write([]byte(msg))
+	return err
+}
+
+func (s *syslogSink) Close() error {
+	return s.conn.Close()
+}
+
+// Syslog formats the line as an RFC 5424 message of facility user. The pod is the hostname, the container the
+// app name, and the attribution is repeated as structured data.
+func Syslog(l Line) string {
+	severity := 6
+	switch structured.Severity(l.Line) {
+	case structured.SeverityError:
+		severity = 3
+	case structured.SeverityWarn:
+		severity = 4
+	}
+	app := l.Container
+	if app == "" {
+		app = "-"
+	}
+	data := fmt.Sprintf(`[k8s@32473 namespace="%s" pod="%s"`, sdEscape(l.Namespace), sdEscape(l.Pod))
+	if l.Container != "" {
+		data += fmt.Sprintf(` container="%s"`, sdEscape(l.Container))
+	}
+	if l.Owner != "" {
+		data += fmt.Sprintf(` owner="%s"`, sdEscape(l.Owner))
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s - - %s] %s", 8+severity, l.Time.Format(time.RFC3339Nano), l.Pod, app, data, l.Line)
+}
+
+// sdEscape escapes a structured data parameter value.
+func sdEscape(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(v)
+}
+
+// httpSink posts every line as JSON.
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *httpSink) Send(l Line) error {
+	body, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s answered %s", s.url, resp.Status)
+	}
+	return nil
+}
+
+func (s *httpSink) Close() error {
+	return nil
+}
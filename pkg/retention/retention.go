@@ -0,0 +1,182 @@
+// Package retention decides which recorded pods a cleanup removes under a retention policy.
+package retention
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg/store"
+)
+
+// Policy selects the pods to remove. A pod is removed if any of the set rules selects it.
+type Policy struct {
+	// OlderThan removes pods whose log was last written before now minus OlderThan.
+	OlderThan time.Duration
+	// MaxBytes evicts terminated pods, oldest first, until the logs fit in MaxBytes.
+	MaxBytes int64
+	// Owners removes every pod of these owners, given as kind/name.
+	Owners []string
+	// Gone removes pods that no longer exist in the cluster.
+	Gone bool
+	// KeepRevisions removes the pods of all but the last KeepRevisions revisions of every deployment.
+	KeepRevisions int
+}
+
+// Candidate is a recorded pod with what the policy needs to know about it.
+type Candidate struct {
+	Pod store.Pod
+	// Bytes is the size of everything deleted with the pod: log, status, hook output and crash bundles.
+	Bytes     int64
+	LastWrite time.Time
+	// Terminated is true for pods that were deleted, completed or failed, or whose state is unknown.
+	Terminated bool
+	// Gone is true if the pod no longer exists in the cluster.
+	Gone bool
+}
+
+// Removal is a pod selected by the policy, with the rule that selected it.
+type Removal struct {
+	Pod    store.Pod `json:"pod"`
+	Bytes  int64     `json:"bytes"`
+	Reason string    `json:"reason"`
+}
+
+// Plan returns the pods to remove, in the order of the candidates. Every pod is listed once,
+// with the first rule selecting it.
+func Plan(candidates []Candidate, p Policy, now time.Time) []Removal {
+	reasons := make(map[int]string)
+	mark := func(i int, reason string) {
+		if _, ok := reasons[i]; !ok {
+			reasons[i] = reason
+		}
+	}
+	for i, c := range candidates {
+		owner := c.Pod.Owner().String()
+		for _, o := range p.Owners {
+			if strings.EqualFold(o, owner) {
+				mark(i, "owner "+owner)
+			}
+		}
+		if p.Gone && c.Gone {
+			mark(i, "no longer in the cluster")
+		}
+		if p.OlderThan > 0 && !c.LastWrite.IsZero() && now.Sub(c.LastWrite) > p.OlderThan {
+			mark(i, fmt.Sprintf("last written %s ago", now.Sub(c.LastWrite).Round(time.Minute)))
+		}
+	}
+	if p.KeepRevisions > 0 {
+		keepRevisions(candidates, p.KeepRevisions, mark)
+	}
+	if p.MaxBytes > 0 {
+		evictToSize(candidates, p.MaxBytes, reasons, mark)
+	}
+	removals := make([]Removal, 0, len(reasons))
+	for i, c := range candidates {
+		if reason, ok := reasons[i]; ok {
+			removals = append(removals, Removal{Pod: c.Pod, Bytes: c.Bytes, Reason: reason})
+		}
+	}
+	return removals
+}
+
+// keepRevisions marks the pods of the revisions of every deployment older than its last keep revisions.
+// Pods of an unknown revision are left to the other rules.
+func keepRevisions(candidates []Candidate, keep int, mark func(int, string)) {
+	revisions := make(map[store.Owner][]store.Pod)
+	for _, c := range candidates {
+		if c.Pod.OwnerKind == "deployment" {
+			revisions[c.Pod.Owner()] = append(revisions[c.Pod.Owner()], c.Pod)
+		}
+	}
+	for i, c := range candidates {
+		pods, ok := revisions[c.Pod.Owner()]
+		if !ok || c.Pod.Revision == 0 {
+			continue
+		}
+		revs := store.Revisions(pods)
+		if len(revs) > keep && c.Pod.Revision < revs[len(revs)-keep] {
+			mark(i, fmt.Sprintf("revision %d, keeping the last %d", c.Pod.Revision, keep))
+		}
+	}
+}
+
+// evictToSize marks terminated pods, oldest first, until the pods left fit in maxBytes.
+// Running pods are never evicted, so the store may stay above maxBytes.
+func evictToSize(candidates []Candidate, maxBytes int64, reasons map[int]string, mark func(int, string)) {
+	var total int64
+	evictable := make([]int, 0)
+	for i, c := range candidates {
+		if _, ok := reasons[i]; ok {
+			continue
+		}
+		total += c.Bytes
+		if c.Terminated || c.Gone {
+			evictable = append(evictable, i)
+		}
+	}
+	sort.SliceStable(evictable, func(a, b int) bool {
+		return age(candidates[evictable[a]]).Before(age(candidates[evictable[b]]))
+	})
+	for _, i := range evictable {
+		if total <= maxBytes {
+			return
+		}
+		mark(i, "store above the maximum size")
+		total -= candidates[i].Bytes
+	}
+}
+
+// age is the creation time of the pod, or its last write for pods recorded without one.
+func age(c Candidate) time.Time {
+	if created := c.Pod.Created(); !created.IsZero() {
+		return created
+	}
+	return c.LastWrite
+}
+
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+	{"B", 1},
+}
+
+// ParseSize parses sizes like 500MB, 1.5GiB, 2G or 1024.
+func ParseSize(value string) (int64, error) {
+	s := strings.TrimSpace(value)
+	multiplier := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(strings.ToUpper(s), strings.ToUpper(u.suffix)) {
+			s = strings.TrimSpace(s[:len(s)-len(u.suffix)])
+			multiplier = u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, use e.g. 500MB or 2GiB", value)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// ParseAge parses a duration that may also be given in days, e.g. 7d or 36h.
+func ParseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q, use e.g. 7d or 36h", s)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q, use e.g. 7d or 36h", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,63 @@
+package retention_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg/retention"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2025, 1, 10, 12, 0, 0, 0, time.Local)
+
+func candidate(name, created string, rev int, bytes int64, terminated bool) retention.Candidate {
+	pod := store.Pod{Name: name, Namespace: "shop", OwnerKind: "deployment", OwnerName: "api", CreatedAt: created, Revision: rev}
+	return retention.Candidate{Pod: pod, Bytes: bytes, LastWrite: pod.Created().Add(time.Hour), Terminated: terminated}
+}
+
+func names(removals []retention.Removal) []string {
+	out := make([]string, 0, len(removals))
+	for _, r := range removals {
+		out = append(out, r.Pod.Name)
+	}
+	return out
+}
+
+func TestPlan(t *testing.T) {
+	candidates := []retention.Candidate{
+		candidate("api-1", "2025-01-01 10:00:00", 1, 100, true),
+		candidate("api-2", "2025-01-05 10:00:00", 2, 300, true),
+		candidate("api-3", "2025-01-09 10:00:00", 3, 500, false),
+	}
+
+	assert.Equal(t, []string{"api-1"}, names(retention.Plan(candidates, retention.Policy{OlderThan: 7 * 24 * time.Hour}, now)))
+	assert.Equal(t, []string{"api-1", "api-2"}, names(retention.Plan(candidates, retention.Policy{KeepRevisions: 1}, now)))
+	unknown := append([]retention.Candidate{candidate("api-0", "2024-12-01 10:00:00", 0, 50, true)}, candidates...)
+	assert.Equal(t, []string{"api-1", "api-2"}, names(retention.Plan(unknown, retention.Policy{KeepRevisions: 1}, now)), "the revision of api-0 is unknown")
+	assert.Len(t, retention.Plan(candidates, retention.Policy{Owners: []string{"Deployment/api"}}, now), 3)
+
+	// The oldest terminated pods go first and the running pod is kept even above the limit.
+	assert.Equal(t, []string{"api-1"}, names(retention.Plan(candidates, retention.Policy{MaxBytes: 800}, now)))
+	assert.Equal(t, []string{"api-1", "api-2"}, names(retention.Plan(candidates, retention.Policy{MaxBytes: 100}, now)))
+
+	// Every pod is listed once with the first rule selecting it.
+	removals := retention.Plan(candidates, retention.Policy{OlderThan: 7 * 24 * time.Hour, KeepRevisions: 2}, now)
+	require.Len(t, removals, 1)
+	assert.Contains(t, removals[0].Reason, "last written")
+}
+
+func TestParseSize(t *testing.T) {
+	for input, want := range map[string]int64{"1024": 1024, "500MB": 500e6, "2GiB": 2 << 30, "1.5k": 1536} {
+		got, err := retention.ParseSize(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, want, got, input)
+	}
+	_, err := retention.ParseSize("lots")
+	assert.Error(t, err)
+
+	d, err := retention.ParseAge("7d")
+	require.NoError(t, err)
+	assert.Equal(t, 7*24*time.Hour, d)
+}
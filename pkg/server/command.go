@@ -0,0 +1,79 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/revolyssup/k8sdebug/pkg/workspace"
+	"github.com/spf13/cobra"
+)
+
+func NewCommand() *cobra.Command {
+	var addr, token, ws, archive string
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve the log store over a read-only HTTP API and a web UI",
+		Long: `Serve the log store of the active workspace over a read-only HTTP API, with a web UI at the root url.
+
+  GET /api/namespaces
+  GET /api/namespaces/{ns}/owners                  owners with their pods, oldest first
+  GET /api/namespaces/{ns}/pods?owner=kind/name    pods with their size and last recorded status
+  GET /api/namespaces/{ns}/pods/{pod}/lines        lines, with offset and limit (default 1000), or tail
+  GET /api/namespaces/{ns}/pods/{pod}/stream       new lines as server-sent events, after the last tail lines
+  GET /api/namespaces/{ns}/diff?from=pod&to=pod    diff of the last 5000 lines of two pods, context lines around changes
+
+lines and stream accept filter (a regular expression), level (error or warn) and since and until (a duration
+like 2h or RFC 3339). Lines without a timestamp have the time of the line before them.
+
+The server listens on localhost only by default. To share it on the LAN, listen on another address with a token:
+requests must then send it as "Authorization: Bearer <token>" or as the token query parameter. Open the UI once
+with ?token=<token> to store it in the browser.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			s := workspace.Current()
+			var err error
+			switch {
+			case archive != "":
+				s, err = store.OpenArchive(archive, filepath.Join(filepath.Dir(pkg.ConfigFilePath), "archives"))
+			case ws != "":
+				s, err = workspace.Open(ws)
+			}
+			if err != nil {
+				cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+				return
+			}
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				cmd.Println(pkg.ColorLine(fmt.Sprintf("invalid address %s: %v", addr, err), pkg.ColorRed))
+				return
+			}
+			if ip := net.ParseIP(host); token == "" && host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+				cmd.Println(pkg.ColorLine(fmt.Sprintf("Listening on %s without --token: anyone who can reach it can read the logs", addr), pkg.ColorYellow))
+			}
+			listener, err := net.Listen("tcp", addr)
+			if err != nil {
+				cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+				return
+			}
+			cmd.Printf("Serving %s on http://%s/\n", s.Root, listener.Addr())
+			srv := &http.Server{Handler: New(s, token).Handler(), ReadHeaderTimeout: 10 * time.Second}
+			if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+			}
+		},
+	}
+	cmd.Flags().StringVar(&addr, "addr", "127.0.0.1:7878", "address to listen on, e.g. 0.0.0.0:7878 to share on the LAN")
+	cmd.Flags().StringVar(&token, "token", os.Getenv("K8SDEBUG_TOKEN"), "token required by the API, defaults to $K8SDEBUG_TOKEN")
+	cmd.Flags().StringVar(&ws, "workspace", "", "serve this workspace instead of the active one")
+	cmd.Flags().StringVar(&archive, "archive", "", "serve a tar.gz written by logs export, without importing it")
+	cmd.RegisterFlagCompletionFunc("workspace", workspace.CompleteNames)
+	cmd.MarkFlagFilename("archive", "gz")
+	return cmd
+}
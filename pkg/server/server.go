@@ -0,0 +1,560 @@
+// Package server exposes the log store over a read-only HTTP API with live updates over server-sent events,
+// and serves a web UI browsing it.
+package server
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg/diffrender"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/revolyssup/k8sdebug/pkg/structured"
+	"github.com/revolyssup/k8sdebug/pkg/tail"
+)
+
+//go:embed web
+var web embed.FS
+
+const (
+	defaultLimit = 1000
+	maxLimit     = 10000
+	// diffLines is the number of lines diffed from the end of each log.
+	diffLines = 5000
+)
+
+// Server serves the store. With a Token every API request must carry it.
+type Server struct {
+	Store *store.Store
+	Token string
+	// Poll is how often streamed logs are checked for new lines.
+	Poll time.Duration
+	// Heartbeat is how often an idle stream sends a comment to keep proxies from closing it.
+	Heartbeat time.Duration
+}
+
+func New(s *store.Store, token string) *Server {
+	return &Server{Store: s, Token: token, Poll: 500 * time.Millisecond, Heartbeat: 15 * time.Second}
+}
+
+// Handler routes the API under /api/ and the web UI everywhere else.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/namespaces", s.auth(s.namespaces))
+	mux.HandleFunc("GET /api/namespaces/{ns}/owners", s.auth(s.owners))
+	mux.HandleFunc("GET /api/namespaces/{ns}/pods", s.auth(s.pods))
+	mux.HandleFunc("GET /api/namespaces/{ns}/pods/{pod}/lines", s.auth(s.lines))
+	mux.HandleFunc("GET /api/namespaces/{ns}/pods/{pod}/stream", s.auth(s.stream))
+	mux.HandleFunc("GET /api/namespaces/{ns}/diff", s.auth(s.diff))
+	mux.HandleFunc("GET /api/", s.auth(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown endpoint %s", r.URL.Path))
+	}))
+	ui, _ := fs.Sub(web, "web")
+	mux.Handle("GET /", http.FileServerFS(ui))
+	return mux
+}
+
+// auth rejects the requests without the token, given as a bearer token or, for EventSource which cannot set
+// headers, as the token query parameter.
+func (s *Server) auth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.Token != "" {
+			given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if given == "" {
+				given = r.URL.Query().Get("token")
+			}
+			if subtle.ConstantTimeCompare([]byte(given), []byte(s.Token)) != 1 {
+				writeError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid token"))
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+func (s *Server) namespaces(w http.ResponseWriter, r *http.Request) {
+	namespaces, err := s.Store.Namespaces()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, namespaces)
+}
+
+// owner is an owner with the names of its recorded pods, oldest first.
+type owner struct {
+	Kind string   `json:"kind"`
+	Name string   `json:"name"`
+	Pods []string `json:"pods"`
+}
+
+func (s *Server) owners(w http.ResponseWriter, r *http.Request) {
+	pods, ok := s.allPods(w, r.PathValue("ns"))
+	if !ok {
+		return
+	}
+	owners := make([]*owner, 0)
+	byOwner := make(map[store.Owner]*owner)
+	for _, p := range pods {
+		o, ok := byOwner[p.Owner()]
+		if !ok {
+			o = &owner{Kind: p.OwnerKind, Name: p.OwnerName, Pods: make([]string, 0)}
+			byOwner[p.Owner()] = o
+			owners = append(owners, o)
+		}
+		o.Pods = append(o.Pods, p.Name)
+	}
+	writeJSON(w, owners)
+}
+
+// pod describes a recorded pod.
+type pod struct {
+	Name       string           `json:"name"`
+	Namespace  string           `json:"namespace"`
+	Owner      string           `json:"owner"`
+	CreatedAt  string           `json:"createdAt,omitempty"`
+	ReplicaSet string           `json:"replicaSet,omitempty"`
+	Revision   int              `json:"revision,omitempty"`
+	Bytes      int64            `json:"bytes"`
+	ModifiedAt time.Time        `json:"modifiedAt"`
+	Status     *store.PodStatus `json:"status,omitempty"`
+}
+
+func (s *Server) pods(w http.ResponseWriter, r *http.Request) {
+	pods, ok := s.allPods(w, r.PathValue("ns"))
+	if !ok {
+		return
+	}
+	filter := r.URL.Query().Get("owner")
+	described := make([]pod, 0, len(pods))
+	for _, p := range pods {
+		if filter != "" && !strings.EqualFold(p.Owner().String(), filter) {
+			continue
+		}
+		d := pod{Name: p.Name, Namespace: p.Namespace, Owner: p.Owner().String(), CreatedAt: p.CreatedAt,
+			ReplicaSet: p.ReplicaSet, Revision: p.Revision}
+		if info, err := s.Store.Stat(p.LogPath); err == nil {
+			d.Bytes = info.Size()
+			d.ModifiedAt = info.ModTime()
+		}
+		if status, err := s.Store.Status(p.Namespace, p.Name); err == nil {
+			d.Status = &status
+		}
+		described = append(described, d)
+	}
+	writeJSON(w, described)
+}
+
+// validName reports whether name is a single path element, so that it cannot name a file outside the store.
+func validName(name string) bool {
+	return fs.ValidPath(name) && !strings.ContainsAny(name, `/\`) && !strings.Contains(name, "..")
+}
+
+func (s *Server) allPods(w http.ResponseWriter, ns string) ([]store.Pod, bool) {
+	if !validName(ns) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid namespace %q", ns))
+		return nil, false
+	}
+	pods, err := s.Store.AllPods(ns)
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no logs recorded for namespace %s", ns))
+		return nil, false
+	}
+	return pods, true
+}
+
+// recordedPod returns the path of the log of a pod recorded in the namespace. Only the pods listed by the store
+// are served.
+func (s *Server) recordedPod(w http.ResponseWriter, ns, name string) (string, bool) {
+	pods, ok := s.allPods(w, ns)
+	if !ok {
+		return "", false
+	}
+	return s.findPod(w, pods, ns, name)
+}
+
+func (s *Server) findPod(w http.ResponseWriter, pods []store.Pod, ns, name string) (string, bool) {
+	if validName(name) {
+		for _, p := range pods {
+			if p.Name == name {
+				return s.Store.LogPath(ns, name), true
+			}
+		}
+	}
+	writeError(w, http.StatusNotFound, fmt.Errorf("no logs recorded for pod %s/%s", ns, name))
+	return "", false
+}
+
+// Line is a line of a log with its 1-based number and, when known, its time.
+type Line struct {
+	N    int        `json:"n"`
+	Time *time.Time `json:"time,omitempty"`
+	Text string     `json:"text"`
+}
+
+// filter selects the lines of a request.
+type filter struct {
+	re    *regexp.Regexp
+	level string
+	since time.Time
+	until time.Time
+}
+
+func parseFilter(r *http.Request) (filter, error) {
+	q := r.URL.Query()
+	var f filter
+	var err error
+	if v := q.Get("filter"); v != "" {
+		if f.re, err = regexp.Compile(v); err != nil {
+			return f, fmt.Errorf("invalid filter: %w", err)
+		}
+	}
+	switch f.level = q.Get("level"); f.level {
+	case "", structured.SeverityError, structured.SeverityWarn:
+	default:
+		return f, fmt.Errorf("invalid level %q, use error or warn", f.level)
+	}
+	if f.since, err = parseTime(q.Get("since")); err != nil {
+		return f, err
+	}
+	if f.until, err = parseTime(q.Get("until")); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+// parseTime parses a duration before now like 2h or an RFC 3339 time. The empty string is the zero time.
+func parseTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return t, fmt.Errorf("invalid time %q, use a duration like 2h or RFC 3339", v)
+	}
+	return t, nil
+}
+
+// keep reports whether the line is selected. at is the time of the line or of the last timestamped line before it.
+func (f filter) keep(line string, at time.Time) bool {
+	if !f.since.IsZero() && (at.IsZero() || at.Before(f.since)) {
+		return false
+	}
+	if !f.until.IsZero() && (at.IsZero() || at.After(f.until)) {
+		return false
+	}
+	switch f.level {
+	case structured.SeverityError:
+		if !structured.IsError(line) {
+			return false
+		}
+	case structured.SeverityWarn:
+		if structured.Severity(line) == "" {
+			return false
+		}
+	}
+	return f.re == nil || f.re.MatchString(line)
+}
+
+// linesResult is a page of the selected lines of a log.
+type linesResult struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	// Total is the number of selected lines, Offset the index of the first returned one among them.
+	Total  int    `json:"total"`
+	Offset int    `json:"offset"`
+	Lines  []Line `json:"lines"`
+}
+
+// lines returns the selected lines of a pod: limit lines from offset, or the last tail lines.
+func (s *Server) lines(w http.ResponseWriter, r *http.Request) {
+	ns, name := r.PathValue("ns"), r.PathValue("pod")
+	f, err := parseFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	q := r.URL.Query()
+	offset, limit, last := 0, defaultLimit, 0
+	for key, v := range map[string]*int{"offset": &offset, "limit": &limit, "tail": &last} {
+		if q.Get(key) == "" {
+			continue
+		}
+		if *v, err = strconv.Atoi(q.Get(key)); err != nil || *v < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid %s %q", key, q.Get(key)))
+			return
+		}
+	}
+	if limit == 0 || limit > maxLimit {
+		limit = maxLimit
+	}
+	path, ok := s.recordedPod(w, ns, name)
+	if !ok {
+		return
+	}
+	file, err := s.Store.Open(path)
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no logs recorded for pod %s/%s", ns, name))
+		return
+	}
+	defer file.Close()
+	result := linesResult{Namespace: ns, Pod: name, Lines: make([]Line, 0)}
+	if last > 0 {
+		limit = min(last, maxLimit)
+	}
+	var at time.Time
+	scanner := tail.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		text := scanner.Text()
+		if t, ok := structured.Timestamp(text); ok {
+			at = t
+		}
+		if !f.keep(text, at) {
+			continue
+		}
+		result.Total++
+		switch {
+		case last > 0:
+			// Only the last lines are kept while scanning.
+			if len(result.Lines) == limit {
+				result.Lines = result.Lines[1:]
+			}
+		case result.Total <= offset || len(result.Lines) == limit:
+			continue
+		}
+		l := Line{N: n, Text: text}
+		if !at.IsZero() {
+			t := at
+			l.Time = &t
+		}
+		result.Lines = append(result.Lines, l)
+	}
+	if err := scanner.Err(); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	result.Offset = offset
+	if last > 0 {
+		result.Offset = result.Total - len(result.Lines)
+	}
+	writeJSON(w, result)
+}
+
+// diff diffs the last lines of the logs of the pods from and to.
+func (s *Server) diff(w http.ResponseWriter, r *http.Request) {
+	ns := r.PathValue("ns")
+	q := r.URL.Query()
+	contextLines := 3
+	if v := q.Get("context"); v != "" {
+		var err error
+		if contextLines, err = strconv.Atoi(v); err != nil || contextLines < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid context %q", v))
+			return
+		}
+	}
+	pods, ok := s.allPods(w, ns)
+	if !ok {
+		return
+	}
+	var sides [2]diffrender.Side
+	var logs [2]string
+	for i, name := range []string{q.Get("from"), q.Get("to")} {
+		if name == "" {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("from and to are required"))
+			return
+		}
+		sides[i] = diffrender.Side{Pod: name}
+		for _, p := range pods {
+			if p.Name == name {
+				sides[i].CreatedAt = p.CreatedAt
+			}
+		}
+		path, ok := s.findPod(w, pods, ns, name)
+		if !ok {
+			return
+		}
+		file, err := s.Store.Open(path)
+		if err != nil {
+			writeError(w, http.StatusNotFound, fmt.Errorf("no logs recorded for pod %s/%s", ns, name))
+			return
+		}
+		lines, err := tail.Last(file, diffLines, nil)
+		file.Close()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		logs[i] = strings.Join(lines, "\n")
+	}
+	writeJSON(w, diffrender.Compute(sides[0], sides[1], logs[0], logs[1], contextLines))
+}
+
+// stream sends the lines appended to the log of a pod as server-sent "line" events, starting with the last
+// tail lines. A "reset" event is sent when the log is truncated, e.g. by logs cleanup.
+func (s *Server) stream(w http.ResponseWriter, r *http.Request) {
+	ns, name := r.PathValue("ns"), r.PathValue("pod")
+	f, err := parseFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	backlog := 0
+	if v := r.URL.Query().Get("tail"); v != "" {
+		if backlog, err = strconv.Atoi(v); err != nil || backlog < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid tail %q", v))
+			return
+		}
+	}
+	path, ok := s.recordedPod(w, ns, name)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	t := &follower{store: s.Store, path: path, filter: f}
+	send := func(event string, v any) bool {
+		data, _ := json.Marshal(v)
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+	lines, err := t.read(backlog)
+	if err != nil {
+		send("error", map[string]string{"error": err.Error()})
+		return
+	}
+	for _, l := range lines {
+		if !send("line", l) {
+			return
+		}
+	}
+	flusher.Flush()
+	poll := time.NewTicker(s.Poll)
+	defer poll.Stop()
+	heartbeat := time.NewTicker(s.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-poll.C:
+			if t.truncated() {
+				t.reset()
+				if !send("reset", map[string]string{"pod": name}) {
+					return
+				}
+			}
+			lines, err := t.read(-1)
+			if err != nil {
+				send("error", map[string]string{"error": err.Error()})
+				return
+			}
+			for _, l := range lines {
+				if !send("line", l) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// follower reads the complete lines appended to a log since the previous read.
+type follower struct {
+	store   *store.Store
+	path    string
+	filter  filter
+	offset  int64
+	n       int
+	at      time.Time
+	partial string
+}
+
+func (t *follower) truncated() bool {
+	info, err := t.store.Stat(t.path)
+	return err == nil && info.Size() < t.offset
+}
+
+func (t *follower) reset() {
+	t.offset, t.n, t.at, t.partial = 0, 0, time.Time{}, ""
+}
+
+// read returns the new selected lines, only the last keep of them when keep is not negative.
+func (t *follower) read(keep int) ([]Line, error) {
+	file, err := t.store.Open(t.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if _, err := file.Seek(t.offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	lines := make([]Line, 0)
+	reader := bufio.NewReader(file)
+	for {
+		chunk, err := reader.ReadString('\n')
+		t.offset += int64(len(chunk))
+		if err != nil {
+			// The recorder may be in the middle of writing the last line.
+			t.partial += chunk
+			if err == io.EOF {
+				return lines, nil
+			}
+			return lines, err
+		}
+		text := strings.TrimSuffix(strings.TrimSuffix(t.partial+chunk, "\n"), "\r")
+		t.partial = ""
+		t.n++
+		if ts, ok := structured.Timestamp(text); ok {
+			t.at = ts
+		}
+		if keep == 0 || !t.filter.keep(text, t.at) {
+			continue
+		}
+		if keep > 0 && len(lines) == keep {
+			lines = lines[1:]
+		}
+		l := Line{N: t.n, Text: text}
+		if !t.at.IsZero() {
+			at := t.at
+			l.Time = &at
+		}
+		lines = append(lines, l)
+	}
+}
@@ -0,0 +1,234 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg/diffrender"
+	"github.com/revolyssup/k8sdebug/pkg/server"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newServer(t *testing.T, token string) (*httptest.Server, string) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "shop"), 0755))
+	files := map[string]string{
+		"deployment.api.metadata": "2025-01-02 15:00:00 ; api-1 ; api-5d4 ; 1\n2025-01-02 16:00:00 ; api-2 ; api-6e5 ; 2\n",
+		"api-1.log":               "2025-01-02T15:00:01Z starting\n2025-01-02T15:00:02Z level=warn msg=slow\nno timestamp\n2025-01-02T15:00:03Z error: boom\n",
+		"api-2.log":               "2025-01-02T16:00:01Z starting\n2025-01-02T16:00:02Z ready\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(root, "shop", name), []byte(content), 0644))
+	}
+	s := server.New(store.New(root), token)
+	s.Poll = 10 * time.Millisecond
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	return ts, root
+}
+
+func get(t *testing.T, url string, v any) int {
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if v != nil {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+	}
+	return resp.StatusCode
+}
+
+type linesResult struct {
+	Total  int
+	Offset int
+	Lines  []server.Line
+}
+
+func texts(r linesResult) []string {
+	out := make([]string, 0, len(r.Lines))
+	for _, l := range r.Lines {
+		out = append(out, l.Text)
+	}
+	return out
+}
+
+func TestBrowse(t *testing.T) {
+	ts, _ := newServer(t, "")
+	var namespaces []string
+	assert.Equal(t, http.StatusOK, get(t, ts.URL+"/api/namespaces", &namespaces))
+	assert.Equal(t, []string{"shop"}, namespaces)
+
+	var owners []struct {
+		Kind, Name string
+		Pods       []string
+	}
+	get(t, ts.URL+"/api/namespaces/shop/owners", &owners)
+	require.Len(t, owners, 1)
+	assert.Equal(t, []string{"api-1", "api-2"}, owners[0].Pods)
+
+	var pods []struct {
+		Name     string
+		Revision int
+		Bytes    int64
+	}
+	get(t, ts.URL+"/api/namespaces/shop/pods?owner=deployment/api", &pods)
+	require.Len(t, pods, 2)
+	assert.Equal(t, 2, pods[1].Revision)
+	assert.Positive(t, pods[0].Bytes)
+
+	var errBody map[string]string
+	assert.Equal(t, http.StatusNotFound, get(t, ts.URL+"/api/namespaces/nope/pods", &errBody))
+	assert.NotEmpty(t, errBody["error"])
+
+	resp, err := http.Post(ts.URL+"/api/namespaces", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode, "the API is read-only")
+
+	resp, err = http.Get(ts.URL + "/")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/html")
+}
+
+func TestLines(t *testing.T) {
+	ts, _ := newServer(t, "")
+	base := ts.URL + "/api/namespaces/shop/pods/api-1/lines"
+	var r linesResult
+	get(t, base+"?offset=1&limit=2", &r)
+	assert.Equal(t, 4, r.Total)
+	assert.Equal(t, []string{"2025-01-02T15:00:02Z level=warn msg=slow", "no timestamp"}, texts(r))
+	assert.Equal(t, 2, r.Lines[0].N)
+	require.NotNil(t, r.Lines[1].Time, "lines without a timestamp have the time of the line before")
+	assert.Equal(t, time.Date(2025, 1, 2, 15, 0, 2, 0, time.UTC), r.Lines[1].Time.UTC())
+
+	r = linesResult{}
+	get(t, base+"?tail=1", &r)
+	assert.Equal(t, []string{"2025-01-02T15:00:03Z error: boom"}, texts(r))
+	assert.Equal(t, 3, r.Offset)
+
+	r = linesResult{}
+	get(t, base+"?level=warn", &r)
+	assert.Equal(t, 2, r.Total)
+
+	r = linesResult{}
+	get(t, base+"?filter=st.*g&until=2025-01-02T15:00:01Z", &r)
+	assert.Equal(t, []string{"2025-01-02T15:00:01Z starting"}, texts(r))
+
+	assert.Equal(t, http.StatusBadRequest, get(t, base+"?filter=(", nil))
+	assert.Equal(t, http.StatusBadRequest, get(t, base+"?level=debug", nil))
+	assert.Equal(t, http.StatusNotFound, get(t, ts.URL+"/api/namespaces/shop/pods/api-9/lines", nil))
+}
+
+func TestDiff(t *testing.T) {
+	ts, _ := newServer(t, "")
+	var d diffrender.Diff
+	require.Equal(t, http.StatusOK, get(t, ts.URL+"/api/namespaces/shop/diff?from=api-1&to=api-2&context=0", &d))
+	assert.Equal(t, "2025-01-02 15:00:00", d.From.CreatedAt)
+	assert.NotEmpty(t, d.Hunks)
+	assert.Equal(t, http.StatusBadRequest, get(t, ts.URL+"/api/namespaces/shop/diff?from=api-1", nil))
+}
+
+func TestOutsideStore(t *testing.T) {
+	ts, root := newServer(t, "")
+	require.NoError(t, os.WriteFile(filepath.Join(root, "secret.log"), []byte("password\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(root), "secret.log"), []byte("password\n"), 0644))
+	// A stream of a file outside the store would never end.
+	client := &http.Client{Timeout: 5 * time.Second}
+	for _, path := range []string{
+		"/api/namespaces/shop/diff?from=api-1&to=../secret",
+		"/api/namespaces/shop/diff?from=api-1&to=..%2F..%2Fsecret",
+		"/api/namespaces/shop/diff?from=api-1&to=%2Ftmp%2Fsecret",
+		"/api/namespaces/..%2F/pods/secret/lines",
+		"/api/namespaces/..%2F/pods/secret/stream",
+		"/api/namespaces/..%2F/owners",
+		"/api/namespaces/shop/pods/..%2Fsecret/lines",
+		"/api/namespaces/shop/pods/..%2F..%2Fsecret/lines",
+		"/api/namespaces/shop/pods/..%5Csecret/lines",
+		"/api/namespaces/shop/pods/..%2Fsecret/stream",
+	} {
+		resp, err := client.Get(ts.URL + path)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		assert.Contains(t, []int{http.StatusBadRequest, http.StatusNotFound}, resp.StatusCode, path)
+		assert.NotContains(t, string(body), "password", path)
+	}
+	assert.Equal(t, http.StatusNotFound, get(t, ts.URL+"/api/namespaces/shop/pods/unknown/lines", nil),
+		"only the pods listed by the store are served")
+}
+
+func TestToken(t *testing.T) {
+	ts, _ := newServer(t, "secret")
+	assert.Equal(t, http.StatusUnauthorized, get(t, ts.URL+"/api/namespaces", nil))
+	assert.Equal(t, http.StatusUnauthorized, get(t, ts.URL+"/api/namespaces?token=wrong", nil))
+	assert.Equal(t, http.StatusOK, get(t, ts.URL+"/api/namespaces?token=secret", nil))
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/namespaces", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestStream(t *testing.T) {
+	ts, root := newServer(t, "")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/api/namespaces/shop/pods/api-2/stream?tail=1&filter=ready|new", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	events := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+				events <- data
+			}
+		}
+		close(events)
+	}()
+	next := func() server.Line {
+		var l server.Line
+		select {
+		case data := <-events:
+			require.NoError(t, json.Unmarshal([]byte(data), &l))
+		case <-ctx.Done():
+			t.Fatal("no event received")
+		}
+		return l
+	}
+	l := next()
+	assert.Equal(t, 2, l.N)
+	assert.Equal(t, "2025-01-02T16:00:02Z ready", l.Text)
+
+	f, err := os.OpenFile(filepath.Join(root, "shop", "api-2.log"), os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.WriteString("skipped\nnew li")
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	_, err = f.WriteString("ne\n")
+	require.NoError(t, err)
+	l = next()
+	assert.Equal(t, 4, l.N)
+	assert.Equal(t, "new line", l.Text, "partial lines are sent once complete")
+}
@@ -0,0 +1,441 @@
+package store
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const archiveIndexVersion = 2
+
+// maxArchiveIndexes bounds the number of indexes kept in the cache directory; the least recently
+// opened archives are evicted first.
+const maxArchiveIndexes = 32
+
+// maxInMemoryEntry is the largest file that is decompressed into memory when opened. Larger files
+// are decompressed to an unlinked temporary file that goes away when it is closed.
+const maxInMemoryEntry = 32 << 20
+
+// ErrReadOnly is returned when writing to a store opened from an archive.
+var ErrReadOnly = errors.New("the store is a read-only archive")
+
+// File is a recorded file opened for reading.
+type File interface {
+	io.ReadSeekCloser
+	Stat() (fs.FileInfo, error)
+}
+
+// archiveEntry is a regular file of the archive. Decompression restarts at the gzip member that
+// begins at Start in the archive, and the file begins Skip uncompressed bytes later.
+type archiveEntry struct {
+	Name    string    `json:"name"`
+	Start   int64     `json:"start"`
+	Skip    int64     `json:"skip"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// archiveIndex is built on the first open of an archive and reused while the archive is unchanged.
+type archiveIndex struct {
+	Version int            `json:"version"`
+	Source  string         `json:"source"`
+	Size    int64          `json:"size"`
+	Entries []archiveEntry `json:"entries"`
+}
+
+// archive serves the files of a tar.gz export. Gzip streams cannot be seeked, so only the index is
+// cached and a file is decompressed when it is opened. Exports write every file as its own gzip
+// member, which lets decompression start right before the file; for other archives it starts
+// at the beginning.
+type archive struct {
+	gz      *os.File
+	entries map[string]archiveEntry
+	dirs    map[string][]fs.DirEntry
+}
+
+// OpenArchive returns a read-only store over a tar.gz archive written by logs export.
+// The index is kept in cacheDir, keyed by the content of the archive.
+func OpenArchive(source, cacheDir string) (*Store, error) {
+	source, err := filepath.Abs(source)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	key, size, err := archiveKey(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		f.Close()
+		return nil, err
+	}
+	file := filepath.Join(cacheDir, key+".index.json")
+	index, err := readArchiveIndex(file)
+	if err != nil || index.Version != archiveIndexVersion || index.Size != size {
+		if index, err = buildArchiveIndex(f); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("indexing %s: %w", source, err)
+		}
+		index.Source, index.Size = source, size
+		if err := writeArchiveIndex(file, index); err != nil {
+			f.Close()
+			return nil, err
+		}
+	} else {
+		now := time.Now()
+		os.Chtimes(file, now, now)
+	}
+	pruneArchiveCache(cacheDir)
+	return &Store{Root: source, archive: newArchive(f, index.Entries)}, nil
+}
+
+// ClearArchiveCache removes the indexes of all the archives opened so far.
+func ClearArchiveCache(cacheDir string) error {
+	return os.RemoveAll(cacheDir)
+}
+
+// archiveKey identifies an archive by its size and the bytes at both of its ends, so that a copy
+// or a move of the archive reuses the index.
+func archiveKey(f *os.File) (string, int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+	const sample = 64 << 10
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n", info.Size())
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, sample)); err != nil {
+		return "", 0, err
+	}
+	if _, err := io.Copy(h, io.NewSectionReader(f, max(info.Size()-sample, 0), sample)); err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8]), info.Size(), nil
+}
+
+// pruneArchiveCache evicts the least recently opened indexes beyond maxArchiveIndexes, along with
+// anything else left in the cache directory by earlier versions.
+func pruneArchiveCache(cacheDir string) {
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return
+	}
+	var indexes []fs.FileInfo
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".index.json") {
+			os.Remove(filepath.Join(cacheDir, e.Name()))
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			indexes = append(indexes, info)
+		}
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i].ModTime().After(indexes[j].ModTime()) })
+	for i := maxArchiveIndexes; i < len(indexes); i++ {
+		os.Remove(filepath.Join(cacheDir, indexes[i].Name()))
+	}
+}
+
+func readArchiveIndex(file string) (archiveIndex, error) {
+	var index archiveIndex
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return index, err
+	}
+	err = json.Unmarshal(data, &index)
+	return index, err
+}
+
+func writeArchiveIndex(file string, index archiveIndex) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// byteCounter counts the compressed bytes consumed by gzip. It implements io.ByteReader, so gzip
+// reads from it without buffering ahead and the count is the offset of the next gzip member.
+type byteCounter struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *byteCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *byteCounter) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// gzipMember is where a gzip member starts in the archive and in the uncompressed tar.
+type gzipMember struct {
+	start, offset int64
+}
+
+// memberReader decompresses the gzip members of the archive one after the other, recording where
+// each of them starts. tar.Reader reads from it without buffering ahead, so offset is the position
+// in the uncompressed tar.
+type memberReader struct {
+	in      *byteCounter
+	gzr     *gzip.Reader
+	offset  int64
+	members []gzipMember
+}
+
+func (m *memberReader) Read(p []byte) (int, error) {
+	for {
+		n, err := m.gzr.Read(p)
+		m.offset += int64(n)
+		if n > 0 {
+			return n, nil
+		}
+		if err != io.EOF {
+			return 0, err
+		}
+		start := m.in.n
+		if err := m.gzr.Reset(m.in); err != nil {
+			return 0, err
+		}
+		m.gzr.Multistream(false)
+		m.members = append(m.members, gzipMember{start: start, offset: m.offset})
+	}
+}
+
+// buildArchiveIndex decompresses the archive once and records, for every regular file, the gzip
+// member to restart decompression from and the file's offset within it.
+func buildArchiveIndex(f *os.File) (archiveIndex, error) {
+	index := archiveIndex{Version: archiveIndexVersion, Entries: make([]archiveEntry, 0)}
+	in := &byteCounter{r: bufio.NewReader(io.NewSectionReader(f, 0, math.MaxInt64))}
+	gzr, err := gzip.NewReader(in)
+	if err != nil {
+		return index, err
+	}
+	defer gzr.Close()
+	gzr.Multistream(false)
+	members := &memberReader{in: in, gzr: gzr, members: []gzipMember{{}}}
+	tr := tar.NewReader(members)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return index, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		if !fs.ValidPath(name) {
+			return index, fmt.Errorf("illegal file path: %s", header.Name)
+		}
+		member := members.members[len(members.members)-1]
+		index.Entries = append(index.Entries, archiveEntry{
+			Name: name, Start: member.start, Skip: members.offset - member.offset, Size: header.Size, ModTime: header.ModTime,
+		})
+	}
+	return index, nil
+}
+
+func newArchive(f *os.File, entries []archiveEntry) *archive {
+	a := &archive{gz: f, entries: make(map[string]archiveEntry), dirs: make(map[string][]fs.DirEntry)}
+	seenDirs := make(map[string]bool)
+	for _, e := range entries {
+		if _, ok := a.entries[e.Name]; ok {
+			// A file appended again to the archive replaces the earlier one.
+			a.entries[e.Name] = e
+			continue
+		}
+		a.entries[e.Name] = e
+		a.dirs[path.Dir(e.Name)] = append(a.dirs[path.Dir(e.Name)], fs.FileInfoToDirEntry(archiveFileInfo{entry: e}))
+		for dir := path.Dir(e.Name); dir != "." && !seenDirs[dir]; dir = path.Dir(dir) {
+			seenDirs[dir] = true
+			info := archiveFileInfo{entry: archiveEntry{Name: dir, ModTime: e.ModTime}, dir: true}
+			a.dirs[path.Dir(dir)] = append(a.dirs[path.Dir(dir)], fs.FileInfoToDirEntry(info))
+		}
+	}
+	for _, d := range a.dirs {
+		sort.Slice(d, func(i, j int) bool { return d[i].Name() < d[j].Name() })
+	}
+	return a
+}
+
+// archiveFileInfo describes a file or a directory implied by the paths of the archive.
+type archiveFileInfo struct {
+	entry archiveEntry
+	dir   bool
+}
+
+func (i archiveFileInfo) Name() string       { return path.Base(i.entry.Name) }
+func (i archiveFileInfo) Size() int64        { return i.entry.Size }
+func (i archiveFileInfo) ModTime() time.Time { return i.entry.ModTime }
+func (i archiveFileInfo) IsDir() bool        { return i.dir }
+func (i archiveFileInfo) Sys() any           { return nil }
+
+func (i archiveFileInfo) Mode() fs.FileMode {
+	if i.IsDir() {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+type archiveFile struct {
+	io.ReadSeeker
+	info  archiveFileInfo
+	close func() error
+}
+
+func (f archiveFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f archiveFile) Close() error {
+	if f.close == nil {
+		return nil
+	}
+	return f.close()
+}
+
+func (a *archive) lookup(name string) (archiveEntry, error) {
+	e, ok := a.entries[name]
+	if !ok {
+		return e, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return e, nil
+}
+
+// open decompresses the file from the archive, into memory when it is small enough.
+func (a *archive) open(name string) (File, error) {
+	e, err := a.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	gzr, err := gzip.NewReader(bufio.NewReader(io.NewSectionReader(a.gz, e.Start, math.MaxInt64)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	defer gzr.Close()
+	if _, err := io.CopyN(io.Discard, gzr, e.Skip); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	info := archiveFileInfo{entry: e}
+	if e.Size <= maxInMemoryEntry {
+		data := make([]byte, e.Size)
+		if _, err := io.ReadFull(gzr, data); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return archiveFile{ReadSeeker: bytes.NewReader(data), info: info}, nil
+	}
+	tmp, err := os.CreateTemp("", "k8sdebug-archive-*")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(tmp.Name())
+	if _, err := io.CopyN(tmp, gzr, e.Size); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	return archiveFile{ReadSeeker: tmp, info: info, close: tmp.Close}, nil
+}
+
+func (a *archive) readDir(name string) ([]fs.DirEntry, error) {
+	entries, ok := a.dirs[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return entries, nil
+}
+
+// rel converts a path under the root of the store to the name of an archive entry.
+func (s *Store) rel(name string) string {
+	rel, err := filepath.Rel(s.Root, name)
+	if err != nil {
+		return name
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Open opens a file of the store, such as the LogPath of a pod.
+func (s *Store) Open(name string) (File, error) {
+	if s.archive == nil {
+		return os.Open(name)
+	}
+	return s.archive.open(s.rel(name))
+}
+
+// Stat returns the FileInfo of a file of the store.
+func (s *Store) Stat(name string) (fs.FileInfo, error) {
+	if s.archive == nil {
+		return os.Stat(name)
+	}
+	e, err := s.archive.lookup(s.rel(name))
+	if err != nil {
+		return nil, err
+	}
+	return archiveFileInfo{entry: e}, nil
+}
+
+// ReadOnly reports whether the store was opened from an archive.
+func (s *Store) ReadOnly() bool {
+	return s.archive != nil
+}
+
+func (s *Store) readDir(name string) ([]fs.DirEntry, error) {
+	if s.archive == nil {
+		return os.ReadDir(name)
+	}
+	return s.archive.readDir(s.rel(name))
+}
+
+func (s *Store) readFile(name string) ([]byte, error) {
+	f, err := s.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
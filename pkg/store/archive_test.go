@@ -0,0 +1,110 @@
+package store_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestArchive writes the files to a tar.gz, as a single gzip member or, like logs export,
+// one member per file.
+func writeTestArchive(t *testing.T, files map[string]string, memberPerFile bool) string {
+	dest := filepath.Join(t.TempDir(), "capture.tar.gz")
+	f, err := os.Create(dest)
+	require.NoError(t, err)
+	gzw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gzw)
+	for _, name := range []string{"manifest.json", "shop/deployment.api.metadata", "shop/api-1.log", "shop/api-2.log", "shop/api-2.status"} {
+		content, ok := files[name]
+		if !ok {
+			continue
+		}
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), ModTime: time.Now(), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+		if memberPerFile {
+			require.NoError(t, tw.Flush())
+			require.NoError(t, gzw.Close())
+			gzw.Reset(f)
+		}
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+	require.NoError(t, f.Close())
+	return dest
+}
+
+func TestOpenArchive(t *testing.T) {
+	for name, memberPerFile := range map[string]bool{"single member": false, "member per file": true} {
+		t.Run(name, func(t *testing.T) { testOpenArchive(t, memberPerFile) })
+	}
+}
+
+func testOpenArchive(t *testing.T, memberPerFile bool) {
+	source := writeTestArchive(t, map[string]string{
+		"manifest.json":                `{"version":1}`,
+		"shop/deployment.api.metadata": "2025-01-01 10:00:00 ; api-1 ; api ; 1\n2025-01-02 10:00:00 ; api-2 ; api ; 1\n",
+		"shop/api-1.log":               "first\nsecond\n",
+		"shop/api-2.log":               "third\n",
+		"shop/api-2.status":            `{"phase":"Running"}`,
+	}, memberPerFile)
+	cache := t.TempDir()
+	s, err := store.OpenArchive(source, cache)
+	require.NoError(t, err)
+	assert.True(t, s.ReadOnly())
+
+	namespaces, err := s.Namespaces()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"shop"}, namespaces)
+	pods, err := s.AllPods("shop")
+	require.NoError(t, err)
+	require.Len(t, pods, 2)
+	assert.Equal(t, "deployment", pods[0].OwnerKind)
+
+	f, err := s.Open(pods[0].LogPath)
+	require.NoError(t, err)
+	_, err = f.Seek(6, io.SeekStart)
+	require.NoError(t, err)
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "second\n", string(data))
+
+	status, err := s.Status("shop", "api-2")
+	require.NoError(t, err)
+	assert.Equal(t, "Running", status.Phase)
+	assert.ErrorIs(t, s.WriteStatus("shop", "api-2", status), store.ErrReadOnly)
+	_, err = s.Stat(s.LogPath("shop", "missing"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// Only the index is cached, and a copy of the archive reuses it.
+	entries, err := os.ReadDir(cache)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, ".json", filepath.Ext(entries[0].Name()))
+	data, err = os.ReadFile(source)
+	require.NoError(t, err)
+	copied := filepath.Join(t.TempDir(), "copy.tar.gz")
+	require.NoError(t, os.WriteFile(copied, data, 0644))
+	s, err = store.OpenArchive(copied, cache)
+	require.NoError(t, err)
+	entries, err = os.ReadDir(cache)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+	f, err = s.Open(s.LogPath("shop", "api-2"))
+	require.NoError(t, err)
+	data, err = io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "third\n", string(data))
+
+	require.NoError(t, store.ClearArchiveCache(cache))
+	_, err = os.Stat(cache)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
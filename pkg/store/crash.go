@@ -0,0 +1,99 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CrashManifest is the name of the file describing a crash bundle.
+const CrashManifest = "bundle.json"
+
+// Crash describes a crash bundle: the scene of an abnormal container termination assembled by the recorder
+// under <namespace>/crashes/<id>/.
+type Crash struct {
+	ID         string    `json:"id"`
+	Namespace  string    `json:"namespace"`
+	Pod        string    `json:"pod"`
+	Owner      string    `json:"owner,omitempty"`
+	Container  string    `json:"container"`
+	ExitCode   int32     `json:"exitCode"`
+	Reason     string    `json:"reason,omitempty"`
+	Restarts   int32     `json:"restarts"`
+	FinishedAt time.Time `json:"finishedAt"`
+	CreatedAt  time.Time `json:"createdAt"`
+	// Files lists the files of the bundle relative to its directory.
+	Files []string `json:"files"`
+	// Errors lists the parts of the bundle that could not be collected.
+	Errors []string `json:"errors,omitempty"`
+	Path   string   `json:"path"`
+}
+
+// CrashesPath is the directory keeping the crash bundles of the namespace.
+func (s *Store) CrashesPath(namespace string) string {
+	return filepath.Join(s.Root, namespace, "crashes")
+}
+
+// Crashes returns the crash bundles of the namespace, oldest first. Bundles still being assembled are skipped.
+func (s *Store) Crashes(namespace string) ([]Crash, error) {
+	dir := s.CrashesPath(namespace)
+	entries, err := s.readDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Crash{}, nil
+		}
+		return nil, err
+	}
+	crashes := make([]Crash, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		data, err := s.readFile(filepath.Join(dir, e.Name(), CrashManifest))
+		if err != nil {
+			continue
+		}
+		var c Crash
+		if err := json.Unmarshal(data, &c); err != nil {
+			continue
+		}
+		c.Path = filepath.Join(dir, e.Name())
+		crashes = append(crashes, c)
+	}
+	sort.Slice(crashes, func(i, j int) bool {
+		return crashes[i].FinishedAt.Before(crashes[j].FinishedAt)
+	})
+	return crashes, nil
+}
+
+// PodCrashPaths returns the directories of the crash bundles of the pod. Bundles are named after their pod,
+// only the manifests of the bundles whose name starts with the pod name are read.
+func (s *Store) PodCrashPaths(namespace, pod string) ([]string, error) {
+	dir := s.CrashesPath(namespace)
+	entries, err := s.readDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var paths []string
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasPrefix(e.Name(), pod+"-") {
+			continue
+		}
+		data, err := s.readFile(filepath.Join(dir, e.Name(), CrashManifest))
+		if err != nil {
+			continue
+		}
+		var c Crash
+		if err := json.Unmarshal(data, &c); err != nil || c.Pod != pod {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, e.Name()))
+	}
+	return paths, nil
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// PodStatus is the last known state of a recorded pod. The recorder keeps it up to date in <pod>.status.
+type PodStatus struct {
+	Phase      string            `json:"phase"`
+	Restarts   int32             `json:"restarts"`
+	Deleted    bool              `json:"deleted"`
+	UpdatedAt  time.Time         `json:"updatedAt"`
+	Containers []ContainerStatus `json:"containers,omitempty"`
+}
+
+type ContainerStatus struct {
+	Name     string `json:"name"`
+	Restarts int32  `json:"restarts"`
+	State    string `json:"state"`
+	Reason   string `json:"reason,omitempty"`
+	ExitCode int32  `json:"exitCode,omitempty"`
+}
+
+func (s *Store) StatusPath(namespace, pod string) string {
+	return filepath.Join(s.Root, namespace, fmt.Sprintf("%s.status", pod))
+}
+
+// HooksPath is the directory keeping the output of the hooks run for the pod.
+func (s *Store) HooksPath(namespace, pod string) string {
+	return filepath.Join(s.Root, namespace, fmt.Sprintf("%s.hooks", pod))
+}
+
+// Status returns the last known status of the pod. Pods recorded by older recorders have no status file.
+func (s *Store) Status(namespace, pod string) (PodStatus, error) {
+	var status PodStatus
+	data, err := s.readFile(s.StatusPath(namespace, pod))
+	if err != nil {
+		return status, err
+	}
+	err = json.Unmarshal(data, &status)
+	return status, err
+}
+
+// WriteStatus replaces the status file of the pod atomically. Each write goes through its own temporary file, so
+// concurrent writes of the same pod never rename each other's partial files.
+func (s *Store) WriteStatus(namespace, pod string, status PodStatus) error {
+	if s.ReadOnly() {
+		return ErrReadOnly
+	}
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	path := s.StatusPath(namespace, pod)
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
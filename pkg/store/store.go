@@ -0,0 +1,385 @@
+package store
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// TimeFormat is the layout used by the recorder for pod creation timestamps in metadata files.
+const TimeFormat = "2006-01-02 15:04:05"
+
+// Pod is a single entry of an owner's metadata file.
+// Metadata lines look like `<created> ; <pod> [; <replicaset> ; <revision>]`.
+type Pod struct {
+	Name       string
+	Namespace  string
+	OwnerKind  string
+	OwnerName  string
+	CreatedAt  string
+	ReplicaSet string
+	Revision   int
+	LogPath    string
+}
+
+// Created parses CreatedAt. The zero time is returned if the timestamp is malformed.
+func (p Pod) Created() time.Time {
+	t, _ := time.ParseInLocation(TimeFormat, p.CreatedAt, time.Local)
+	return t
+}
+
+func (p Pod) Owner() Owner {
+	return Owner{Namespace: p.Namespace, Kind: p.OwnerKind, Name: p.OwnerName}
+}
+
+// Store reads the recorded logs under a root directory laid out as <root>/<namespace>/...
+type Store struct {
+	Root    string
+	archive *archive
+}
+
+func New(root string) *Store {
+	return &Store{Root: root}
+}
+
+func (s *Store) LogPath(namespace, pod string) string {
+	return filepath.Join(s.Root, namespace, fmt.Sprintf("%s.log", pod))
+}
+
+func (s *Store) MetadataPath(namespace, kind, name string) string {
+	return filepath.Join(s.Root, namespace, fmt.Sprintf("%s.%s.metadata", strings.ToLower(kind), name))
+}
+
+// Pods returns the pods recorded under the given owner in chronological order.
+// For kind "pod" the single pod log is returned if it exists.
+func (s *Store) Pods(namespace, kind, name string) ([]Pod, error) {
+	if strings.ToLower(kind) == "pod" {
+		path := s.LogPath(namespace, name)
+		if _, err := s.Stat(path); err != nil {
+			return nil, err
+		}
+		return []Pod{{Name: name, Namespace: namespace, OwnerKind: "pod", OwnerName: name, LogPath: path}}, nil
+	}
+	f, err := s.Open(s.MetadataPath(namespace, kind, name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	pods := make([]Pod, 0)
+	buf := bufio.NewScanner(f)
+	buf.Split(bufio.ScanLines)
+	for buf.Scan() {
+		pod, ok := parseMetadataLine(buf.Text())
+		if !ok {
+			continue
+		}
+		pod.Namespace = namespace
+		pod.OwnerKind = strings.ToLower(kind)
+		pod.OwnerName = name
+		pod.LogPath = s.LogPath(namespace, pod.Name)
+		pods = append(pods, pod)
+	}
+	if err := buf.Err(); err != nil {
+		return nil, err
+	}
+	fillRevisions(pods)
+	return pods, nil
+}
+
+func parseMetadataLine(line string) (Pod, bool) {
+	if strings.TrimSpace(line) == "" {
+		return Pod{}, false
+	}
+	ele := strings.Split(line, ";")
+	if len(ele) < 2 {
+		return Pod{}, false
+	}
+	pod := Pod{
+		CreatedAt: strings.TrimSpace(ele[0]),
+		Name:      strings.TrimSpace(ele[1]),
+	}
+	if len(ele) >= 3 {
+		pod.ReplicaSet = strings.TrimSpace(ele[2])
+	}
+	if len(ele) >= 4 {
+		pod.Revision, _ = strconv.Atoi(strings.TrimSpace(ele[3]))
+	}
+	return pod, true
+}
+
+// fillRevisions fills in the ReplicaSet and revision of entries written by older recorders
+// that only stored the pod name. The ReplicaSet is derived from the pod name and takes the revision
+// recorded for another of its pods. Recorded revisions are never changed: only when the owner has no
+// recorded revision at all are its ReplicaSets numbered in creation order, otherwise the revision of
+// the other ReplicaSets stays 0, unknown.
+func fillRevisions(pods []Pod) {
+	known := make(map[string]int)
+	for i := range pods {
+		if pods[i].ReplicaSet == "" {
+			idx := strings.LastIndex(pods[i].Name, "-")
+			if idx <= 0 {
+				continue
+			}
+			pods[i].ReplicaSet = pods[i].Name[:idx]
+		}
+		if _, ok := known[pods[i].ReplicaSet]; !ok && pods[i].Revision != 0 {
+			known[pods[i].ReplicaSet] = pods[i].Revision
+		}
+	}
+	if len(known) > 0 {
+		for i := range pods {
+			if pods[i].Revision == 0 {
+				pods[i].Revision = known[pods[i].ReplicaSet]
+			}
+		}
+		return
+	}
+	order := make([]int, len(pods))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return pods[order[i]].Created().Before(pods[order[j]].Created())
+	})
+	for _, i := range order {
+		if pods[i].ReplicaSet == "" {
+			continue
+		}
+		if _, ok := known[pods[i].ReplicaSet]; !ok {
+			known[pods[i].ReplicaSet] = len(known) + 1
+		}
+		pods[i].Revision = known[pods[i].ReplicaSet]
+	}
+}
+
+// Revisions returns the distinct revisions of the given pods in ascending order.
+func Revisions(pods []Pod) []int {
+	seen := make(map[int]bool)
+	revs := make([]int, 0)
+	for _, p := range pods {
+		if p.Revision == 0 || seen[p.Revision] {
+			continue
+		}
+		seen[p.Revision] = true
+		revs = append(revs, p.Revision)
+	}
+	sort.Ints(revs)
+	return revs
+}
+
+// Owner is a root owner of recorded pods, identified by its metadata file.
+type Owner struct {
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+}
+
+func (o Owner) String() string {
+	return o.Kind + "/" + o.Name
+}
+
+// Namespaces returns the recorded namespaces.
+func (s *Store) Namespaces() ([]string, error) {
+	entries, err := s.readDir(s.Root)
+	if err != nil {
+		return nil, err
+	}
+	namespaces := make([]string, 0)
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			namespaces = append(namespaces, e.Name())
+		}
+	}
+	return namespaces, nil
+}
+
+// Owners returns the owners with a metadata file in the namespace, sorted by kind and name.
+func (s *Store) Owners(namespace string) ([]Owner, error) {
+	entries, err := s.readDir(filepath.Join(s.Root, namespace))
+	if err != nil {
+		return nil, err
+	}
+	owners := make([]Owner, 0)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".metadata") {
+			continue
+		}
+		kind, ownerName, ok := strings.Cut(strings.TrimSuffix(name, ".metadata"), ".")
+		if !ok {
+			continue
+		}
+		owners = append(owners, Owner{Namespace: namespace, Kind: kind, Name: ownerName})
+	}
+	sort.Slice(owners, func(i, j int) bool {
+		if owners[i].Kind != owners[j].Kind {
+			return owners[i].Kind < owners[j].Kind
+		}
+		return owners[i].Name < owners[j].Name
+	})
+	return owners, nil
+}
+
+// AllPods returns every pod with a log file in the namespace. Pods found in a metadata file
+// carry their creation time and revision; the result is sorted by creation time.
+func (s *Store) AllPods(namespace string) ([]Pod, error) {
+	entries, err := s.readDir(filepath.Join(s.Root, namespace))
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]Pod)
+	owners, err := s.Owners(namespace)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range owners {
+		pods, err := s.Pods(namespace, o.Kind, o.Name)
+		if err != nil {
+			continue
+		}
+		for _, p := range pods {
+			known[p.Name] = p
+		}
+	}
+	pods := make([]Pod, 0)
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".log") {
+			continue
+		}
+		name := strings.TrimSuffix(e.Name(), ".log")
+		pod, ok := known[name]
+		if !ok {
+			pod = Pod{Name: name, Namespace: namespace, OwnerKind: "pod", OwnerName: name, LogPath: s.LogPath(namespace, name)}
+		}
+		pods = append(pods, pod)
+	}
+	sort.SliceStable(pods, func(i, j int) bool {
+		return pods[i].CreatedAt < pods[j].CreatedAt
+	})
+	return pods, nil
+}
+
+// RemovePods deletes the logs, status, hook output and crash bundles of the pods and their lines in the
+// metadata of their owners. Metadata files left without pods are deleted as well.
+func (s *Store) RemovePods(pods []Pod) error {
+	if s.ReadOnly() {
+		return ErrReadOnly
+	}
+	removed := make(map[Owner]map[string]bool)
+	for _, pod := range pods {
+		for _, path := range []string{s.LogPath(pod.Namespace, pod.Name), s.StatusPath(pod.Namespace, pod.Name)} {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		crashes, err := s.PodCrashPaths(pod.Namespace, pod.Name)
+		if err != nil {
+			return err
+		}
+		for _, dir := range append(crashes, s.HooksPath(pod.Namespace, pod.Name)) {
+			if err := os.RemoveAll(dir); err != nil {
+				return err
+			}
+		}
+		if pod.OwnerKind == "pod" {
+			continue
+		}
+		if removed[pod.Owner()] == nil {
+			removed[pod.Owner()] = make(map[string]bool)
+		}
+		removed[pod.Owner()][pod.Name] = true
+	}
+	for owner, names := range removed {
+		if err := s.removeMetadataLines(owner, names); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeMetadataLines rewrites the metadata file of the owner without the lines of the given pods. The file stays
+// locked from the read to the rename, so lines appended by a running recorder are kept.
+func (s *Store) removeMetadataLines(owner Owner, names map[string]bool) error {
+	path := s.MetadataPath(owner.Namespace, owner.Kind, owner.Name)
+	f, err := lockFile(path, os.O_RDONLY)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	var kept strings.Builder
+	for _, line := range strings.Split(string(data), "\n") {
+		pod, ok := parseMetadataLine(line)
+		if !ok || names[pod.Name] {
+			continue
+		}
+		kept.WriteString(line + "\n")
+	}
+	if kept.Len() == 0 {
+		return os.Remove(path)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(kept.String()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// AppendMetadata appends a line to a metadata file, created if needed, under the lock RemovePods takes to rewrite it.
+func AppendMetadata(path, line string) error {
+	f, err := lockFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(line + "\n")
+	return err
+}
+
+// lockFile opens the file at path and takes an exclusive flock on it, released by closing the file. A file replaced
+// or removed while waiting for the lock is opened again, so the lock is always held on the file at path.
+func lockFile(path string, flag int) (*os.File, error) {
+	for {
+		f, err := os.OpenFile(path, flag, 0644)
+		if err != nil {
+			return nil, err
+		}
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+			f.Close()
+			return nil, err
+		}
+		locked, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if current, err := os.Stat(path); err == nil && os.SameFile(locked, current) {
+			return f, nil
+		}
+		f.Close()
+	}
+}
@@ -0,0 +1,163 @@
+package store_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPodsRevisions(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "default"), 0755))
+	metadata := "2025-01-02 10:00:00 ; api-5c6b-klmno\n" +
+		"2025-01-01 10:00:00 ; api-7d9f-abcde\n" +
+		"\n" +
+		"2025-01-01 10:00:01 ; api-7d9f-fghij\n"
+	require.NoError(t, os.WriteFile(filepath.Join(root, "default", "deployment.api.metadata"), []byte(metadata), 0644))
+
+	pods, err := store.New(root).Pods("default", "deployment", "api")
+	require.NoError(t, err)
+	require.Len(t, pods, 3)
+	assert.Equal(t, "api-5c6b", pods[0].ReplicaSet)
+	assert.Equal(t, "api-7d9f", pods[1].ReplicaSet)
+	assert.Equal(t, filepath.Join(root, "default", "api-5c6b-klmno.log"), pods[0].LogPath)
+	assert.Equal(t, 2025, pods[0].Created().Year())
+	// Without any recorded revision, the ReplicaSets are numbered in creation order.
+	assert.Equal(t, 2, pods[0].Revision)
+	assert.Equal(t, 1, pods[1].Revision)
+	assert.Equal(t, 1, pods[2].Revision)
+	assert.Equal(t, []int{1, 2}, store.Revisions(pods))
+}
+
+func TestPodsLegacyRevisions(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "default"), 0755))
+	metadata := "2025-01-01 10:00:00 ; api-aaaa-1\n" +
+		"2025-01-02 10:00:00 ; api-bbbb-1 ; api-bbbb ; 1\n" +
+		"2025-01-03 10:00:00 ; api-cccc-1\n" +
+		"2025-01-04 10:00:00 ; api-dddd-1 ; api-dddd ; 5\n" +
+		"2025-01-05 10:00:00 ; api-bbbb-2\n" +
+		"2025-01-06 10:00:00 ; api-eeee-1\n"
+	require.NoError(t, os.WriteFile(filepath.Join(root, "default", "deployment.api.metadata"), []byte(metadata), 0644))
+
+	pods, err := store.New(root).Pods("default", "deployment", "api")
+	require.NoError(t, err)
+	revisions := make(map[string]int)
+	for _, p := range pods {
+		revisions[p.Name] = p.Revision
+	}
+	assert.Equal(t, map[string]int{
+		"api-aaaa-1": 0, // unknown, numbering it could collide with a recorded revision
+		"api-bbbb-1": 1,
+		"api-cccc-1": 0,
+		"api-dddd-1": 5,
+		"api-bbbb-2": 1, // the revision recorded for its ReplicaSet
+		"api-eeee-1": 0,
+	}, revisions)
+	assert.Equal(t, []int{1, 5}, store.Revisions(pods))
+}
+
+func TestRemovePods(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "default"), 0755))
+	metadata := "2025-01-01 10:00:00 ; api-1 ; api ; 1\n2025-01-02 10:00:00 ; api-2 ; api ; 2\n"
+	require.NoError(t, os.WriteFile(filepath.Join(root, "default", "deployment.api.metadata"), []byte(metadata), 0644))
+	for _, file := range []string{"api-1.log", "api-1.status", "api-2.log", "api-1.hooks/restart.out",
+		"crashes/api-1-app-20250101T100000Z/bundle.json", "crashes/api-1-app-20250101T100000Z/logs.txt",
+		"crashes/api-1-x-app-20250101T100000Z/bundle.json", "crashes/api-2-app-20250101T100000Z/bundle.json"} {
+		path := filepath.Join(root, "default", filepath.FromSlash(file))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		content := "x\n"
+		if filepath.Base(file) == store.CrashManifest {
+			// The bundle of pod api-1-x also starts with api-1-.
+			pod := strings.TrimSuffix(filepath.Base(filepath.Dir(file)), "-app-20250101T100000Z")
+			content = fmt.Sprintf(`{"pod":%q}`, pod)
+		}
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	s := store.New(root)
+	pods, err := s.Pods("default", "deployment", "api")
+	require.NoError(t, err)
+	crashes, err := s.PodCrashPaths("default", "api-1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(s.CrashesPath("default"), "api-1-app-20250101T100000Z")}, crashes)
+
+	require.NoError(t, s.RemovePods(pods[:1]))
+	left, err := s.AllPods("default")
+	require.NoError(t, err)
+	require.Len(t, left, 1)
+	assert.Equal(t, "api-2", left[0].Name)
+	assert.NoFileExists(t, filepath.Join(root, "default", "api-1.status"))
+	assert.NoDirExists(t, s.HooksPath("default", "api-1"))
+	assert.NoDirExists(t, crashes[0])
+	bundles, err := s.Crashes("default")
+	require.NoError(t, err)
+	require.Len(t, bundles, 2, "the bundles of other pods are kept")
+
+	require.NoError(t, s.RemovePods(pods[1:]))
+	assert.NoFileExists(t, s.MetadataPath("default", "deployment", "api"))
+}
+
+func TestWriteStatusConcurrently(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "default"), 0755))
+	s := store.New(root)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(restarts int32) {
+			defer wg.Done()
+			assert.NoError(t, s.WriteStatus("default", "api-1", store.PodStatus{Phase: "Running", Restarts: restarts}))
+		}(int32(i))
+	}
+	wg.Wait()
+	status, err := s.Status("default", "api-1")
+	require.NoError(t, err)
+	assert.Equal(t, "Running", status.Phase)
+	entries, err := os.ReadDir(filepath.Join(root, "default"))
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "no temporary file is left")
+}
+
+func TestRemovePodsWhileRecording(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "default"), 0755))
+	s := store.New(root)
+	path := s.MetadataPath("default", "deployment", "api")
+	const old, writers, lines = 100, 4, 100
+	for i := 0; i < old; i++ {
+		require.NoError(t, store.AppendMetadata(path, fmt.Sprintf("2025-01-01 10:00:00 ; old-%d ; api-old ; 1", i)))
+	}
+	pods, err := s.Pods("default", "deployment", "api")
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < lines; i++ {
+				assert.NoError(t, store.AppendMetadata(path, fmt.Sprintf("2025-01-02 10:00:00 ; new-%d-%d ; api-new ; 2", w, i)))
+			}
+		}(w)
+	}
+	// Remove the old pods one at a time, each rewriting the metadata file while the new pods are appended.
+	for _, p := range pods {
+		require.NoError(t, s.RemovePods([]store.Pod{p}))
+	}
+	wg.Wait()
+
+	left, err := s.Pods("default", "deployment", "api")
+	require.NoError(t, err)
+	assert.Len(t, left, writers*lines, "no appended line is lost")
+	for _, p := range left {
+		assert.Contains(t, p.Name, "new-")
+	}
+}
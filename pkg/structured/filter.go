@@ -0,0 +1,106 @@
+package structured
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Operators supported by conditions. Longer operators come first so that they are matched before their prefixes.
+var operators = []string{"!=", "=~", "!~", ">=", "<=", "==", "=", ">", "<"}
+
+// Condition compares a field of a record against a value, e.g. level=error or latency_ms>500.
+type Condition struct {
+	Key   string
+	Op    string
+	Value string
+	re    *regexp.Regexp
+}
+
+// ParseCondition parses expressions of the form <key><op><value> where op is one of
+// = (or ==), !=, =~, !~ (regular expressions), >, >=, <, <= (numeric comparison).
+func ParseCondition(expr string) (Condition, error) {
+	end := strings.IndexAny(expr, "=!~<>")
+	if end <= 0 {
+		return Condition{}, fmt.Errorf("invalid condition %q, expected <field><op><value>", expr)
+	}
+	key, rest := strings.TrimSpace(expr[:end]), expr[end:]
+	for _, op := range operators {
+		if !strings.HasPrefix(rest, op) {
+			continue
+		}
+		return NewCondition(key, op, strings.TrimSpace(rest[len(op):]))
+	}
+	return Condition{}, fmt.Errorf("invalid operator in condition %q", expr)
+}
+
+func NewCondition(key, op, value string) (Condition, error) {
+	c := Condition{Key: key, Op: op, Value: value}
+	switch op {
+	case "==":
+		c.Op = "="
+	case "=~", "!~":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return Condition{}, fmt.Errorf("invalid regular expression in condition on %s: %w", key, err)
+		}
+		c.re = re
+	case ">", ">=", "<", "<=":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return Condition{}, fmt.Errorf("%s needs a numeric value in condition on %s", op, key)
+		}
+	case "=", "!=":
+	default:
+		return Condition{}, fmt.Errorf("unknown operator %s", op)
+	}
+	return c, nil
+}
+
+// Match reports whether the record satisfies the condition. Records without the field only match "!=" and "!~".
+func (c Condition) Match(r Record) bool {
+	v, ok := r.Get(c.Key)
+	if !ok {
+		return c.Op == "!=" || c.Op == "!~"
+	}
+	switch c.Op {
+	case "=":
+		return v == c.Value
+	case "!=":
+		return v != c.Value
+	case "=~":
+		return c.re.MatchString(v)
+	case "!~":
+		return !c.re.MatchString(v)
+	}
+	got, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return false
+	}
+	want, _ := strconv.ParseFloat(c.Value, 64)
+	switch c.Op {
+	case ">":
+		return got > want
+	case ">=":
+		return got >= want
+	case "<":
+		return got < want
+	case "<=":
+		return got <= want
+	}
+	return false
+}
+
+func (c Condition) String() string {
+	return c.Key + c.Op + c.Value
+}
+
+// MatchAll reports whether the record satisfies every condition.
+func MatchAll(r Record, conditions []Condition) bool {
+	for _, c := range conditions {
+		if !c.Match(r) {
+			return false
+		}
+	}
+	return true
+}
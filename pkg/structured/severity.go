@@ -0,0 +1,45 @@
+package structured
+
+import "regexp"
+
+const (
+	SeverityError = "error"
+	SeverityWarn  = "warn"
+)
+
+var (
+	errorWords = regexp.MustCompile(`(?i)\b(error|exception|fatal|panic|critical|traceback)\b`)
+	warnWords  = regexp.MustCompile(`(?i)\b(warn|warning)\b`)
+)
+
+// Severity classifies a line as SeverityError, SeverityWarn or "". The level field of JSON and
+// logfmt lines is used when present, otherwise the line is searched for error and warning keywords.
+func Severity(line string) string {
+	if rec := Parse(line); rec.Structured() {
+		if level := rec.Level(); level != "" {
+			switch level {
+			case "error", "err", "fatal", "panic", "critical", "crit", "alert", "emerg", "emergency":
+				return SeverityError
+			case "warn", "warning":
+				return SeverityWarn
+			}
+			return ""
+		}
+	}
+	switch {
+	case errorWords.MatchString(line):
+		return SeverityError
+	case warnWords.MatchString(line):
+		return SeverityWarn
+	}
+	return ""
+}
+
+func IsError(line string) bool {
+	return Severity(line) == SeverityError
+}
+
+// IsWarning is true for warnings only, not errors.
+func IsWarning(line string) bool {
+	return Severity(line) == SeverityWarn
+}
@@ -0,0 +1,215 @@
+package structured
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+type Format int
+
+const (
+	FormatPlain Format = iota
+	FormatJSON
+	FormatLogfmt
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatJSON:
+		return "json"
+	case FormatLogfmt:
+		return "logfmt"
+	}
+	return "plain"
+}
+
+type Field struct {
+	Key   string
+	Value string
+}
+
+// Record is a parsed log line. Fields keep the order in which they appeared in the line,
+// nested JSON objects are flattened into dotted keys.
+type Record struct {
+	Format Format
+	Fields []Field
+	Raw    string
+}
+
+// Parse detects whether line is a JSON object or a logfmt line and parses its fields.
+// Lines in neither format are returned as a FormatPlain record without fields.
+func Parse(line string) Record {
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, "{") && strings.HasSuffix(trimmed, "}") {
+		if fields, err := parseJSON([]byte(trimmed), ""); err == nil {
+			return Record{Format: FormatJSON, Fields: fields, Raw: line}
+		}
+	}
+	if fields, ok := parseLogfmt(trimmed); ok {
+		return Record{Format: FormatLogfmt, Fields: fields, Raw: line}
+	}
+	return Record{Format: FormatPlain, Raw: line}
+}
+
+func (r Record) Structured() bool {
+	return r.Format != FormatPlain
+}
+
+func (r Record) Get(key string) (string, bool) {
+	for _, f := range r.Fields {
+		if f.Key == key {
+			return f.Value, true
+		}
+	}
+	return "", false
+}
+
+// Project keeps only the given keys, in the given order. Missing keys are skipped.
+func (r Record) Project(keys []string) Record {
+	projected := Record{Format: r.Format, Raw: r.Raw, Fields: make([]Field, 0, len(keys))}
+	for _, k := range keys {
+		if v, ok := r.Get(k); ok {
+			projected.Fields = append(projected.Fields, Field{Key: k, Value: v})
+		}
+	}
+	return projected
+}
+
+// Ordered moves the given keys to the front, keeping the remaining fields in their original order.
+func (r Record) Ordered(order []string) Record {
+	if len(order) == 0 {
+		return r
+	}
+	ordered := r.Project(order)
+	seen := make(map[string]bool, len(order))
+	for _, k := range order {
+		seen[k] = true
+	}
+	for _, f := range r.Fields {
+		if !seen[f.Key] {
+			ordered.Fields = append(ordered.Fields, f)
+		}
+	}
+	return ordered
+}
+
+// Logfmt renders the fields as key=value pairs, quoting values where necessary.
+func (r Record) Logfmt() string {
+	var b strings.Builder
+	for i, f := range r.Fields {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(f.Key)
+		b.WriteByte('=')
+		b.WriteString(quote(f.Value))
+	}
+	return b.String()
+}
+
+func quote(v string) string {
+	if v == "" || strings.ContainsAny(v, " \t\"=") {
+		return strconv.Quote(v)
+	}
+	return v
+}
+
+// Level returns the lower-cased value of the common level keys, if any.
+func (r Record) Level() string {
+	for _, key := range []string{"level", "lvl", "severity", "log.level"} {
+		if v, ok := r.Get(key); ok {
+			return strings.ToLower(v)
+		}
+	}
+	return ""
+}
+
+func parseJSON(data []byte, prefix string) ([]Field, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if _, err := dec.Token(); err != nil { // opening brace
+		return nil, err
+	}
+	fields := make([]Field, 0)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := prefix + tok.(string)
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		switch {
+		case len(raw) > 0 && raw[0] == '{':
+			nested, err := parseJSON(raw, key+".")
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, nested...)
+		case len(raw) > 0 && raw[0] == '"':
+			var s string
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return nil, err
+			}
+			fields = append(fields, Field{Key: key, Value: s})
+		default:
+			fields = append(fields, Field{Key: key, Value: string(raw)})
+		}
+	}
+	return fields, nil
+}
+
+// parseLogfmt parses lines made up only of key=value pairs. At least two pairs are required
+// so that plain text which happens to contain a "=" is not mistaken for logfmt.
+func parseLogfmt(line string) ([]Field, bool) {
+	fields := make([]Field, 0)
+	i := 0
+	for i < len(line) {
+		for i < len(line) && line[i] == ' ' {
+			i++
+		}
+		if i >= len(line) {
+			break
+		}
+		start := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' && line[i] != '"' {
+			i++
+		}
+		if i >= len(line) || line[i] != '=' || i == start {
+			return nil, false
+		}
+		key := line[start:i]
+		i++
+		var value string
+		if i < len(line) && line[i] == '"' {
+			end := i + 1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(line) {
+				return nil, false
+			}
+			unquoted, err := strconv.Unquote(line[i : end+1])
+			if err != nil {
+				return nil, false
+			}
+			value = unquoted
+			i = end + 1
+		} else {
+			start = i
+			for i < len(line) && line[i] != ' ' {
+				i++
+			}
+			value = line[start:i]
+		}
+		fields = append(fields, Field{Key: key, Value: value})
+	}
+	return fields, len(fields) >= 2
+}
@@ -0,0 +1,48 @@
+package structured_test
+
+import (
+	"testing"
+
+	"github.com/revolyssup/k8sdebug/pkg/structured"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	rec := structured.Parse(`{"ts":"t1","level":"error","ctx":{"user_id":42},"tags":["a"]}`)
+	require.Equal(t, structured.FormatJSON, rec.Format)
+	assert.Equal(t, []structured.Field{
+		{Key: "ts", Value: "t1"},
+		{Key: "level", Value: "error"},
+		{Key: "ctx.user_id", Value: "42"},
+		{Key: "tags", Value: `["a"]`},
+	}, rec.Fields)
+
+	rec = structured.Parse(`level=warn msg="slow query" latency_ms=700`)
+	require.Equal(t, structured.FormatLogfmt, rec.Format)
+	msg, _ := rec.Get("msg")
+	assert.Equal(t, "slow query", msg)
+	assert.Equal(t, `msg="slow query" latency_ms=700`, rec.Project([]string{"msg", "latency_ms", "missing"}).Logfmt())
+
+	assert.Equal(t, structured.FormatPlain, structured.Parse("listening on port=80").Format)
+}
+
+func TestCondition(t *testing.T) {
+	rec := structured.Parse(`level=warn msg="slow query" latency_ms=700`)
+	for expr, want := range map[string]bool{
+		"level=warn":       true,
+		"level!=warn":      false,
+		"msg=~^slow":       true,
+		"latency_ms>500":   true,
+		"latency_ms<=500":  false,
+		"user_id=42":       false,
+		"user_id!=42":      true,
+		"msg!~timeout|err": true,
+	} {
+		c, err := structured.ParseCondition(expr)
+		require.NoError(t, err, expr)
+		assert.Equal(t, want, c.Match(rec), expr)
+	}
+	_, err := structured.ParseCondition("latency_ms>fast")
+	assert.Error(t, err)
+}
@@ -0,0 +1,53 @@
+package structured
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var (
+	timeKeys     = []string{"ts", "time", "timestamp", "@timestamp", "t"}
+	leadingTime  = regexp.MustCompile(`^\[?(\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?)`)
+	timeLayouts  = []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999Z0700", "2006-01-02 15:04:05.999999999Z07:00", "2006-01-02 15:04:05.999999999Z0700"}
+	localLayouts = []string{"2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05.999999999"}
+)
+
+// Timestamp extracts the time a line was logged at, either from a time field of a JSON or logfmt
+// line or from a timestamp at the start of the line.
+func Timestamp(line string) (time.Time, bool) {
+	if rec := Parse(line); rec.Structured() {
+		for _, k := range timeKeys {
+			if v, ok := rec.Get(k); ok {
+				if t, ok := parseTime(v); ok {
+					return t, true
+				}
+			}
+		}
+	}
+	if m := leadingTime.FindStringSubmatch(line); m != nil {
+		return parseTime(m[1])
+	}
+	return time.Time{}, false
+}
+
+func parseTime(v string) (time.Time, bool) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, true
+		}
+	}
+	for _, layout := range localLayouts {
+		if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+			return t, true
+		}
+	}
+	// Unix timestamps in seconds or milliseconds.
+	if f, err := strconv.ParseFloat(v, 64); err == nil && f > 1e9 {
+		if f > 1e12 {
+			return time.UnixMilli(int64(f)), true
+		}
+		return time.Unix(int64(f), int64((f-float64(int64(f)))*1e9)), true
+	}
+	return time.Time{}, false
+}
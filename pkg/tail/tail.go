@@ -0,0 +1,193 @@
+// Package tail reads the first or last lines of log files without loading them in memory.
+package tail
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// MaxLineSize is the longest line read by the scanners. Longer lines make them fail with bufio.ErrTooLong.
+const MaxLineSize = 1024 * 1024
+
+const chunkSize = 64 * 1024
+
+// Filter rewrites a line and reports whether it is kept. A nil Filter keeps every line unchanged.
+type Filter func(string) (string, bool)
+
+// ReverseScanner reads the lines of a file from the last one to the first, like bufio.Scanner
+// does forwards. Only the current chunk and the line being assembled are held in memory, lines
+// longer than MaxLineSize make it fail with bufio.ErrTooLong.
+type ReverseScanner struct {
+	r      io.ReadSeeker
+	offset int64
+	// buf[start:end] holds the bytes of the file from offset that are not scanned yet. Chunks are
+	// read into the free space before start.
+	buf        []byte
+	start, end int
+	line       string
+	started    bool
+	done       bool
+	err        error
+}
+
+func NewReverseScanner(r io.ReadSeeker) *ReverseScanner {
+	return &ReverseScanner{r: r}
+}
+
+func (s *ReverseScanner) Scan() bool {
+	if s.done {
+		return false
+	}
+	if !s.started {
+		s.started = true
+		size, err := s.r.Seek(0, io.SeekEnd)
+		if err != nil {
+			return s.fail(err)
+		}
+		if size == 0 {
+			s.done = true
+			return false
+		}
+		s.offset = size
+		if !s.readChunk() {
+			return false
+		}
+		// Like bufio.ScanLines, a final newline does not start an empty last line.
+		if s.buf[s.end-1] == '\n' {
+			s.end--
+		}
+	}
+	for {
+		pending := s.buf[s.start:s.end]
+		i := bytes.LastIndexByte(pending, '\n')
+		if len(pending)-i-1 > MaxLineSize {
+			return s.fail(bufio.ErrTooLong)
+		}
+		if i >= 0 {
+			s.line = string(dropCR(pending[i+1:]))
+			s.end = s.start + i
+			return true
+		}
+		if s.offset == 0 {
+			s.line = string(dropCR(pending))
+			s.done = true
+			return true
+		}
+		if !s.readChunk() {
+			return false
+		}
+	}
+}
+
+// readChunk reads the chunk before offset in front of the pending bytes. When there is no room left
+// before them, the pending bytes are moved to the end of the buffer, which grows to hold at most a
+// line of MaxLineSize and a chunk.
+func (s *ReverseScanner) readChunk() bool {
+	size := int(min(int64(chunkSize), s.offset))
+	if s.start < size {
+		n := s.end - s.start
+		buf := s.buf
+		if n+size > len(buf) {
+			buf = make([]byte, max(n+size, min(2*len(buf), MaxLineSize+chunkSize)))
+		}
+		copy(buf[len(buf)-n:], s.buf[s.start:s.end])
+		s.buf, s.start, s.end = buf, len(buf)-n, len(buf)
+	}
+	s.offset -= int64(size)
+	if _, err := s.r.Seek(s.offset, io.SeekStart); err != nil {
+		return s.fail(err)
+	}
+	if _, err := io.ReadFull(s.r, s.buf[s.start-size:s.start]); err != nil {
+		return s.fail(err)
+	}
+	s.start -= size
+	return true
+}
+
+func (s *ReverseScanner) fail(err error) bool {
+	s.err = err
+	s.done = true
+	return false
+}
+
+func (s *ReverseScanner) Text() string {
+	return s.line
+}
+
+func (s *ReverseScanner) Err() error {
+	return s.err
+}
+
+// Last returns the last n lines of r kept by keep, in file order.
+func Last(r io.ReadSeeker, n int, keep Filter) ([]string, error) {
+	lines := make([]string, 0)
+	scanner := NewReverseScanner(r)
+	for len(lines) < n && scanner.Scan() {
+		line, ok := apply(keep, scanner.Text())
+		if ok {
+			lines = append(lines, line)
+		}
+	}
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return lines, scanner.Err()
+}
+
+// First returns the first n lines of r kept by keep. Reading stops as soon as n lines are found.
+func First(r io.Reader, n int, keep Filter) ([]string, error) {
+	lines := make([]string, 0)
+	if n <= 0 {
+		return lines, nil
+	}
+	scanner := NewScanner(r)
+	for scanner.Scan() {
+		line, ok := apply(keep, scanner.Text())
+		if !ok {
+			continue
+		}
+		lines = append(lines, line)
+		if len(lines) == n {
+			break
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// Copy streams every line of r kept by keep to w.
+func Copy(w io.Writer, r io.Reader, keep Filter) error {
+	scanner := NewScanner(r)
+	out := bufio.NewWriter(w)
+	for scanner.Scan() {
+		line, ok := apply(keep, scanner.Text())
+		if !ok {
+			continue
+		}
+		if _, err := out.WriteString(line + "\n"); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+// NewScanner returns a line scanner accepting lines up to MaxLineSize.
+func NewScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, chunkSize), MaxLineSize)
+	return scanner
+}
+
+func apply(keep Filter, line string) (string, bool) {
+	if keep == nil {
+		return line, true
+	}
+	return keep(line)
+}
+
+func dropCR(b []byte) []byte {
+	return bytes.TrimSuffix(b, []byte("\r"))
+}
@@ -0,0 +1,72 @@
+package tail_test
+
+import (
+	"bufio"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/revolyssup/k8sdebug/pkg/tail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReverseScannerMatchesForward(t *testing.T) {
+	var big strings.Builder
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&big, "line %d %s\n", i, strings.Repeat("x", i%50))
+	}
+	inputs := []string{"", "\n", "a", "a\n", "a\n\nb", "a\r\nb\r\n", "\n\nlast", strings.Repeat("y", 200000) + "\nz\n", big.String()}
+	for _, input := range inputs {
+		var want []string
+		forward := bufio.NewScanner(strings.NewReader(input))
+		forward.Buffer(nil, tail.MaxLineSize)
+		for forward.Scan() {
+			want = append(want, forward.Text())
+		}
+		slices.Reverse(want)
+		var got []string
+		reverse := tail.NewReverseScanner(strings.NewReader(input))
+		for reverse.Scan() {
+			got = append(got, reverse.Text())
+		}
+		require.NoError(t, reverse.Err())
+		assert.Equal(t, want, got, "input of %d bytes", len(input))
+	}
+}
+
+func TestReverseScannerTooLong(t *testing.T) {
+	input := "first\n" + strings.Repeat("y", tail.MaxLineSize+1) + "\nlast\n"
+	reverse := tail.NewReverseScanner(strings.NewReader(input))
+	require.True(t, reverse.Scan())
+	assert.Equal(t, "last", reverse.Text())
+	assert.False(t, reverse.Scan())
+	assert.ErrorIs(t, reverse.Err(), bufio.ErrTooLong)
+
+	input = "first\n" + strings.Repeat("y", tail.MaxLineSize) + "\nlast\n"
+	var got []string
+	reverse = tail.NewReverseScanner(strings.NewReader(input))
+	for reverse.Scan() {
+		got = append(got, reverse.Text())
+	}
+	require.NoError(t, reverse.Err())
+	assert.Equal(t, []string{"last", strings.Repeat("y", tail.MaxLineSize), "first"}, got)
+}
+
+func TestFirstLast(t *testing.T) {
+	logs := "a\nskip\nb\nc\nskip\nd\n"
+	keep := func(line string) (string, bool) { return strings.ToUpper(line), line != "skip" }
+
+	last, err := tail.Last(strings.NewReader(logs), 3, keep)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"B", "C", "D"}, last)
+
+	first, err := tail.First(strings.NewReader(logs), 3, keep)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"A", "B", "C"}, first)
+
+	all, err := tail.Last(strings.NewReader(logs), 100, nil)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Split(strings.TrimSuffix(logs, "\n"), "\n"), all)
+}
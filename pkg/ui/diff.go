@@ -0,0 +1,94 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/revolyssup/k8sdebug/pkg/diffrender"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/rivo/tview"
+)
+
+// diffPane shows the diff between the logs of the last two pods marked in the tree.
+type diffPane struct {
+	text  *tview.TextView
+	marks []store.Pod
+	// sizes of the marked log files when the diff was last computed.
+	sizes [2]int64
+}
+
+func newDiffPane() *diffPane {
+	d := &diffPane{text: tview.NewTextView().SetDynamicColors(true).SetWrap(false)}
+	d.text.SetBorder(true).SetTitle(" Diff ")
+	d.text.SetText("mark two pods with m to diff their logs")
+	return d
+}
+
+func (d *diffPane) mark(pod store.Pod) {
+	d.marks = append(d.marks, pod)
+	if len(d.marks) > 2 {
+		d.marks = d.marks[len(d.marks)-2:]
+	}
+	d.sizes = [2]int64{-1, -1}
+	if len(d.marks) == 1 {
+		d.text.SetTitle(fmt.Sprintf(" Diff %s ... ", pod.Name))
+		return
+	}
+	d.text.SetTitle(fmt.Sprintf(" Diff %s ... %s ", d.marks[0].Name, d.marks[1].Name))
+	d.refresh()
+	d.text.ScrollToBeginning()
+}
+
+// refresh recomputes the diff if one of the marked log files changed.
+func (d *diffPane) refresh() {
+	if len(d.marks) < 2 {
+		return
+	}
+	var sizes [2]int64
+	var logs [2]string
+	for i, pod := range d.marks {
+		info, err := os.Stat(pod.LogPath)
+		if err != nil {
+			d.text.SetText(fmt.Sprintf("[red]%s[-]", tview.Escape(err.Error())))
+			return
+		}
+		sizes[i] = info.Size()
+	}
+	if sizes == d.sizes {
+		return
+	}
+	for i, pod := range d.marks {
+		lines, err := readTail(pod.LogPath, maxLines)
+		if err != nil {
+			d.text.SetText(fmt.Sprintf("[red]%s[-]", tview.Escape(err.Error())))
+			return
+		}
+		logs[i] = strings.Join(lines, "\n")
+	}
+	d.sizes = sizes
+	from := diffrender.Side{Pod: d.marks[0].Name, CreatedAt: d.marks[0].CreatedAt}
+	to := diffrender.Side{Pod: d.marks[1].Name, CreatedAt: d.marks[1].CreatedAt}
+	d.text.SetText(renderDiff(diffrender.Compute(from, to, logs[0], logs[1], 3)))
+}
+
+func renderDiff(diff diffrender.Diff) string {
+	if diff.Empty() {
+		return "[green]no differences[-]"
+	}
+	var b strings.Builder
+	for _, h := range diff.Hunks {
+		fmt.Fprintf(&b, "[teal]@@ -%d,%d +%d,%d @@[-]\n", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+		for _, l := range h.Lines {
+			switch l.Op {
+			case diffrender.OpDelete:
+				b.WriteString("[red]-" + tview.Escape(l.Text) + "[-]\n")
+			case diffrender.OpInsert:
+				b.WriteString("[green]+" + tview.Escape(l.Text) + "[-]\n")
+			default:
+				b.WriteString(" " + tview.Escape(l.Text) + "\n")
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,90 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/rivo/tview"
+)
+
+// nodeRef is attached to the nodes of the owner tree. Pod and container nodes carry the pod.
+type nodeRef struct {
+	pod       *store.Pod
+	container string
+}
+
+func newOwnerTree(s *store.Store) *tview.TreeView {
+	root := buildTree(s)
+	tree := tview.NewTreeView().SetRoot(root).SetCurrentNode(root)
+	tree.SetBorder(true).SetTitle(" Owners ")
+	return tree
+}
+
+// buildTree builds namespace > owner > revision > pod > container nodes from the store.
+func buildTree(s *store.Store) *tview.TreeNode {
+	root := tview.NewTreeNode(s.Root).SetColor(tcell.ColorYellow)
+	namespaces, err := s.Namespaces()
+	if err != nil {
+		root.AddChild(tview.NewTreeNode(fmt.Sprintf("error: %v", err)).SetColor(tcell.ColorRed))
+		return root
+	}
+	for _, ns := range namespaces {
+		nsNode := tview.NewTreeNode(ns).SetColor(tcell.ColorGreen)
+		root.AddChild(nsNode)
+		owned := make(map[string]bool)
+		owners, _ := s.Owners(ns)
+		for _, owner := range owners {
+			pods, err := s.Pods(ns, owner.Kind, owner.Name)
+			if err != nil {
+				continue
+			}
+			ownerNode := tview.NewTreeNode(owner.String()).SetColor(tcell.ColorTeal).SetExpanded(false)
+			nsNode.AddChild(ownerNode)
+			revisions := store.Revisions(pods)
+			revisionNodes := make(map[int]*tview.TreeNode)
+			if len(revisions) > 1 {
+				for _, rev := range revisions {
+					revisionNodes[rev] = tview.NewTreeNode(fmt.Sprintf("revision %d", rev)).SetExpanded(rev == revisions[len(revisions)-1])
+					ownerNode.AddChild(revisionNodes[rev])
+				}
+			}
+			for _, pod := range pods {
+				owned[pod.Name] = true
+				parent := ownerNode
+				if n, ok := revisionNodes[pod.Revision]; ok {
+					parent = n
+				}
+				parent.AddChild(podNode(s, pod))
+			}
+		}
+		// Pods without an owner only have a log file.
+		pods, _ := s.AllPods(ns)
+		for _, pod := range pods {
+			if !owned[pod.Name] {
+				nsNode.AddChild(podNode(s, pod))
+			}
+		}
+	}
+	return root
+}
+
+func podNode(s *store.Store, pod store.Pod) *tview.TreeNode {
+	text := pod.Name
+	if pod.CreatedAt != "" {
+		text += " (" + pod.CreatedAt + ")"
+	}
+	node := tview.NewTreeNode(text).SetReference(nodeRef{pod: &pod}).SetExpanded(false)
+	status, err := s.Status(pod.Namespace, pod.Name)
+	if err != nil {
+		return node
+	}
+	if status.Deleted {
+		node.SetColor(tcell.ColorGray)
+	}
+	for _, c := range status.Containers {
+		label := fmt.Sprintf("%s [%s, %d restarts]", c.Name, c.State, c.Restarts)
+		node.AddChild(tview.NewTreeNode(tview.Escape(label)).SetReference(nodeRef{pod: &pod, container: c.Name}))
+	}
+	return node
+}
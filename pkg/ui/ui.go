@@ -0,0 +1,179 @@
+package ui
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/revolyssup/k8sdebug/pkg/workspace"
+	"github.com/rivo/tview"
+	"github.com/spf13/cobra"
+)
+
+var (
+	maxLines        int
+	refreshInterval time.Duration
+)
+
+const helpText = "[yellow]Tab[-] switch pane  [yellow]Enter[-] open  [yellow]m[-] mark pod for diff  [yellow]/[-] search  [yellow]n/N[-] next/prev match  [yellow]f[-] filter  [yellow]r[-] reload  [yellow]q[-] quit"
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ui",
+		Short: "Browse the recorded log store in a terminal UI",
+		Long: `Browse the recorded log store in a full-screen terminal UI with three panes:
+an owner tree (namespace, owner, revision, pod, container), a log viewer with incremental search and filters,
+and a diff pane showing the diff between the two pods marked with "m".`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			app := newBrowser(workspace.Current())
+			if err := app.run(); err != nil {
+				cmd.Println(pkg.ColorLine(fmt.Sprintf("ui failed: %v", err), pkg.ColorRed))
+			}
+		},
+	}
+	cmd.Flags().IntVar(&maxLines, "max-lines", 5000, "maximum number of lines loaded from the end of a log file")
+	cmd.Flags().DurationVar(&refreshInterval, "refresh", 2*time.Second, "how often the open log and diff are reloaded while pods are being recorded")
+	return cmd
+}
+
+// browser is the state of the terminal UI.
+type browser struct {
+	store  *store.Store
+	app    *tview.Application
+	tree   *tview.TreeView
+	viewer *logViewer
+	diff   *diffPane
+	status *tview.TextView
+	panes  []tview.Primitive
+}
+
+func newBrowser(s *store.Store) *browser {
+	b := &browser{
+		store:  s,
+		app:    tview.NewApplication(),
+		status: tview.NewTextView().SetDynamicColors(true),
+	}
+	b.tree = newOwnerTree(s)
+	b.viewer = newLogViewer(b)
+	b.diff = newDiffPane()
+	b.status.SetText(helpText)
+
+	b.tree.SetSelectedFunc(func(node *tview.TreeNode) {
+		ref, ok := node.GetReference().(nodeRef)
+		if !ok || ref.pod == nil {
+			node.SetExpanded(!node.IsExpanded())
+			return
+		}
+		b.viewer.open(*ref.pod)
+		b.app.SetFocus(b.viewer.text)
+	})
+	b.tree.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Rune() != 'm' {
+			return event
+		}
+		if ref, ok := b.tree.GetCurrentNode().GetReference().(nodeRef); ok && ref.pod != nil {
+			b.diff.mark(*ref.pod)
+			b.setStatus(fmt.Sprintf("marked %s for diff", ref.pod.Name))
+		}
+		return nil
+	})
+
+	right := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(b.viewer.layout, 0, 3, false).
+		AddItem(b.diff.text, 0, 2, false)
+	main := tview.NewFlex().
+		AddItem(b.tree, 0, 1, true).
+		AddItem(right, 0, 3, false)
+	root := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(main, 0, 1, true).
+		AddItem(b.status, 1, 0, false)
+	b.panes = []tview.Primitive{b.tree, b.viewer.text, b.diff.text}
+
+	b.app.SetRoot(root, true).SetInputCapture(b.handleKey)
+	return b
+}
+
+func (b *browser) run() error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(refreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				b.app.QueueUpdateDraw(func() {
+					b.viewer.refresh()
+					b.diff.refresh()
+				})
+			}
+		}
+	}()
+	return b.app.Run()
+}
+
+// handleKey handles the keys that work in every pane. Keys typed into the search and filter inputs are left alone.
+func (b *browser) handleKey(event *tcell.EventKey) *tcell.EventKey {
+	if b.viewer.editing() {
+		return event
+	}
+	switch event.Key() {
+	case tcell.KeyTab, tcell.KeyBacktab:
+		b.cycleFocus(event.Key() == tcell.KeyTab)
+		return nil
+	}
+	switch event.Rune() {
+	case 'q':
+		b.app.Stop()
+		return nil
+	case '/':
+		b.app.SetFocus(b.viewer.search)
+		return nil
+	case 'f':
+		b.app.SetFocus(b.viewer.filter)
+		return nil
+	case 'n':
+		b.viewer.nextMatch(1)
+		return nil
+	case 'N':
+		b.viewer.nextMatch(-1)
+		return nil
+	case 'r':
+		b.tree.SetRoot(buildTree(b.store))
+		b.tree.SetCurrentNode(b.tree.GetRoot())
+		b.setStatus("reloaded the store")
+		return nil
+	}
+	return event
+}
+
+func (b *browser) cycleFocus(forward bool) {
+	current := b.app.GetFocus()
+	for i, p := range b.panes {
+		if p != current {
+			continue
+		}
+		step := 1
+		if !forward {
+			step = len(b.panes) - 1
+		}
+		b.app.SetFocus(b.panes[(i+step)%len(b.panes)])
+		return
+	}
+	b.app.SetFocus(b.panes[0])
+}
+
+// setStatus shows a message in the status line, the help text comes back after a few seconds.
+func (b *browser) setStatus(msg string) {
+	b.status.SetText(tview.Escape(msg))
+	time.AfterFunc(3*time.Second, func() {
+		b.app.QueueUpdateDraw(func() {
+			b.status.SetText(helpText)
+		})
+	})
+}
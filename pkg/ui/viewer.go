@@ -0,0 +1,191 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+	"github.com/revolyssup/k8sdebug/pkg/structured"
+	"github.com/revolyssup/k8sdebug/pkg/tail"
+	"github.com/rivo/tview"
+)
+
+// logViewer shows the logs of one pod with an incremental search and a filter.
+type logViewer struct {
+	b      *browser
+	pod    *store.Pod
+	size   int64
+	lines  []string
+	text   *tview.TextView
+	search *tview.InputField
+	filter *tview.InputField
+	layout *tview.Flex
+
+	// matches are the rows of the rendered lines matching the search, current is the selected one.
+	matches []int
+	current int
+}
+
+func newLogViewer(b *browser) *logViewer {
+	v := &logViewer{
+		b:      b,
+		text:   tview.NewTextView().SetDynamicColors(true).SetWrap(false),
+		search: tview.NewInputField().SetLabel("search: "),
+		filter: tview.NewInputField().SetLabel("filter: "),
+	}
+	v.text.SetBorder(true).SetTitle(" Logs ")
+	v.search.SetChangedFunc(func(string) { v.render(true) })
+	v.filter.SetChangedFunc(func(string) { v.render(false) })
+	leave := func(tcell.Key) { b.app.SetFocus(v.text) }
+	v.search.SetDoneFunc(leave)
+	v.filter.SetDoneFunc(leave)
+	inputs := tview.NewFlex().
+		AddItem(v.search, 0, 1, false).
+		AddItem(v.filter, 0, 1, false)
+	v.layout = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(inputs, 1, 0, false).
+		AddItem(v.text, 0, 1, false)
+	return v
+}
+
+// editing reports whether the search or filter input has the focus.
+func (v *logViewer) editing() bool {
+	return v.search.HasFocus() || v.filter.HasFocus()
+}
+
+func (v *logViewer) open(pod store.Pod) {
+	v.pod = &pod
+	v.size = -1
+	v.text.SetTitle(fmt.Sprintf(" Logs of %s ", pod.Name))
+	v.refresh()
+	v.text.ScrollToEnd()
+}
+
+// refresh reloads the log file if it grew since it was last read.
+func (v *logViewer) refresh() {
+	if v.pod == nil {
+		return
+	}
+	info, err := os.Stat(v.pod.LogPath)
+	if err != nil {
+		v.text.SetText(fmt.Sprintf("[red]%s[-]", tview.Escape(err.Error())))
+		return
+	}
+	if info.Size() == v.size {
+		return
+	}
+	lines, err := readTail(v.pod.LogPath, maxLines)
+	if err != nil {
+		v.text.SetText(fmt.Sprintf("[red]%s[-]", tview.Escape(err.Error())))
+		return
+	}
+	v.size = info.Size()
+	v.lines = lines
+	v.render(false)
+}
+
+// render draws the lines passing the filter and highlights the search matches.
+// jump scrolls to the first match, used while the search is typed.
+func (v *logViewer) render(jump bool) {
+	keep := lineFilter(v.filter.GetText())
+	search := compileSearch(v.search.GetText())
+	var b strings.Builder
+	v.matches = v.matches[:0]
+	row := 0
+	for _, line := range v.lines {
+		if !keep(line) {
+			continue
+		}
+		if search != nil {
+			if locs := search.FindAllStringIndex(line, -1); len(locs) > 0 {
+				v.matches = append(v.matches, row)
+				prev := 0
+				for _, loc := range locs {
+					b.WriteString(tview.Escape(line[prev:loc[0]]))
+					b.WriteString("[black:yellow]" + tview.Escape(line[loc[0]:loc[1]]) + "[-:-]")
+					prev = loc[1]
+				}
+				b.WriteString(tview.Escape(line[prev:]) + "\n")
+				row++
+				continue
+			}
+		}
+		b.WriteString(colorize(line) + "\n")
+		row++
+	}
+	v.text.SetText(b.String())
+	if jump && len(v.matches) > 0 {
+		v.current = 0
+		v.text.ScrollTo(v.matches[0], 0)
+	}
+}
+
+func (v *logViewer) nextMatch(step int) {
+	if len(v.matches) == 0 {
+		return
+	}
+	v.current = (v.current + step + len(v.matches)) % len(v.matches)
+	v.text.ScrollTo(v.matches[v.current], 0)
+	v.b.setStatus(fmt.Sprintf("match %d of %d", v.current+1, len(v.matches)))
+}
+
+func colorize(line string) string {
+	switch structured.Severity(line) {
+	case structured.SeverityError:
+		return "[red]" + tview.Escape(line) + "[-]"
+	case structured.SeverityWarn:
+		return "[yellow]" + tview.Escape(line) + "[-]"
+	}
+	return tview.Escape(line)
+}
+
+// compileSearch compiles the search as a case-insensitive regular expression, or as plain text if it is not a valid one.
+func compileSearch(s string) *regexp.Regexp {
+	if s == "" {
+		return nil
+	}
+	re, err := regexp.Compile("(?i)" + s)
+	if err != nil {
+		re = regexp.MustCompile("(?i)" + regexp.QuoteMeta(s))
+	}
+	return re
+}
+
+// lineFilter builds the filter typed by the user. When every word is a field condition like
+// level=error the JSON and logfmt fields are matched, otherwise the text is a regular expression.
+func lineFilter(s string) func(string) bool {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return func(string) bool { return true }
+	}
+	conditions := make([]structured.Condition, 0)
+	for _, word := range strings.Fields(s) {
+		c, err := structured.ParseCondition(word)
+		if err != nil {
+			conditions = nil
+			break
+		}
+		conditions = append(conditions, c)
+	}
+	if conditions != nil {
+		return func(line string) bool {
+			rec := structured.Parse(line)
+			return rec.Structured() && structured.MatchAll(rec, conditions)
+		}
+	}
+	re := compileSearch(s)
+	return re.MatchString
+}
+
+// readTail returns at most n lines from the end of the file.
+func readTail(path string, n int) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return tail.Last(file, n, nil)
+}
@@ -0,0 +1,17 @@
+package pkg
+
+import "runtime/debug"
+
+// Version is set at build time with -ldflags "-X github.com/revolyssup/k8sdebug/pkg.Version=v1.2.3".
+var Version string
+
+// BuildVersion returns Version, or the module version when k8sdebug was installed with go install.
+func BuildVersion() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
@@ -0,0 +1,162 @@
+package workspace
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/completion"
+	"github.com/revolyssup/k8sdebug/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+// listedWorkspace is a workspace as shown by workspace list.
+type listedWorkspace struct {
+	Name       string `json:"name"`
+	Active     bool   `json:"active"`
+	Path       string `json:"path"`
+	Namespaces int    `json:"namespaces"`
+	Pods       int    `json:"pods"`
+	Bytes      int64  `json:"bytes"`
+}
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "workspace",
+		Short: "Manage workspaces, separate log stores such as imported captures",
+		Long: `Manage workspaces. Every workspace has its own log store under ~/.k8sdebug/workspaces/<name>.
+The "default" workspace is the live store at logsPath (see config --help) the recorder writes to.
+The logs and ui commands read the active workspace selected with "workspace use".`,
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "create <name>",
+		Short: "Create an empty workspace",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := Create(args[0]); err != nil {
+				cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+				return
+			}
+			cmd.Println(pkg.ColorLine(fmt.Sprintf("Created workspace %s", args[0]), pkg.ColorGreen))
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:               "use <name>",
+		Short:             "Select the workspace read by the logs and ui commands",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: CompleteNames,
+		Run: func(cmd *cobra.Command, args []string) {
+			if _, err := Open(args[0]); err != nil {
+				cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+				return
+			}
+			name := args[0]
+			if name == Default {
+				name = ""
+			}
+			if err := pkg.SetWorkspace(name); err != nil {
+				cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+				return
+			}
+			cmd.Println(pkg.ColorLine(fmt.Sprintf("Using workspace %s", args[0]), pkg.ColorGreen))
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the workspaces with the size of their stores",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			names, err := List()
+			if err != nil {
+				cmd.Println(pkg.ColorLine(fmt.Sprintf("could not list workspaces: %v", err), pkg.ColorRed))
+				return
+			}
+			listed := make([]listedWorkspace, 0, len(names))
+			for _, name := range names {
+				listed = append(listed, describe(name))
+			}
+			if output.Structured() {
+				if err := output.Write(os.Stdout, listed); err != nil {
+					cmd.PrintErrln("Error encoding workspaces:", err)
+				}
+				return
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "\tNAME\tNAMESPACES\tPODS\tSIZE\tPATH")
+			for _, ws := range listed {
+				marker := ""
+				if ws.Active {
+					marker = "*"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%s\n", marker, ws.Name, ws.Namespaces, ws.Pods, ws.Bytes, ws.Path)
+			}
+			w.Flush()
+		},
+	})
+	var force bool
+	rmCmd := &cobra.Command{
+		Use:               "rm <name>",
+		Short:             "Remove a workspace and its logs",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: CompleteNames,
+		Run: func(cmd *cobra.Command, args []string) {
+			name := args[0]
+			if name == Active() && !force {
+				cmd.Println(pkg.ColorLine(fmt.Sprintf("workspace %s is active, use --force to remove it anyway", name), pkg.ColorRed))
+				return
+			}
+			if err := Remove(name); err != nil {
+				cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+				return
+			}
+			if name == Active() {
+				if err := pkg.SetWorkspace(""); err != nil {
+					cmd.Println(pkg.ColorLine(err.Error(), pkg.ColorRed))
+					return
+				}
+			}
+			cmd.Println(pkg.ColorLine(fmt.Sprintf("Removed workspace %s", name), pkg.ColorGreen))
+		},
+	}
+	rmCmd.Flags().BoolVar(&force, "force", false, "remove the workspace even if it is active, switching back to the default workspace")
+	cmd.AddCommand(rmCmd)
+	return cmd
+}
+
+// describe counts the namespaces, pods and bytes of a workspace store. A missing store is listed as empty.
+func describe(name string) listedWorkspace {
+	ws := listedWorkspace{Name: name, Active: name == Active()}
+	ws.Path, _ = Path(name)
+	s, err := Open(name)
+	if err != nil {
+		return ws
+	}
+	namespaces, _ := s.Namespaces()
+	ws.Namespaces = len(namespaces)
+	for _, ns := range namespaces {
+		pods, _ := s.AllPods(ns)
+		ws.Pods += len(pods)
+	}
+	filepath.WalkDir(ws.Path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			ws.Bytes += info.Size()
+		}
+		return nil
+	})
+	return ws
+}
+
+// CompleteNames completes the name of an existing workspace.
+func CompleteNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	names, _ := List()
+	return completion.Values(names, toComplete)
+}
@@ -0,0 +1,115 @@
+// Package workspace manages named log stores, e.g. imported captures, kept apart from the live recording.
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/store"
+)
+
+// Default is the workspace of the live store at logsPath, where the recorder writes.
+const Default = "default"
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// Root is the directory holding the workspaces, next to the k8sdebug config file.
+func Root() string {
+	return filepath.Join(filepath.Dir(pkg.ConfigFilePath), "workspaces")
+}
+
+// Dir returns the directory of a named workspace. The default workspace has no directory of its own.
+func Dir(name string) (string, error) {
+	if name == Default {
+		return "", fmt.Errorf("%s is the live store at %s, choose another workspace name", Default, pkg.ConfigData.LogsPath)
+	}
+	if !validName.MatchString(name) {
+		return "", fmt.Errorf("invalid workspace name %q, use letters, digits, '.', '_' and '-'", name)
+	}
+	return filepath.Join(Root(), name), nil
+}
+
+// Path returns the store directory of the workspace.
+func Path(name string) (string, error) {
+	if name == Default {
+		return pkg.ConfigData.LogsPath, nil
+	}
+	return Dir(name)
+}
+
+// Active returns the workspace selected with workspace use.
+func Active() string {
+	if pkg.ConfigData.Workspace == "" {
+		return Default
+	}
+	return pkg.ConfigData.Workspace
+}
+
+// Open returns the store of an existing workspace.
+func Open(name string) (*store.Store, error) {
+	dir, err := Path(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("workspace %s does not exist", name)
+	}
+	return store.New(dir), nil
+}
+
+// Current returns the store of the active workspace. If it was removed, the live store is used.
+func Current() *store.Store {
+	s, err := Open(Active())
+	if err != nil {
+		return store.New(pkg.ConfigData.LogsPath)
+	}
+	return s
+}
+
+// List returns the default workspace followed by the named workspaces in alphabetical order.
+func List() ([]string, error) {
+	names := []string{Default}
+	entries, err := os.ReadDir(Root())
+	if os.IsNotExist(err) {
+		return names, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	named := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() && validName.MatchString(e.Name()) {
+			named = append(named, e.Name())
+		}
+	}
+	sort.Strings(named)
+	return append(names, named...), nil
+}
+
+// Create creates an empty named workspace.
+func Create(name string) error {
+	dir, err := Dir(name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return fmt.Errorf("workspace %s already exists", name)
+	}
+	return os.MkdirAll(dir, 0755)
+}
+
+// Remove deletes a named workspace and its logs.
+func Remove(name string) error {
+	dir, err := Dir(name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("workspace %s does not exist", name)
+	}
+	return os.RemoveAll(dir)
+}
@@ -0,0 +1,83 @@
+package workspace_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/revolyssup/k8sdebug/pkg"
+	"github.com/revolyssup/k8sdebug/pkg/workspace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setup points the config, the state and the live store to a temporary directory.
+func setup(t *testing.T) string {
+	dir := t.TempDir()
+	configFile, statePath, logsPath, active := pkg.ConfigFilePath, pkg.StatePath, pkg.ConfigData.LogsPath, pkg.ConfigData.Workspace
+	t.Cleanup(func() {
+		pkg.ConfigFilePath, pkg.StatePath, pkg.ConfigData.LogsPath, pkg.ConfigData.Workspace = configFile, statePath, logsPath, active
+	})
+	pkg.ConfigFilePath = filepath.Join(dir, "config.yaml")
+	pkg.StatePath = filepath.Join(dir, "state.yaml")
+	pkg.ConfigData.LogsPath = filepath.Join(dir, "logs")
+	pkg.ConfigData.Workspace = ""
+	require.NoError(t, os.MkdirAll(pkg.ConfigData.LogsPath, 0755))
+	return dir
+}
+
+func run(t *testing.T, args ...string) string {
+	var out bytes.Buffer
+	cmd := workspace.NewCommand()
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs(args)
+	require.NoError(t, cmd.Execute())
+	return out.String()
+}
+
+func TestWorkspaces(t *testing.T) {
+	dir := setup(t)
+
+	assert.Contains(t, run(t, "create", "capture"), "Created workspace capture")
+	assert.DirExists(t, filepath.Join(dir, "workspaces", "capture"))
+	assert.Contains(t, run(t, "create", "capture"), "already exists")
+	assert.Contains(t, run(t, "create", "../escape"), "invalid workspace name")
+	assert.Contains(t, run(t, "create", workspace.Default), "is the live store")
+
+	names, err := workspace.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{workspace.Default, "capture"}, names)
+
+	assert.Contains(t, run(t, "use", "missing"), "does not exist")
+	assert.Equal(t, workspace.Default, workspace.Active())
+	assert.Contains(t, run(t, "use", "capture"), "Using workspace capture")
+	assert.Equal(t, "capture", workspace.Active())
+	assert.Equal(t, filepath.Join(dir, "workspaces", "capture"), workspace.Current().Root)
+	state, err := os.ReadFile(pkg.StatePath)
+	require.NoError(t, err)
+	assert.Contains(t, string(state), "workspace: capture")
+
+	// The active workspace is only removed with --force, which switches back to the default one.
+	assert.Contains(t, run(t, "rm", "capture"), "is active")
+	assert.DirExists(t, filepath.Join(dir, "workspaces", "capture"))
+	assert.Contains(t, run(t, "rm", "capture", "--force"), "Removed workspace capture")
+	assert.NoDirExists(t, filepath.Join(dir, "workspaces", "capture"))
+	assert.Equal(t, workspace.Default, workspace.Active())
+	assert.Equal(t, pkg.ConfigData.LogsPath, workspace.Current().Root)
+
+	assert.Contains(t, run(t, "rm", "capture"), "does not exist")
+	assert.Contains(t, run(t, "rm", workspace.Default), "is active")
+	assert.DirExists(t, pkg.ConfigData.LogsPath)
+}
+
+func TestRemoveInactive(t *testing.T) {
+	dir := setup(t)
+	require.NoError(t, workspace.Create("old"))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "workspaces", "old", "x.log"), []byte("x\n"), 0644))
+	assert.Contains(t, run(t, "rm", "old"), "Removed workspace old")
+	names, err := workspace.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{workspace.Default}, names)
+}